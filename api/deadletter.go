@@ -0,0 +1,29 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// ReplayDeadLetterFile writes batches from the dead letter file at path, created by write.FileDeadLetterSink, using writeAPI.
+// Each batch is written by a single WriteRecord call, so writeAPI should not have batching enabled.
+// Replaying stops at the first failed write. It returns number of replayed batches, which can be skipped when replaying again.
+// The file is not removed.
+func ReplayDeadLetterFile(ctx context.Context, path string, writeAPI WriteAPIBlocking) (int, error) {
+	letters, err := write.ReadDeadLetterFile(path)
+	if err != nil {
+		return 0, err
+	}
+	for i, letter := range letters {
+		if err := writeAPI.WriteRecord(ctx, letter.Batch); err != nil {
+			return i, fmt.Errorf("replaying batch %d of %s: %w", i+1, path, err)
+		}
+	}
+	return len(letters), nil
+}
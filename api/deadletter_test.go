@@ -0,0 +1,55 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayDeadLetterFile(t *testing.T) {
+	sink, err := write.NewFileDeadLetterSink(t.TempDir(), 0)
+	require.NoError(t, err)
+	for _, b := range []string{"a f=1i 1\na f=2i 2\n", "a f=3i 3\n", "a f=4i 4\n"} {
+		require.NoError(t, sink.WriteDeadLetter(&write.DeadLetter{Batch: b, Reason: write.DeadLetterClosed, Time: time.Now()}))
+	}
+	require.NoError(t, sink.Close())
+	files, err := sink.Files()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	service := test.NewTestService(t, "http://localhost:8888")
+	writeAPI := NewWriteAPIBlocking("my-org", "my-bucket", service, write.DefaultOptions())
+	n, err := ReplayDeadLetterFile(context.Background(), files[0], writeAPI)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	assert.Equal(t, 3, service.Requests())
+	assert.Equal(t, []string{"a f=1i 1", "a f=2i 2", "a f=3i 3", "a f=4i 4"}, service.Lines())
+
+	service.Close()
+	writes := 0
+	service.SetRequestHandler(func(url string, body io.Reader) error {
+		writes++
+		if writes == 2 {
+			return errors.New("connection refused")
+		}
+		return service.DecodeLines(body)
+	})
+	n, err = ReplayDeadLetterFile(context.Background(), files[0], writeAPI)
+	require.Error(t, err)
+	assert.Equal(t, 1, n)
+	assert.Len(t, service.Lines(), 2)
+
+	_, err = ReplayDeadLetterFile(context.Background(), "not-existing.lp", writeAPI)
+	require.Error(t, err)
+}
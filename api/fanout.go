@@ -0,0 +1,331 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+)
+
+// ErrFanOutQueueFull reports data discarded for a target of FanOutWriteAPI, because the target doesn't keep up with writing
+var ErrFanOutQueueFull = errors.New("fan-out queue of the target is full")
+
+// FanOutTarget is a destination of FanOutWriteAPI
+type FanOutTarget struct {
+	// Name identifies the target in errors
+	Name string
+	// WriteAPI writing to the destination, such as WriteAPI of a client for org and bucket
+	WriteAPI WriteAPI
+}
+
+// FanOutError is an error of writing to a target of FanOutWriteAPI
+type FanOutError struct {
+	// Name of the target
+	Target string
+	// Err is the error of writing
+	Err error
+}
+
+// Error returns error message with the target name
+func (e *FanOutError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Target, e.Err.Error())
+}
+
+// Unwrap returns the error of writing
+func (e *FanOutError) Unwrap() error {
+	return e.Err
+}
+
+// fanOutItem is a record or a point queued for a target, or a flush request
+type fanOutItem struct {
+	ctx   context.Context
+	line  string
+	point *write.Point
+	ack   *fanOutAck
+	// closed when the target is flushed, set for flush requests
+	flushed chan struct{}
+}
+
+// fanOutTarget holds queue of data for a target, which is written by a forwarding goroutine
+type fanOutTarget struct {
+	FanOutTarget
+	queue chan fanOutItem
+	done  chan struct{}
+}
+
+// wrapError returns err as FanOutError of the target
+func (t *fanOutTarget) wrapError(err error) error {
+	return &FanOutError{Target: t.Name, Err: err}
+}
+
+// FanOutWriteAPI is WriteAPI writing every record and point to several targets, such as an old and a new server during migration.
+// Each target has its own buffer, retry queue and callbacks given by its WriteAPI, and its own queue of data waiting to be written.
+// A slow or unavailable target doesn't stall the others: when its queue is full, data for the target is discarded,
+// which is reported by FanOutError nesting ErrFanOutQueueFull.
+// Errors of all targets are reported by a single Errors channel, as FanOutError with the target name.
+// FanOutWriteAPI doesn't close the WriteAPIs of the targets, Close only writes the queued data to them.
+type FanOutWriteAPI struct {
+	targets   []*fanOutTarget
+	errCh     chan error
+	errOnce   sync.Once
+	errStop   chan struct{}
+	errWg     sync.WaitGroup
+	closeOnce sync.Once
+	// closeMu guards closed, writes and flushes hold the read lock while using queues of targets
+	closeMu sync.RWMutex
+	// true when closed, data written afterwards are discarded
+	closed bool
+}
+
+// NewFanOutWriteAPI returns FanOutWriteAPI writing to targets. queueSize is the maximum number of records and points
+// waiting to be written to each target.
+func NewFanOutWriteAPI(queueSize int, targets ...FanOutTarget) *FanOutWriteAPI {
+	f := &FanOutWriteAPI{
+		errCh:   make(chan error, len(targets)),
+		errStop: make(chan struct{}),
+	}
+	for _, t := range targets {
+		target := &fanOutTarget{FanOutTarget: t, queue: make(chan fanOutItem, queueSize), done: make(chan struct{})}
+		f.targets = append(f.targets, target)
+		go f.forward(target)
+	}
+	return f
+}
+
+// forward writes queued data to the target until the queue is closed
+func (f *FanOutWriteAPI) forward(t *fanOutTarget) {
+	defer close(t.done)
+	for item := range t.queue {
+		switch {
+		case item.flushed != nil:
+			t.WriteAPI.Flush()
+			close(item.flushed)
+		case item.point != nil && item.ack != nil:
+			item.ack.wait(t.WriteAPI.WritePointWithAck(item.point, nil), t.wrapError)
+		case item.point != nil:
+			t.WriteAPI.WritePointWithContext(item.ctx, item.point)
+		case item.ack != nil:
+			item.ack.wait(t.WriteAPI.WriteRecordWithAck(item.line, nil), t.wrapError)
+		default:
+			t.WriteAPI.WriteRecordWithContext(item.ctx, item.line)
+		}
+	}
+}
+
+// enqueue adds item to queues of all targets, without blocking.
+// Item is discarded if FanOutWriteAPI is closed.
+func (f *FanOutWriteAPI) enqueue(item fanOutItem) {
+	f.closeMu.RLock()
+	defer f.closeMu.RUnlock()
+	if f.closed {
+		log.Warn("FanOutWriteAPI is closed, discarding data")
+		if item.ack != nil {
+			item.ack.ack.Resolve(write.ErrWriteAPIClosed)
+		}
+		return
+	}
+	for _, t := range f.targets {
+		select {
+		case t.queue <- item:
+		default:
+			log.Warnf("Fan-out queue of %s is full, discarding data", t.Name)
+			err := &FanOutError{Target: t.Name, Err: ErrFanOutQueueFull}
+			if item.ack != nil {
+				item.ack.resolve(err)
+			}
+			f.reportError(err)
+		}
+	}
+}
+
+// reportError sends err to the Errors channel, if it is read
+func (f *FanOutWriteAPI) reportError(err error) {
+	select {
+	case <-f.errStop:
+	default:
+		select {
+		case f.errCh <- err:
+		default:
+			log.Warn("Cannot write error to error channel, it is not read")
+		}
+	}
+}
+
+// WriteRecord writes asynchronously line protocol record to all targets
+func (f *FanOutWriteAPI) WriteRecord(line string) {
+	f.enqueue(fanOutItem{ctx: context.Background(), line: line})
+}
+
+// WritePoint writes asynchronously Point to all targets
+func (f *FanOutWriteAPI) WritePoint(point *write.Point) {
+	f.enqueue(fanOutItem{ctx: context.Background(), point: point})
+}
+
+// WriteRecordWithAck writes asynchronously line protocol record to all targets.
+// It returns acknowledgement with the correlation id, which is resolved when the record is written to all targets,
+// or with the first error of a target.
+func (f *FanOutWriteAPI) WriteRecordWithAck(line string, id interface{}) *write.Ack {
+	ack := newFanOutAck(write.NewAck(id), len(f.targets))
+	f.enqueue(fanOutItem{ctx: context.Background(), line: line, ack: ack})
+	return ack.ack
+}
+
+// WritePointWithAck writes asynchronously Point to all targets.
+// It returns acknowledgement with the correlation id, which is resolved when the point is written to all targets,
+// or with the first error of a target.
+func (f *FanOutWriteAPI) WritePointWithAck(point *write.Point, id interface{}) *write.Ack {
+	ack := newFanOutAck(write.NewAck(id), len(f.targets))
+	f.enqueue(fanOutItem{ctx: context.Background(), point: point, ack: ack})
+	return ack.ack
+}
+
+// WriteRecordWithContext writes asynchronously line protocol record to all targets, the same way as WriteRecord.
+// Spans of writes of batches with the record are linked to the span in ctx, if tracing is enabled.
+func (f *FanOutWriteAPI) WriteRecordWithContext(ctx context.Context, line string) {
+	f.enqueue(fanOutItem{ctx: ctx, line: line})
+}
+
+// WritePointWithContext writes asynchronously Point to all targets, the same way as WritePoint.
+// Spans of writes of batches with the point are linked to the span in ctx, if tracing is enabled.
+func (f *FanOutWriteAPI) WritePointWithContext(ctx context.Context, point *write.Point) {
+	f.enqueue(fanOutItem{ctx: ctx, point: point})
+}
+
+// Flush writes queued data to all targets and flushes them
+func (f *FanOutWriteAPI) Flush() {
+	f.closeMu.RLock()
+	defer f.closeMu.RUnlock()
+	if f.closed {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, t := range f.targets {
+		wg.Add(1)
+		go func(t *fanOutTarget) {
+			defer wg.Done()
+			flushed := make(chan struct{})
+			t.queue <- fanOutItem{flushed: flushed}
+			<-flushed
+		}(t)
+	}
+	wg.Wait()
+}
+
+// Errors returns a channel for reading errors of all targets, which are FanOutError with the target name.
+// Must be called before performing any writes for errors to be collected.
+// New error is skipped when channel is not read.
+func (f *FanOutWriteAPI) Errors() <-chan error {
+	f.errOnce.Do(func() {
+		for _, t := range f.targets {
+			f.errWg.Add(1)
+			go func(t *fanOutTarget, errCh <-chan error) {
+				defer f.errWg.Done()
+				for {
+					select {
+					case err, ok := <-errCh:
+						if !ok {
+							return
+						}
+						f.reportError(&FanOutError{Target: t.Name, Err: err})
+					case <-f.errStop:
+						return
+					}
+				}
+			}(t, t.WriteAPI.Errors())
+		}
+	})
+	return f.errCh
+}
+
+// SetWriteFailedCallback sets callback allowing custom handling of failed writes to all targets.
+func (f *FanOutWriteAPI) SetWriteFailedCallback(cb WriteFailedCallback) {
+	for _, t := range f.targets {
+		t.WriteAPI.SetWriteFailedCallback(cb)
+	}
+}
+
+// SetWriteSucceededCallback sets callback notified about batches written to all targets.
+func (f *FanOutWriteAPI) SetWriteSucceededCallback(cb WriteSucceededCallback) {
+	for _, t := range f.targets {
+		t.WriteAPI.SetWriteSucceededCallback(cb)
+	}
+}
+
+// SetUndeliveredCallback sets callback notified about batches discarded while WriteAPIs of targets are being closed.
+func (f *FanOutWriteAPI) SetUndeliveredCallback(cb UndeliveredCallback) {
+	for _, t := range f.targets {
+		t.WriteAPI.SetUndeliveredCallback(cb)
+	}
+}
+
+// Close writes queued data to all targets, flushes them and stops forwarding of data and errors.
+// WriteAPIs of the targets remain open. Data written after closing are discarded
+// and their acknowledgements are resolved with write.ErrWriteAPIClosed.
+func (f *FanOutWriteAPI) Close() {
+	f.closeOnce.Do(func() {
+		f.Flush()
+		f.closeMu.Lock()
+		f.closed = true
+		f.closeMu.Unlock()
+		for _, t := range f.targets {
+			close(t.queue)
+			<-t.done
+		}
+		close(f.errStop)
+		f.errWg.Wait()
+		close(f.errCh)
+	})
+}
+
+// fanOutAck is acknowledgement resolved when all targets acknowledge data
+type fanOutAck struct {
+	ack       *write.Ack
+	lock      sync.Mutex
+	remaining int
+	firstErr  error
+}
+
+// newFanOutAck returns fanOutAck resolving ack when the given number of targets is resolved
+func newFanOutAck(ack *write.Ack, targets int) *fanOutAck {
+	a := &fanOutAck{ack: ack, remaining: targets}
+	if targets == 0 {
+		a.ack.Resolve(nil)
+	}
+	return a
+}
+
+// resolve counts acknowledgement of a target with err and resolves ack when all targets are resolved
+func (a *fanOutAck) resolve(err error) {
+	a.lock.Lock()
+	if err != nil && a.firstErr == nil {
+		a.firstErr = err
+	}
+	a.remaining--
+	done, firstErr := a.remaining == 0, a.firstErr
+	a.lock.Unlock()
+	if done {
+		a.ack.Resolve(firstErr)
+	}
+}
+
+// wait resolves the acknowledgement of a target when ack of its WriteAPI is resolved, with error wrapped by wrap
+func (a *fanOutAck) wait(ack *write.Ack, wrap func(err error) error) {
+	go func() {
+		<-ack.Done()
+		if err := ack.Err(); err != nil {
+			a.resolve(wrap(err))
+		} else {
+			a.resolve(nil)
+		}
+	}()
+}
+
+// ensure FanOutWriteAPI implements WriteAPI
+var _ WriteAPI = (*FanOutWriteAPI)(nil)
@@ -0,0 +1,126 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFanOutWrite(t *testing.T) {
+	fastService := test.NewTestService(t, "http://localhost:8888")
+	slowService := test.NewTestService(t, "http://localhost:8888")
+	release := make(chan struct{})
+	slowService.SetRequestHandler(func(_ string, body io.Reader) error {
+		<-release
+		return slowService.DecodeLines(body)
+	})
+	fast := NewWriteAPI("my-org", "my-bucket", fastService, write.DefaultOptions().SetBatchSize(1))
+	slow := NewWriteAPI("my-org", "my-bucket", slowService, write.DefaultOptions().SetBatchSize(1))
+	fanOut := NewFanOutWriteAPI(2, FanOutTarget{Name: "fast", WriteAPI: fast}, FanOutTarget{Name: "slow", WriteAPI: slow})
+
+	var errs []error
+	var lock sync.Mutex
+	errCh := fanOut.Errors()
+	errsDone := make(chan struct{})
+	go func() {
+		defer close(errsDone)
+		for err := range errCh {
+			lock.Lock()
+			errs = append(errs, err)
+			lock.Unlock()
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		fanOut.WriteRecord(fmt.Sprintf("test,t=a f=%di %d", i, i))
+		// slow target doesn't stall the fast one
+		require.Eventually(t, func() bool {
+			return len(fastService.Lines()) == i+1
+		}, time.Second, time.Millisecond)
+	}
+	assert.Len(t, slowService.Lines(), 0)
+
+	close(release)
+	fanOut.Close()
+	<-errsDone
+	assert.Less(t, len(slowService.Lines()), 20)
+	assert.Greater(t, len(slowService.Lines()), 0)
+	require.NotEmpty(t, errs)
+	for _, err := range errs {
+		var fanOutErr *FanOutError
+		require.True(t, errors.As(err, &fanOutErr))
+		assert.Equal(t, "slow", fanOutErr.Target)
+		assert.ErrorIs(t, err, ErrFanOutQueueFull)
+	}
+	fast.Close()
+	slow.Close()
+}
+
+func TestFanOutErrors(t *testing.T) {
+	service1 := test.NewTestService(t, "http://localhost:8888")
+	service2 := test.NewTestService(t, "http://localhost:8888")
+	service2.SetReplyError(&http.Error{
+		StatusCode: 400,
+		Code:       "invalid",
+		Message:    "data",
+	})
+	opts := write.DefaultOptions().SetBatchSize(1).SetMaxRetries(0)
+	writeAPI1 := NewWriteAPI("my-org", "my-bucket", service1, opts)
+	writeAPI2 := NewWriteAPI("my-org", "my-bucket", service2, opts)
+	fanOut := NewFanOutWriteAPI(10, FanOutTarget{Name: "a", WriteAPI: writeAPI1}, FanOutTarget{Name: "b", WriteAPI: writeAPI2})
+	errCh := fanOut.Errors()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	points := test.GenPoints(2)
+	ack := fanOut.WritePointWithAck(points[0], 1)
+	err := ack.Wait(ctx)
+	require.Error(t, err)
+	assert.Equal(t, 1, ack.ID())
+	var fanOutErr *FanOutError
+	require.True(t, errors.As(err, &fanOutErr))
+	assert.Equal(t, "b", fanOutErr.Target)
+	assert.Len(t, service1.Lines(), 1)
+
+	select {
+	case err := <-errCh:
+		require.True(t, errors.As(err, &fanOutErr))
+		assert.Equal(t, "b", fanOutErr.Target)
+		assert.Equal(t, "b: write failed (attempts 0): invalid: data", err.Error())
+	case <-ctx.Done():
+		require.Fail(t, "error not reported")
+	}
+
+	service2.SetReplyError(nil)
+	ack = fanOut.WritePointWithAck(points[1], 2)
+	require.NoError(t, ack.Wait(ctx))
+	assert.Len(t, service1.Lines(), 2)
+	assert.Len(t, service2.Lines(), 1)
+
+	fanOut.Close()
+	_, ok := <-errCh
+	assert.False(t, ok)
+
+	// data written after closing are discarded
+	ack = fanOut.WritePointWithAck(points[0], 3)
+	assert.ErrorIs(t, ack.Wait(ctx), write.ErrWriteAPIClosed)
+	fanOut.WritePoint(points[0])
+	fanOut.Flush()
+	fanOut.Close()
+	writeAPI1.Close()
+	writeAPI2.Close()
+}
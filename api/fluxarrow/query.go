@@ -0,0 +1,100 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+// Package fluxarrow provides flux query results as Apache Arrow records.
+// It is a separate package, so the Arrow dependency is required only by applications using it.
+package fluxarrow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/domain"
+)
+
+// QueryAPI performs flux queries against InfluxDB server and returns results as Apache Arrow records.
+// Query parameters are passed the same way as in api.QueryAPI.
+type QueryAPI struct {
+	org         string
+	httpService http2.Service
+	mem         memory.Allocator
+	maxRows     int
+}
+
+// NewQueryAPI returns new QueryAPI for querying buckets belonging to org.
+// service can be obtained by client.HTTPService().
+func NewQueryAPI(org string, service http2.Service) *QueryAPI {
+	return &QueryAPI{org: org, httpService: service, mem: memory.DefaultAllocator, maxRows: DefaultMaxRows}
+}
+
+// SetAllocator sets memory allocator used for the records. Default is memory.DefaultAllocator.
+func (q *QueryAPI) SetAllocator(mem memory.Allocator) *QueryAPI {
+	q.mem = mem
+	return q
+}
+
+// SetMaxRows sets maximum number of rows in a single record. Default is DefaultMaxRows. Zero value means no limit.
+func (q *QueryAPI) SetMaxRows(maxRows int) *QueryAPI {
+	q.maxRows = maxRows
+	return q
+}
+
+// queryBody holds the body for an HTTP query request.
+type queryBody struct {
+	Dialect *domain.Dialect  `json:"dialect,omitempty"`
+	Query   string           `json:"query"`
+	Type    domain.QueryType `json:"type"`
+	Params  interface{}      `json:"params,omitempty"`
+}
+
+// Query executes flux query on the InfluxDB server and returns RecordReader, which converts streamed response into arrow records
+func (q *QueryAPI) Query(ctx context.Context, query string) (*RecordReader, error) {
+	return q.QueryWithParams(ctx, query, nil)
+}
+
+// QueryWithParams executes flux parametrized query on the InfluxDB server and returns RecordReader, which converts streamed response into arrow records
+func (q *QueryAPI) QueryWithParams(ctx context.Context, query string, params interface{}) (*RecordReader, error) {
+	u, err := url.Parse(q.httpService.ServerAPIURL())
+	if err != nil {
+		return nil, err
+	}
+	u.Path = path.Join(u.Path, "query")
+	u.RawQuery = url.Values{"org": {q.org}}.Encode()
+	qrJSON, err := json.Marshal(queryBody{
+		Query:   query,
+		Type:    domain.QueryTypeFlux,
+		Dialect: api.DefaultDialect(),
+		Params:  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var reader *RecordReader
+	perror := q.httpService.DoPostRequest(ctx, u.String(), bytes.NewReader(qrJSON), func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Encoding", "gzip")
+	},
+		func(resp *http.Response) error {
+			if resp.Header.Get("Content-Encoding") == "gzip" {
+				resp.Body, err = gzip.NewReader(resp.Body)
+				if err != nil {
+					return err
+				}
+			}
+			reader = NewRecordReader(resp.Body, q.mem).SetMaxRows(q.maxRows)
+			return nil
+		})
+	if perror != nil {
+		return nil, perror
+	}
+	return reader, nil
+}
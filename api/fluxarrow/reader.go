@@ -0,0 +1,435 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package fluxarrow
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+const (
+	stringDatatype       = "string"
+	doubleDatatype       = "double"
+	boolDatatype         = "boolean"
+	longDatatype         = "long"
+	uLongDatatype        = "unsignedLong"
+	durationDatatype     = "duration"
+	base64BinaryDataType = "base64Binary"
+	timeDatatypeRFC      = "dateTime:RFC3339"
+	timeDatatypeRFCNano  = "dateTime:RFC3339Nano"
+)
+
+// Keys of the arrow field metadata describing flux column
+const (
+	// MetadataDataType holds flux data type of the column
+	MetadataDataType = "flux.datatype"
+	// MetadataGroup holds "true" if the column is part of the group key, otherwise "false"
+	MetadataGroup = "flux.group"
+	// MetadataDefault holds default value of the column
+	MetadataDefault = "flux.default"
+)
+
+// DefaultMaxRows is the default maximum number of rows in a single record
+const DefaultMaxRows = 64 * 1024
+
+// RecordReader reads flux query response in the annotated CSV format and converts each flux table into arrow records with typed columns.
+// Values are parsed directly into arrow builders, without creating intermediate Go values for each row.
+//
+// A table is returned as a single record, unless it has more rows than the limit set by SetMaxRows, then it is split into more records.
+// Walking though the result is done by repeatedly calling Next() until returns false.
+// Preliminary end can be caused by an error, so when Next() return false, check Err() for an error.
+type RecordReader struct {
+	closer    io.Closer
+	csvReader *csv.Reader
+	mem       memory.Allocator
+	maxRows   int
+
+	tablePosition int
+	table         *query.FluxTableMetadata
+	tableChanged  bool
+	schema        *arrow.Schema
+	builder       *array.RecordBuilder
+	appenders     []appender
+	rows          int
+	// row read ahead of the actual record
+	pendingRow []string
+	pending    bool
+
+	record arrow.Record
+	err    error
+	done   bool
+}
+
+// appender parses a value and appends it to an arrow builder
+type appender func(s string) error
+
+// NewRecordReader returns new RecordReader reading annotated CSV from rawResponse.
+// Arrow memory is allocated using mem, or memory.DefaultAllocator if mem is nil.
+func NewRecordReader(rawResponse io.ReadCloser, mem memory.Allocator) *RecordReader {
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	csvReader := csv.NewReader(rawResponse)
+	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
+	return &RecordReader{closer: rawResponse, csvReader: csvReader, mem: mem, maxRows: DefaultMaxRows}
+}
+
+// SetMaxRows sets maximum number of rows in a single record. Default is DefaultMaxRows. Zero value means no limit.
+func (r *RecordReader) SetMaxRows(maxRows int) *RecordReader {
+	r.maxRows = maxRows
+	return r
+}
+
+// Next advances to the next record.
+// Actual record is available through Record() function.
+// Returns false in case of end or an error, otherwise true
+func (r *RecordReader) Next() bool {
+	r.releaseRecord()
+	r.tableChanged = false
+	if r.done {
+		return false
+	}
+	for {
+		var row []string
+		if r.pending {
+			row = r.pendingRow
+			r.pending = false
+		} else {
+			var err error
+			row, err = r.csvReader.Read()
+			if err == io.EOF {
+				if r.rows > 0 {
+					r.newRecord()
+					return true
+				}
+				return r.finish()
+			}
+			if err != nil {
+				r.err = err
+				return r.finish()
+			}
+		}
+		if len(row) <= 1 {
+			continue
+		}
+		isAnnotation := len(row[0]) > 0 && row[0][0] == '#'
+		if r.rows > 0 && (isAnnotation || (r.maxRows > 0 && r.rows == r.maxRows)) {
+			// the row belongs to the next record, keep it for the next call
+			r.pendingRow = append(r.pendingRow[:0], row...)
+			r.pending = true
+			r.newRecord()
+			return true
+		}
+		if isAnnotation {
+			if r.err = r.readAnnotations(row); r.err != nil {
+				return r.finish()
+			}
+			continue
+		}
+		if r.table == nil {
+			r.err = errors.New("parsing error, annotations not found")
+			return r.finish()
+		}
+		if r.err = r.appendRow(row); r.err != nil {
+			return r.finish()
+		}
+	}
+}
+
+// readAnnotations reads annotations and header rows of a new table, first annotation row is given
+func (r *RecordReader) readAnnotations(row []string) error {
+	r.table = query.NewFluxTableMetadata(r.tablePosition)
+	r.tablePosition++
+	r.tableChanged = true
+	for i := range row[1:] {
+		r.table.AddColumn(query.NewFluxColumn(i))
+	}
+	dataTypeAnnotationFound := false
+	for {
+		if len(row)-1 != len(r.table.Columns()) {
+			return fmt.Errorf("parsing error, row has different number of columns than the table: %d vs %d", len(row)-1, len(r.table.Columns()))
+		}
+		switch row[0] {
+		case "#datatype":
+			dataTypeAnnotationFound = true
+			for i, d := range row[1:] {
+				r.table.Column(i).SetDataType(d)
+			}
+		case "#group":
+			for i, g := range row[1:] {
+				r.table.Column(i).SetGroup(g == "true")
+			}
+		case "#default":
+			for i, c := range row[1:] {
+				r.table.Column(i).SetDefaultValue(c)
+			}
+		case "":
+			if !dataTypeAnnotationFound {
+				return errors.New("parsing error, datatype annotation not found")
+			}
+			if row[1] == "error" {
+				return r.readError()
+			}
+			for i, n := range row[1:] {
+				r.table.Column(i).SetName(n)
+			}
+			return r.createBuilder()
+		}
+		var err error
+		row, err = r.csvReader.Read()
+		if err == io.EOF {
+			return errors.New("parsing error, table header not found")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readError reads error message of the flux error table
+func (r *RecordReader) readError() error {
+	row, err := r.csvReader.Read()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	message := "unknown query error"
+	if len(row) > 1 && len(row[1]) > 0 {
+		message = row[1]
+	}
+	reference := ""
+	if len(row) > 2 && len(row[2]) > 0 {
+		reference = fmt.Sprintf(",%s", row[2])
+	}
+	return fmt.Errorf("%s%s", message, reference)
+}
+
+// createBuilder creates arrow schema and record builder for the actual table
+func (r *RecordReader) createBuilder() error {
+	if r.builder != nil {
+		r.builder.Release()
+		r.builder = nil
+	}
+	columns := r.table.Columns()
+	fields := make([]arrow.Field, len(columns))
+	for i, c := range columns {
+		t, err := arrowType(c.DataType())
+		if err != nil {
+			return fmt.Errorf("%s has %w", c.Name(), err)
+		}
+		fields[i] = arrow.Field{
+			Name:     c.Name(),
+			Type:     t,
+			Nullable: true,
+			Metadata: arrow.NewMetadata(
+				[]string{MetadataDataType, MetadataGroup, MetadataDefault},
+				[]string{c.DataType(), strconv.FormatBool(c.IsGroup()), c.DefaultValue()}),
+		}
+	}
+	r.schema = arrow.NewSchema(fields, nil)
+	r.builder = array.NewRecordBuilder(r.mem, r.schema)
+	r.appenders = make([]appender, len(columns))
+	for i, c := range columns {
+		r.appenders[i] = newAppender(r.builder.Field(i), c)
+	}
+	return nil
+}
+
+// arrowType returns arrow data type for the flux data type
+func arrowType(dataType string) (arrow.DataType, error) {
+	switch dataType {
+	case stringDatatype:
+		return arrow.BinaryTypes.String, nil
+	case doubleDatatype:
+		return arrow.PrimitiveTypes.Float64, nil
+	case boolDatatype:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case longDatatype:
+		return arrow.PrimitiveTypes.Int64, nil
+	case uLongDatatype:
+		return arrow.PrimitiveTypes.Uint64, nil
+	case durationDatatype:
+		return arrow.FixedWidthTypes.Duration_ns, nil
+	case base64BinaryDataType:
+		return arrow.BinaryTypes.Binary, nil
+	case timeDatatypeRFC, timeDatatypeRFCNano:
+		return &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}, nil
+	default:
+		return nil, fmt.Errorf("unknown data type %s", dataType)
+	}
+}
+
+// newAppender returns appender for the column, which appends to the builder b.
+// Empty value is replaced by the column default value. Missing value is appended as null.
+func newAppender(b array.Builder, c *query.FluxColumn) appender {
+	def := c.DefaultValue()
+	name := c.Name()
+	var parse func(s string) error
+	switch b := b.(type) {
+	case *array.StringBuilder:
+		parse = func(s string) error {
+			b.Append(s)
+			return nil
+		}
+	case *array.Float64Builder:
+		parse = func(s string) error {
+			v, err := strconv.ParseFloat(s, 64)
+			if err == nil {
+				b.Append(v)
+			}
+			return err
+		}
+	case *array.BooleanBuilder:
+		parse = func(s string) error {
+			b.Append(strings.ToLower(s) != "false")
+			return nil
+		}
+	case *array.Int64Builder:
+		parse = func(s string) error {
+			v, err := strconv.ParseInt(s, 10, 64)
+			if err == nil {
+				b.Append(v)
+			}
+			return err
+		}
+	case *array.Uint64Builder:
+		parse = func(s string) error {
+			v, err := strconv.ParseUint(s, 10, 64)
+			if err == nil {
+				b.Append(v)
+			}
+			return err
+		}
+	case *array.DurationBuilder:
+		parse = func(s string) error {
+			v, err := time.ParseDuration(s)
+			if err == nil {
+				b.Append(arrow.Duration(v))
+			}
+			return err
+		}
+	case *array.BinaryBuilder:
+		parse = func(s string) error {
+			v, err := base64.StdEncoding.DecodeString(s)
+			if err == nil {
+				b.Append(v)
+			}
+			return err
+		}
+	case *array.TimestampBuilder:
+		parse = func(s string) error {
+			v, err := time.Parse(time.RFC3339Nano, s)
+			if err == nil {
+				b.Append(arrow.Timestamp(v.UnixNano()))
+			}
+			return err
+		}
+	}
+	return func(s string) error {
+		if s == "" {
+			s = def
+		}
+		if s == "" {
+			b.AppendNull()
+			return nil
+		}
+		if err := parse(s); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// appendRow appends a data row to the record builder
+func (r *RecordReader) appendRow(row []string) error {
+	if len(row)-1 != len(r.appenders) {
+		return fmt.Errorf("parsing error, row has different number of columns than the table: %d vs %d", len(row)-1, len(r.appenders))
+	}
+	for i, v := range row[1:] {
+		if err := r.appenders[i](v); err != nil {
+			return err
+		}
+	}
+	r.rows++
+	return nil
+}
+
+// newRecord creates record from the builder
+func (r *RecordReader) newRecord() {
+	r.record = r.builder.NewRecord()
+	r.rows = 0
+}
+
+func (r *RecordReader) releaseRecord() {
+	if r.record != nil {
+		r.record.Release()
+		r.record = nil
+	}
+}
+
+// finish ends reading in case of the end of data or an error
+func (r *RecordReader) finish() bool {
+	r.done = true
+	if err := r.Close(); err != nil && r.err == nil {
+		r.err = err
+	}
+	return false
+}
+
+// Record returns the actual record. It is released by the next call of Next() or Close().
+// Call Retain() on the record to keep it longer.
+func (r *RecordReader) Record() arrow.Record {
+	return r.record
+}
+
+// Schema returns arrow schema of the actual record
+func (r *RecordReader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// TableMetadata returns flux metadata of the table of the actual record
+func (r *RecordReader) TableMetadata() *query.FluxTableMetadata {
+	return r.table
+}
+
+// TableChanged returns true if the actual record starts a new flux table
+func (r *RecordReader) TableChanged() bool {
+	return r.tableChanged
+}
+
+// Err returns an error raised during flux query response parsing
+func (r *RecordReader) Err() error {
+	return r.err
+}
+
+// Close releases the actual record, reads remaining data and closes underlying response
+func (r *RecordReader) Close() error {
+	r.releaseRecord()
+	if r.builder != nil {
+		r.builder.Release()
+		r.builder = nil
+	}
+	if r.closer == nil {
+		return nil
+	}
+	var err error
+	for err == nil {
+		_, err = r.csvReader.Read()
+	}
+	err = r.closer.Close()
+	r.closer = nil
+	return err
+}
@@ -0,0 +1,207 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package fluxarrow
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const csvTables = `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339Nano,double,string,string,boolean,unsignedLong,duration,base64Binary
+#group,false,false,true,false,false,true,true,false,false,false,false
+#default,_result,,,,,,,,,,
+,result,table,_start,_time,_value,_field,_measurement,ok,count,elapsed,raw
+,,0,2020-02-17T22:19:49.747562847Z,2020-02-18T10:34:08.135814545Z,1.4,f,test,true,1,1s,YWJj
+,,0,2020-02-17T22:19:49.747562847Z,2020-02-18T22:08:44.850214724Z,,f,test,false,2,2m,
+,,0,2020-02-17T22:19:49.747562847Z,2020-02-18T22:09:44.850214724Z,6.6,f,test,,3,3h,
+
+#datatype,string,long,dateTime:RFC3339,string
+#group,false,false,true,false
+#default,_result,,,
+,result,table,_start,_value
+,,1,2020-02-17T22:19:49.747562847Z,a
+,,1,2020-02-17T22:19:49.747562847Z,b
+
+`
+
+func TestRecordReader(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	reader := NewRecordReader(io.NopCloser(strings.NewReader(csvTables)), mem)
+	require.True(t, reader.Next(), reader.Err())
+	assert.True(t, reader.TableChanged())
+	assert.Equal(t, 0, reader.TableMetadata().Position())
+	rec := reader.Record()
+	require.EqualValues(t, 3, rec.NumRows())
+	require.EqualValues(t, 11, rec.NumCols())
+
+	schema := rec.Schema()
+	assert.Equal(t, "_value", schema.Field(4).Name)
+	assert.Equal(t, arrow.PrimitiveTypes.Float64, schema.Field(4).Type)
+	assert.Equal(t, &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}, schema.Field(2).Type)
+	v := metadata(schema.Field(2), MetadataGroup)
+	assert.Equal(t, "true", v)
+	v = metadata(schema.Field(0), MetadataDefault)
+	assert.Equal(t, "_result", v)
+	v = metadata(schema.Field(10), MetadataDataType)
+	assert.Equal(t, "base64Binary", v)
+
+	assert.Equal(t, "_result", rec.Column(0).(*array.String).Value(2))
+	assert.Equal(t, int64(0), rec.Column(1).(*array.Int64).Value(0))
+	start, _ := time.Parse(time.RFC3339Nano, "2020-02-17T22:19:49.747562847Z")
+	assert.Equal(t, arrow.Timestamp(start.UnixNano()), rec.Column(2).(*array.Timestamp).Value(1))
+	values := rec.Column(4).(*array.Float64)
+	assert.Equal(t, 1.4, values.Value(0))
+	assert.True(t, values.IsNull(1))
+	assert.Equal(t, 6.6, values.Value(2))
+	oks := rec.Column(7).(*array.Boolean)
+	assert.True(t, oks.Value(0))
+	assert.False(t, oks.Value(1))
+	assert.True(t, oks.IsNull(2))
+	assert.Equal(t, uint64(3), rec.Column(8).(*array.Uint64).Value(2))
+	assert.Equal(t, arrow.Duration(2*time.Minute), rec.Column(9).(*array.Duration).Value(1))
+	assert.Equal(t, []byte("abc"), rec.Column(10).(*array.Binary).Value(0))
+
+	require.True(t, reader.Next(), reader.Err())
+	assert.True(t, reader.TableChanged())
+	assert.Equal(t, 1, reader.TableMetadata().Position())
+	rec = reader.Record()
+	require.EqualValues(t, 2, rec.NumRows())
+	assert.Equal(t, "b", rec.Column(3).(*array.String).Value(1))
+
+	assert.False(t, reader.Next())
+	assert.NoError(t, reader.Err())
+	assert.Nil(t, reader.Record())
+}
+
+func TestRecordReaderMaxRows(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	reader := NewRecordReader(io.NopCloser(strings.NewReader(csvTables)), mem).SetMaxRows(2)
+	var rows []int64
+	var changed []bool
+	for reader.Next() {
+		rows = append(rows, reader.Record().NumRows())
+		changed = append(changed, reader.TableChanged())
+	}
+	require.NoError(t, reader.Err())
+	assert.Equal(t, []int64{2, 1, 2}, rows)
+	assert.Equal(t, []bool{true, false, true}, changed)
+}
+
+func TestRecordReaderRetain(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	reader := NewRecordReader(io.NopCloser(strings.NewReader(csvTables)), mem)
+	var records []arrow.Record
+	for reader.Next() {
+		rec := reader.Record()
+		rec.Retain()
+		records = append(records, rec)
+	}
+	require.NoError(t, reader.Err())
+	require.Len(t, records, 2)
+	assert.Equal(t, "a", records[1].Column(3).(*array.String).Value(0))
+	for _, rec := range records {
+		rec.Release()
+	}
+}
+
+func TestRecordReaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		csv   string
+		error string
+	}{
+		{"flux error", `#datatype,string,string
+#group,true,true
+#default,,
+,error,reference
+,failed to create physical plan: invalid time bounds from procedure from: bounds contain zero time,897`,
+			"failed to create physical plan: invalid time bounds from procedure from: bounds contain zero time,897"},
+		{"invalid value", `#datatype,string,long,double
+#group,false,false,false
+#default,_result,,
+,result,table,_value
+,,0,x
+`, `_value: strconv.ParseFloat: parsing "x": invalid syntax`},
+		{"unknown type", `#datatype,string,long,int
+#group,false,false,false
+#default,_result,,
+,result,table,_value
+,,0,1
+`, "_value has unknown data type int"},
+		{"missing annotations", `,result,table,_value
+,,0,1
+`, "parsing error, annotations not found"},
+		{"missing datatype", `#group,false,false,false
+#default,_result,,
+,result,table,_value
+,,0,1
+`, "parsing error, datatype annotation not found"},
+		{"column count", `#datatype,string,long,double
+#group,false,false,false
+#default,_result,,
+,result,table,_value
+,,0,1,2
+`, "parsing error, row has different number of columns than the table: 4 vs 3"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+			defer mem.AssertSize(t, 0)
+			reader := NewRecordReader(io.NopCloser(strings.NewReader(test.csv)), mem)
+			assert.False(t, reader.Next())
+			require.Error(t, reader.Err())
+			assert.Equal(t, test.error, reader.Err().Error())
+		})
+	}
+}
+
+func TestQueryAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/query", r.URL.Path)
+		assert.Equal(t, "my-org", r.URL.Query().Get("org"))
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(csvTables))
+	}))
+	defer server.Close()
+
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+	queryAPI := NewQueryAPI("my-org", http2.NewService(server.URL+"/", "a", http2.DefaultOptions())).SetAllocator(mem)
+	reader, err := queryAPI.Query(context.Background(), "from(bucket:\"b\")")
+	require.NoError(t, err)
+	var rows int64
+	for reader.Next() {
+		rows += reader.Record().NumRows()
+	}
+	require.NoError(t, reader.Err())
+	assert.EqualValues(t, 5, rows)
+}
+
+func metadata(f arrow.Field, key string) string {
+	i := f.Metadata.FindKey(key)
+	if i < 0 {
+		return ""
+	}
+	return f.Metadata.Values()[i]
+}
@@ -0,0 +1,283 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+)
+
+// EndpointStrategy selects endpoint for a request of a client with multiple server URLs
+type EndpointStrategy int
+
+const (
+	// EndpointFailover sends requests to the first healthy endpoint in the order of server URLs.
+	// The following endpoints are used only when the preceding ones are unhealthy.
+	EndpointFailover EndpointStrategy = iota
+	// EndpointRoundRobin rotates requests over healthy endpoints
+	EndpointRoundRobin
+	// EndpointLeastLatency sends requests to the healthy endpoint with the lowest average latency
+	EndpointLeastLatency
+)
+
+// latencyWeight is weight of the latest request in the average latency of an endpoint
+const latencyWeight = 0.3
+
+// EndpointStatus holds health of an endpoint
+type EndpointStatus struct {
+	// Server URL of the endpoint
+	URL string
+	// Whether the endpoint is used for requests
+	Healthy bool
+	// Number of consecutive failed requests
+	Failures int
+	// Moving average of durations of requests, until response headers are received
+	Latency time.Duration
+	// The last error, nil if the last request succeeded
+	LastError error
+	// Time of the last request or health check
+	LastCheck time.Time
+}
+
+// endpoint is a server URL with its health
+type endpoint struct {
+	url    *url.URL
+	status EndpointStatus
+	// time when the endpoint became unhealthy
+	unhealthySince time.Time
+}
+
+// EndpointPool is Doer sending requests to one of several InfluxDB servers, such as data nodes of a cluster.
+// Requests are created for the first server URL, EndpointPool redirects them to the endpoint selected by the strategy.
+// When a request fails with a connection error or with status 502, 503 or 504, the endpoint is marked unhealthy
+// and the request is sent to the next endpoint, if its body can be sent again. Otherwise, e.g. for gzipped writes,
+// the request fails and its retry is sent to another endpoint. Unhealthy endpoints are tried again
+// after the retry interval, or when CheckHealth finds them healthy. If all endpoints are unhealthy, all of them are tried.
+// Results of all requests, including Ping and Health, update health of endpoints.
+type EndpointPool struct {
+	endpoints     []*endpoint
+	strategy      EndpointStrategy
+	retryInterval time.Duration
+	doer          Doer
+	lock          sync.Mutex
+	// counter of requests for round-robin
+	next uint32
+}
+
+// NewEndpointPool creates EndpointPool for serverURLs, with the strategy, retry interval and Doer from options
+func NewEndpointPool(serverURLs []string, options *Options) (*EndpointPool, error) {
+	if len(serverURLs) == 0 {
+		return nil, errors.New("no server URL")
+	}
+	p := &EndpointPool{
+		strategy:      options.EndpointStrategy(),
+		retryInterval: time.Duration(options.EndpointRetryInterval()) * time.Second,
+		doer:          options.HTTPDoer(),
+	}
+	for _, s := range serverURLs {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid server URL %s: %w", s, err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid server URL %s: missing scheme or host", s)
+		}
+		if !strings.HasSuffix(u.Path, "/") {
+			// For subsequent path parts concatenation, url has to end with '/'
+			u.Path += "/"
+		}
+		p.endpoints = append(p.endpoints, &endpoint{url: u, status: EndpointStatus{URL: u.String(), Healthy: true}})
+	}
+	return p, nil
+}
+
+// ServerURL returns the first server URL, for which requests are created
+func (p *EndpointPool) ServerURL() string {
+	return p.endpoints[0].url.String()
+}
+
+// Status returns health of endpoints in the order of server URLs
+func (p *EndpointPool) Status() []EndpointStatus {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	statuses := make([]EndpointStatus, len(p.endpoints))
+	for i, e := range p.endpoints {
+		statuses[i] = e.status
+	}
+	return statuses
+}
+
+// CheckHealth pings all endpoints, updates their health and returns it
+func (p *EndpointPool) CheckHealth(ctx context.Context) []EndpointStatus {
+	var wg sync.WaitGroup
+	for _, e := range p.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			u, _ := e.url.Parse("ping")
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+			if err != nil {
+				p.failure(e, err)
+				return
+			}
+			start := time.Now()
+			resp, err := p.doer.Do(req)
+			if err == nil {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				_ = resp.Body.Close()
+				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					err = fmt.Errorf("ping failed with status %s", resp.Status)
+				}
+			}
+			if err != nil {
+				if ctx.Err() == nil {
+					p.failure(e, err)
+				}
+				return
+			}
+			p.success(e, time.Since(start))
+		}(e)
+	}
+	wg.Wait()
+	return p.Status()
+}
+
+// Do sends req to the endpoint selected by the strategy, trying the other endpoints if it fails
+func (p *EndpointPool) Do(req *http.Request) (*http.Response, error) {
+	candidates := p.candidates()
+	// body can be sent again only if it can be obtained again
+	resendable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	var resp *http.Response
+	var err error
+	for i, e := range candidates {
+		r := req.Clone(req.Context())
+		r.URL = p.redirect(req.URL, e)
+		r.Host = ""
+		if i > 0 && req.GetBody != nil {
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		start := time.Now()
+		resp, err = p.doer.Do(r)
+		if req.Context().Err() != nil {
+			// cancelled request says nothing about the endpoint
+			return resp, err
+		}
+		if err == nil && !unavailable(resp.StatusCode) {
+			p.success(e, time.Since(start))
+			return resp, nil
+		}
+		if err == nil {
+			p.failure(e, fmt.Errorf("server unavailable: %s", resp.Status))
+		} else {
+			p.failure(e, err)
+		}
+		if !resendable || i == len(candidates)-1 {
+			break
+		}
+		log.Warnf("Request to %s failed, trying another endpoint", e.status.URL)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+	}
+	return resp, err
+}
+
+// unavailable returns true for status codes meaning the server cannot handle requests now
+func unavailable(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout
+}
+
+// candidates returns endpoints in the order of trying. Healthy endpoints are ordered by the strategy,
+// unhealthy ones follow from the longest unhealthy. Endpoints unhealthy for longer than the retry interval are considered healthy.
+func (p *EndpointPool) candidates() []*endpoint {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	healthy := make([]*endpoint, 0, len(p.endpoints))
+	var unhealthy []*endpoint
+	for _, e := range p.endpoints {
+		if e.status.Healthy || time.Since(e.unhealthySince) >= p.retryInterval {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+	switch p.strategy {
+	case EndpointRoundRobin:
+		if n := len(healthy); n > 1 {
+			start := int(p.next % uint32(n))
+			p.next++
+			rotated := make([]*endpoint, 0, len(p.endpoints))
+			rotated = append(rotated, healthy[start:]...)
+			healthy = append(rotated, healthy[:start]...)
+		}
+	case EndpointLeastLatency:
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].status.Latency < healthy[j].status.Latency
+		})
+	}
+	sort.SliceStable(unhealthy, func(i, j int) bool {
+		return unhealthy[i].unhealthySince.Before(unhealthy[j].unhealthySince)
+	})
+	return append(healthy, unhealthy...)
+}
+
+// redirect returns u created for the first server URL changed to the server URL of e
+func (p *EndpointPool) redirect(u *url.URL, e *endpoint) *url.URL {
+	first := p.endpoints[0].url
+	if e == p.endpoints[0] || u.Scheme != first.Scheme || u.Host != first.Host || !strings.HasPrefix(u.Path, first.Path) {
+		return u
+	}
+	r := *u
+	r.Scheme = e.url.Scheme
+	r.Host = e.url.Host
+	r.Path = e.url.Path + strings.TrimPrefix(u.Path, first.Path)
+	r.RawPath = ""
+	return &r
+}
+
+// success marks e healthy and updates its latency
+func (p *EndpointPool) success(e *endpoint, latency time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !e.status.Healthy {
+		log.Infof("Endpoint %s is healthy", e.status.URL)
+	}
+	e.status.Healthy = true
+	e.status.Failures = 0
+	e.status.LastError = nil
+	e.status.LastCheck = time.Now()
+	if e.status.Latency == 0 {
+		e.status.Latency = latency
+	} else {
+		e.status.Latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.status.Latency))
+	}
+}
+
+// failure marks e unhealthy because of err
+func (p *EndpointPool) failure(e *endpoint, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if e.status.Healthy {
+		log.Warnf("Endpoint %s is unhealthy: %s", e.status.URL, err.Error())
+	}
+	e.status.Healthy = false
+	e.status.Failures++
+	e.status.LastError = err
+	e.status.LastCheck = time.Now()
+	e.unhealthySince = e.status.LastCheck
+}
@@ -0,0 +1,150 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// node is a test server recording bodies of requests, which replies with status
+type node struct {
+	*httptest.Server
+	lock   sync.Mutex
+	status int
+	delay  time.Duration
+	bodies []string
+}
+
+func newNode(t *testing.T) *node {
+	n := &node{status: http.StatusNoContent}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n.lock.Lock()
+		n.bodies = append(n.bodies, r.URL.Path+" "+string(body))
+		status, delay := n.status, n.delay
+		n.lock.Unlock()
+		<-time.After(delay)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *node) set(status int, delay time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.status = status
+	n.delay = delay
+}
+
+func (n *node) requests() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.bodies
+}
+
+func TestNewEndpointPool(t *testing.T) {
+	_, err := NewEndpointPool(nil, DefaultOptions())
+	require.Error(t, err)
+	_, err = NewEndpointPool([]string{"http://localhost:8086", "localhost"}, DefaultOptions())
+	require.Error(t, err)
+	p, err := NewEndpointPool([]string{"http://localhost:8086/influx", "http://localhost:8087"}, DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:8086/influx/", p.ServerURL())
+	status := p.Status()
+	require.Len(t, status, 2)
+	assert.Equal(t, "http://localhost:8087/", status[1].URL)
+	assert.True(t, status[1].Healthy)
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	n1, n2 := newNode(t), newNode(t)
+	p, err := NewEndpointPool([]string{n1.URL, n2.URL + "/influx"}, DefaultOptions())
+	require.NoError(t, err)
+	srv := NewEndpointService(p, "Token my-token", DefaultOptions())
+	post := func(body string) *Error {
+		return srv.DoPostRequest(context.Background(), srv.ServerAPIURL()+"write", strings.NewReader(body), nil, nil)
+	}
+
+	require.Nil(t, post("a"))
+	n1.set(http.StatusServiceUnavailable, 0)
+	// redirected to n2 with the same body
+	require.Nil(t, post("b"))
+	require.Nil(t, post("c"))
+	assert.Equal(t, []string{"/api/v2/write a", "/api/v2/write b"}, n1.requests())
+	assert.Equal(t, []string{"/influx/api/v2/write b", "/influx/api/v2/write c"}, n2.requests())
+	status := p.Status()
+	assert.False(t, status[0].Healthy)
+	assert.Equal(t, 1, status[0].Failures)
+	assert.Error(t, status[0].LastError)
+	assert.True(t, status[1].Healthy)
+	assert.Greater(t, status[1].Latency, time.Duration(0))
+
+	// all endpoints fail, the response of the unhealthy endpoint tried last is returned
+	n2.set(http.StatusBadGateway, 0)
+	perr := post("d")
+	require.NotNil(t, perr)
+	assert.Equal(t, http.StatusServiceUnavailable, perr.StatusCode)
+
+	n1.set(http.StatusNoContent, 0)
+	status = p.CheckHealth(context.Background())
+	assert.True(t, status[0].Healthy)
+	assert.False(t, status[1].Healthy)
+	require.Nil(t, post("e"))
+	assert.Equal(t, "/api/v2/write e", n1.requests()[len(n1.requests())-1])
+}
+
+func TestEndpointPoolRetryInterval(t *testing.T) {
+	n1, n2 := newNode(t), newNode(t)
+	p, err := NewEndpointPool([]string{n1.URL, n2.URL}, DefaultOptions().SetEndpointRetryInterval(0))
+	require.NoError(t, err)
+	n1.set(http.StatusServiceUnavailable, 0)
+	srv := NewEndpointService(p, "", DefaultOptions())
+	require.Nil(t, srv.DoPostRequest(context.Background(), srv.ServerURL()+"ping", nil, nil, nil))
+	n1.set(http.StatusNoContent, 0)
+	// unhealthy endpoint is tried again immediately
+	require.Nil(t, srv.DoPostRequest(context.Background(), srv.ServerURL()+"ping", nil, nil, nil))
+	assert.Len(t, n1.requests(), 2)
+	assert.Len(t, n2.requests(), 1)
+	assert.True(t, p.Status()[0].Healthy)
+}
+
+func TestEndpointPoolRoundRobin(t *testing.T) {
+	nodes := []*node{newNode(t), newNode(t), newNode(t)}
+	p, err := NewEndpointPool([]string{nodes[0].URL, nodes[1].URL, nodes[2].URL}, DefaultOptions().SetEndpointStrategy(EndpointRoundRobin))
+	require.NoError(t, err)
+	srv := NewEndpointService(p, "", DefaultOptions())
+	for i := 0; i < 6; i++ {
+		require.Nil(t, srv.DoPostRequest(context.Background(), srv.ServerAPIURL()+"write", strings.NewReader("a"), nil, nil))
+	}
+	for _, n := range nodes {
+		assert.Len(t, n.requests(), 2)
+	}
+}
+
+func TestEndpointPoolLeastLatency(t *testing.T) {
+	n1, n2 := newNode(t), newNode(t)
+	n1.set(http.StatusNoContent, 50*time.Millisecond)
+	p, err := NewEndpointPool([]string{n1.URL, n2.URL}, DefaultOptions().SetEndpointStrategy(EndpointLeastLatency))
+	require.NoError(t, err)
+	status := p.CheckHealth(context.Background())
+	require.Greater(t, status[0].Latency, status[1].Latency)
+	srv := NewEndpointService(p, "", DefaultOptions())
+	for i := 0; i < 3; i++ {
+		require.Nil(t, srv.DoPostRequest(context.Background(), srv.ServerAPIURL()+"write", strings.NewReader("a"), nil, nil))
+	}
+	assert.Len(t, n1.requests(), 1)
+	assert.Len(t, n2.requests(), 4)
+}
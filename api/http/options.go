@@ -9,6 +9,8 @@ import (
 	"net"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Options holds http configuration properties for communicating with InfluxDB server
@@ -25,6 +27,14 @@ type Options struct {
 	httpRequestTimeout uint
 	// Application name in the User-Agent HTTP header string
 	appName string
+	// Notified about finished requests. Default nil
+	requestObserver RequestObserver
+	// Provider of tracer tracing requests. Default nil, requests are not traced
+	tracerProvider trace.TracerProvider
+	// Selection of endpoint of a client with multiple server URLs. Default EndpointFailover
+	endpointStrategy EndpointStrategy
+	// Interval in sec after which an unhealthy endpoint is tried again. Default 30
+	endpointRetryInterval uint
 }
 
 // HTTPClient returns the http.Client that is configured to be used
@@ -133,7 +143,56 @@ func (o *Options) SetApplicationName(appName string) *Options {
 	return o
 }
 
+// RequestObserver returns function notified about finished HTTP requests, or nil if not set
+func (o *Options) RequestObserver() RequestObserver {
+	return o.requestObserver
+}
+
+// SetRequestObserver sets function notified about each finished HTTP request sent by Service.
+// It must be set before the Service, or the client, is created.
+func (o *Options) SetRequestObserver(observer RequestObserver) *Options {
+	o.requestObserver = observer
+	return o
+}
+
+// TracerProvider returns provider of OpenTelemetry tracer tracing requests, or nil if not set
+func (o *Options) TracerProvider() trace.TracerProvider {
+	return o.tracerProvider
+}
+
+// SetTracerProvider sets provider of OpenTelemetry tracer creating a span for each HTTP request sent by Service.
+// W3C trace context of the span is injected into request headers.
+// Setting nil value (default) disables tracing. It must be set before the Service, or the client, is created.
+func (o *Options) SetTracerProvider(tracerProvider trace.TracerProvider) *Options {
+	o.tracerProvider = tracerProvider
+	return o
+}
+
+// EndpointStrategy returns strategy of selecting endpoint of a client with multiple server URLs
+func (o *Options) EndpointStrategy() EndpointStrategy {
+	return o.endpointStrategy
+}
+
+// SetEndpointStrategy sets strategy of selecting endpoint of a client with multiple server URLs.
+// It must be set before the client is created.
+func (o *Options) SetEndpointStrategy(strategy EndpointStrategy) *Options {
+	o.endpointStrategy = strategy
+	return o
+}
+
+// EndpointRetryInterval returns interval in sec after which an unhealthy endpoint is tried again
+func (o *Options) EndpointRetryInterval() uint {
+	return o.endpointRetryInterval
+}
+
+// SetEndpointRetryInterval sets interval in sec after which an unhealthy endpoint of a client with multiple server URLs
+// is tried again, unless it is found healthy by EndpointPool.CheckHealth sooner. It must be set before the client is created.
+func (o *Options) SetEndpointRetryInterval(endpointRetryInterval uint) *Options {
+	o.endpointRetryInterval = endpointRetryInterval
+	return o
+}
+
 // DefaultOptions returns Options object with default values
 func DefaultOptions() *Options {
-	return &Options{httpRequestTimeout: 20}
+	return &Options{httpRequestTimeout: 20, endpointRetryInterval: 30}
 }
@@ -13,6 +13,7 @@ import (
 
 	"github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestDefaultOptions(t *testing.T) {
@@ -25,6 +26,10 @@ func TestDefaultOptions(t *testing.T) {
 	require.True(t, ok)
 	assert.NotNil(t, transport.Proxy)
 	assert.EqualValues(t, "", opts.ApplicationName())
+	assert.Nil(t, opts.RequestObserver())
+	assert.Nil(t, opts.TracerProvider())
+	assert.Equal(t, http.EndpointFailover, opts.EndpointStrategy())
+	assert.EqualValues(t, 30, opts.EndpointRetryInterval())
 }
 
 func TestOptionsSetting(t *testing.T) {
@@ -34,9 +39,17 @@ func TestOptionsSetting(t *testing.T) {
 	opts := http.DefaultOptions().
 		SetTLSConfig(tlsConfig).
 		SetHTTPRequestTimeout(50).
-		SetApplicationName("Monitor/1.1")
+		SetApplicationName("Monitor/1.1").
+		SetRequestObserver(func(*nethttp.Request, *nethttp.Response, error, time.Duration) {}).
+		SetTracerProvider(trace.NewNoopTracerProvider()).
+		SetEndpointStrategy(http.EndpointRoundRobin).
+		SetEndpointRetryInterval(10)
 	assert.Equal(t, tlsConfig, opts.TLSConfig())
+	assert.NotNil(t, opts.RequestObserver())
+	assert.Equal(t, trace.NewNoopTracerProvider(), opts.TracerProvider())
 	assert.Equal(t, uint(50), opts.HTTPRequestTimeout())
+	assert.Equal(t, http.EndpointRoundRobin, opts.EndpointStrategy())
+	assert.EqualValues(t, 10, opts.EndpointRetryInterval())
 	assert.EqualValues(t, "Monitor/1.1", opts.ApplicationName())
 	if client := opts.HTTPClient(); assert.NotNil(t, client) {
 		assert.Equal(t, 50*time.Second, client.Timeout)
@@ -20,10 +20,18 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	http2 "github.com/influxdata/influxdb-client-go/v2/internal/http"
 	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // RequestCallback defines function called after a request is created before any call
@@ -32,6 +40,12 @@ type RequestCallback func(req *http.Request)
 // ResponseCallback defines function called after a successful response was received
 type ResponseCallback func(resp *http.Response) error
 
+// RequestObserver is called when an HTTP request sent by Service finishes, that is when the response body is closed,
+// or when the request fails. resp is nil if the request failed with err. duration is the time since sending the request,
+// so it includes reading of the response, such as query results.
+// It can be called concurrently.
+type RequestObserver func(req *http.Request, resp *http.Response, err error, duration time.Duration)
+
 // Service handles HTTP operations with taking care of mandatory request headers and known errors
 type Service interface {
 	// DoPostRequest sends HTTP POST request to the given url with body
@@ -57,10 +71,22 @@ type service struct {
 	authorization string
 	client        Doer
 	userAgent     string
+	observer      RequestObserver
+	tracer        trace.Tracer
 }
 
 // NewService creates instance of http Service with given parameters
 func NewService(serverURL, authorization string, httpOptions *Options) Service {
+	return newService(serverURL, authorization, httpOptions.HTTPDoer(), httpOptions)
+}
+
+// NewEndpointService creates instance of http Service sending requests to endpoints of pool.
+// Server URL of the service is the first server URL of pool.
+func NewEndpointService(pool *EndpointPool, authorization string, httpOptions *Options) Service {
+	return newService(pool.ServerURL(), authorization, pool, httpOptions)
+}
+
+func newService(serverURL, authorization string, doer Doer, httpOptions *Options) Service {
 	apiURL, err := url.Parse(serverURL)
 	serverAPIURL := serverURL
 	if err == nil {
@@ -73,8 +99,10 @@ func NewService(serverURL, authorization string, httpOptions *Options) Service {
 		serverAPIURL:  serverAPIURL,
 		serverURL:     serverURL,
 		authorization: authorization,
-		client:        httpOptions.HTTPDoer(),
+		client:        doer,
 		userAgent:     http2.FormatUserAgent(httpOptions.ApplicationName()),
+		observer:      httpOptions.RequestObserver(),
+		tracer:        http2.Tracer(httpOptions.TracerProvider()),
 	}
 }
 
@@ -135,7 +163,86 @@ func (s *service) DoHTTPRequestWithResponse(req *http.Request, requestCallback R
 	if requestCallback != nil {
 		requestCallback(req)
 	}
-	return s.client.Do(req)
+	if s.observer == nil && s.tracer == nil {
+		return s.client.Do(req)
+	}
+	var span trace.Span
+	if s.tracer != nil {
+		var ctx context.Context
+		ctx, span = s.tracer.Start(req.Context(), "influxdb "+Endpoint(req.URL), trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(http2.DBSystem, attribute.String("http.method", req.Method), attribute.String("http.url", req.URL.String())))
+		req = req.WithContext(ctx)
+		propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	}
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	finish := func() {
+		if s.observer != nil {
+			s.observer(req, resp, err, time.Since(start))
+		}
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			} else {
+				span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+				if resp.StatusCode >= 400 {
+					span.SetStatus(codes.Error, resp.Status)
+				}
+			}
+			span.End()
+		}
+	}
+	if err != nil {
+		finish()
+		return nil, err
+	}
+	resp.Body = &observedBody{ReadCloser: resp.Body, observe: finish}
+	return resp, nil
+}
+
+// idRegexp matches InfluxDB resource IDs
+var idRegexp = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// Endpoint returns path of u with InfluxDB resource IDs replaced by {id}.
+// It identifies the API endpoint called by a request with low cardinality.
+func Endpoint(u *url.URL) string {
+	parts := strings.Split(u.Path, "/")
+	for i, p := range parts {
+		if idRegexp.MatchString(p) {
+			parts[i] = "{id}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// observedBody is response body notifying RequestObserver and ending the request span when it is closed
+type observedBody struct {
+	io.ReadCloser
+	once    sync.Once
+	observe func()
+}
+
+// Close closes the body and finishes the request, only at the first call
+func (b *observedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.observe)
+	return err
+}
+
+// parseRetryAfter returns number of seconds from the Retry-After header value, which is either delay in seconds or HTTP date.
+// Invalid value or date in the past mean 0.
+func parseRetryAfter(v string) uint {
+	if r, err := strconv.ParseUint(v, 10, 32); err == nil {
+		return uint(r)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			// round up to whole seconds
+			return uint((d + time.Second - 1) / time.Second)
+		}
+	}
+	return 0
 }
 
 func (s *service) parseHTTPError(r *http.Response) *Error {
@@ -153,10 +260,7 @@ func (s *service) parseHTTPError(r *http.Response) *Error {
 	perror.StatusCode = r.StatusCode
 
 	if v := r.Header.Get("Retry-After"); v != "" {
-		r, err := strconv.ParseUint(v, 10, 32)
-		if err == nil {
-			perror.RetryAfter = uint(r)
-		}
+		perror.RetryAfter = parseRetryAfter(v)
 	}
 
 	// json encoded error
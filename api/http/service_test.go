@@ -5,9 +5,15 @@
 package http
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestService(t *testing.T) {
@@ -16,3 +22,42 @@ func TestService(t *testing.T) {
 	assert.Equal(t, "http://localhost:8086/aa/api/v2/", srv.ServerAPIURL())
 	assert.Equal(t, "Token my-token", srv.Authorization())
 }
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.EqualValues(t, 30, parseRetryAfter("30"))
+	assert.EqualValues(t, 0, parseRetryAfter("invalid"))
+	assert.EqualValues(t, 0, parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)))
+	assertBetween := func(v, min, max uint) {
+		assert.True(t, v >= min && v <= max, "%d is outside <%d;%d>", v, min, max)
+	}
+	assertBetween(parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)), 59, 60)
+}
+
+func TestRequestObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	var urls []string
+	var codes []int
+	var errs []error
+	opts := DefaultOptions().SetRequestObserver(func(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+		urls = append(urls, req.URL.Path)
+		if resp != nil {
+			codes = append(codes, resp.StatusCode)
+		}
+		errs = append(errs, err)
+		assert.True(t, duration > 0)
+	})
+	srv := NewService(server.URL+"/", "", opts)
+	require.Nil(t, srv.DoPostRequest(context.Background(), server.URL+"/api/v2/write", strings.NewReader("a f=1"), nil, func(resp *http.Response) error {
+		return resp.Body.Close()
+	}))
+	assert.Equal(t, []string{"/api/v2/write"}, urls)
+	assert.Equal(t, []int{204}, codes)
+
+	srv = NewService("http://localhost:1/", "", opts)
+	require.NotNil(t, srv.DoPostRequest(context.Background(), "http://localhost:1/api/v2/write", strings.NewReader("a f=1"), nil, nil))
+	assert.Len(t, urls, 2)
+	assert.Error(t, errs[1])
+}
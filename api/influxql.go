@@ -0,0 +1,460 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+	ilog "github.com/influxdata/influxdb-client-go/v2/log"
+)
+
+// InfluxQLFormat is the format of InfluxQL query response
+type InfluxQLFormat int
+
+const (
+	// InfluxQLFormatJSON requests response in the JSON format. Values are typed by JSON types and the time column is RFC3339 string.
+	// JSON doesn't distinguish integers from floats, so all numbers are reported as float64.
+	InfluxQLFormatJSON InfluxQLFormat = iota
+	// InfluxQLFormatCSV requests response in the CSV format. Values are typed by their text and the time column is Unix time in nanoseconds.
+	// CSV doesn't identify statements, so all series are reported as results of the statement 0.
+	InfluxQLFormatCSV
+)
+
+// InfluxQLQueryAPI provides methods for performing InfluxQL queries using the v1 compatible /query endpoint.
+// It works with InfluxDB 1.x as well as with InfluxDB 2.x, where database and retention policy are mapped to a bucket by DBRP mapping.
+type InfluxQLQueryAPI interface {
+	// Query executes InfluxQL query against database db and retention policy rp, which is empty for the default one, and returns complete result.
+	// Errors of particular statements are reported in the result.
+	Query(ctx context.Context, db, rp, query string) (*InfluxQLResult, error)
+	// QueryChunked executes InfluxQL query against database db and retention policy rp, which is empty for the default one, and returns streamed result.
+	// Server sends series in chunks of at most chunkSize rows. Zero chunkSize means the server default.
+	QueryChunked(ctx context.Context, db, rp, query string, chunkSize int) (*InfluxQLChunkedResult, error)
+}
+
+// NewInfluxQLQueryAPI returns new InfluxQL query client requesting responses in the format
+func NewInfluxQLQueryAPI(service http2.Service, format InfluxQLFormat) InfluxQLQueryAPI {
+	return &influxQLQueryAPI{
+		httpService: service,
+		format:      format,
+	}
+}
+
+// NewInfluxQLQueryAPIV1 returns new InfluxQL query client requesting responses in the format, which authenticates requests
+// by username and password of InfluxDB 1.x using basic authentication, instead of the authorization of service.
+func NewInfluxQLQueryAPIV1(username, password string, service http2.Service, format InfluxQLFormat) InfluxQLQueryAPI {
+	return &influxQLQueryAPI{
+		httpService: service,
+		format:      format,
+		username:    username,
+		password:    password,
+	}
+}
+
+// influxQLQueryAPI implements InfluxQLQueryAPI interface
+type influxQLQueryAPI struct {
+	httpService http2.Service
+	format      InfluxQLFormat
+	username    string
+	password    string
+}
+
+// InfluxQLResult holds results of all statements of InfluxQL query
+type InfluxQLResult struct {
+	Results []*InfluxQLStatementResult `json:"results"`
+	// Error is an error of the whole query
+	Error string `json:"error,omitempty"`
+}
+
+// InfluxQLStatementResult holds result of a single statement of InfluxQL query
+type InfluxQLStatementResult struct {
+	StatementID int                `json:"statement_id"`
+	Series      []*InfluxQLSeries  `json:"series,omitempty"`
+	Messages    []*InfluxQLMessage `json:"messages,omitempty"`
+	// Partial is true if more chunks with the result of the statement follow
+	Partial bool `json:"partial,omitempty"`
+	// Error is an error of the statement
+	Error string `json:"error,omitempty"`
+}
+
+// InfluxQLMessage is an informational message of a statement
+type InfluxQLMessage struct {
+	Level string `json:"level"`
+	Text  string `json:"text"`
+}
+
+// InfluxQLSeries holds rows of a series.
+// Values are string, float64, int64 (CSV format only), bool, time.Time for the time column or nil for no value.
+type InfluxQLSeries struct {
+	Name    string            `json:"name,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Columns []string          `json:"columns"`
+	Values  [][]interface{}   `json:"values,omitempty"`
+	// Partial is true if more chunks with rows of the series follow
+	Partial bool `json:"partial,omitempty"`
+}
+
+// ColumnIndex returns index of the column name, or -1 if there is no such column
+func (s *InfluxQLSeries) ColumnIndex(name string) int {
+	for i, c := range s.Columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *influxQLQueryAPI) Query(ctx context.Context, db, rp, query string) (*InfluxQLResult, error) {
+	chunks, err := q.query(ctx, db, rp, query, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := &InfluxQLResult{}
+	for chunks.Next() {
+		result.merge(chunks.Result())
+	}
+	if chunks.Err() != nil {
+		return nil, chunks.Err()
+	}
+	return result, nil
+}
+
+func (q *influxQLQueryAPI) QueryChunked(ctx context.Context, db, rp, query string, chunkSize int) (*InfluxQLChunkedResult, error) {
+	return q.query(ctx, db, rp, query, true, chunkSize)
+}
+
+func (q *influxQLQueryAPI) query(ctx context.Context, db, rp, query string, chunked bool, chunkSize int) (*InfluxQLChunkedResult, error) {
+	u, err := url.Parse(q.httpService.ServerURL())
+	if err != nil {
+		return nil, err
+	}
+	u, err = u.Parse("query")
+	if err != nil {
+		return nil, err
+	}
+	params := u.Query()
+	params.Set("db", db)
+	if rp != "" {
+		params.Set("rp", rp)
+	}
+	if chunked {
+		params.Set("chunked", "true")
+		if chunkSize > 0 {
+			params.Set("chunk_size", strconv.Itoa(chunkSize))
+		}
+	}
+	u.RawQuery = params.Encode()
+	if log.Level() >= ilog.DebugLevel {
+		log.Debugf("InfluxQL query: %s", query)
+	}
+	body := url.Values{"q": {query}}.Encode()
+	var result *InfluxQLChunkedResult
+	perror := q.httpService.DoPostRequest(ctx, u.String(), strings.NewReader(body), func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Accept-Encoding", "gzip")
+		if q.username != "" {
+			req.SetBasicAuth(q.username, q.password)
+		}
+		if q.format == InfluxQLFormatCSV {
+			req.Header.Set("Accept", "application/csv")
+		} else {
+			req.Header.Set("Accept", "application/json")
+		}
+	},
+		func(resp *http.Response) error {
+			if resp.Header.Get("Content-Encoding") == "gzip" {
+				resp.Body, err = gzip.NewReader(resp.Body)
+				if err != nil {
+					return err
+				}
+			}
+			result = newInfluxQLChunkedResult(resp.Body, q.format)
+			return nil
+		})
+	if perror != nil {
+		return nil, perror
+	}
+	return result, nil
+}
+
+// merge adds chunk of a statement result, rows of partial series are appended to the previous chunk
+func (r *InfluxQLResult) merge(chunk *InfluxQLStatementResult) {
+	var last *InfluxQLStatementResult
+	if len(r.Results) > 0 && r.Results[len(r.Results)-1].StatementID == chunk.StatementID {
+		last = r.Results[len(r.Results)-1]
+	}
+	if last == nil {
+		chunk.Partial = false
+		r.Results = append(r.Results, chunk)
+		for _, s := range chunk.Series {
+			s.Partial = false
+		}
+		return
+	}
+	last.Messages = append(last.Messages, chunk.Messages...)
+	if chunk.Error != "" {
+		last.Error = chunk.Error
+	}
+	for _, s := range chunk.Series {
+		if n := len(last.Series); n > 0 && last.Series[n-1].sameSeries(s) {
+			last.Series[n-1].Values = append(last.Series[n-1].Values, s.Values...)
+			continue
+		}
+		s.Partial = false
+		last.Series = append(last.Series, s)
+	}
+}
+
+// sameSeries returns true if s and o have the same name, tags and columns
+func (s *InfluxQLSeries) sameSeries(o *InfluxQLSeries) bool {
+	if s.Name != o.Name || len(s.Tags) != len(o.Tags) || len(s.Columns) != len(o.Columns) {
+		return false
+	}
+	for k, v := range s.Tags {
+		if ov, ok := o.Tags[k]; !ok || ov != v {
+			return false
+		}
+	}
+	for i, c := range s.Columns {
+		if o.Columns[i] != c {
+			return false
+		}
+	}
+	return true
+}
+
+// InfluxQLChunkedResult reads streamed InfluxQL query response.
+// Walking though the result is done by repeatedly calling Next() until returns false.
+// Each call provides a chunk of a statement result, available through Result().
+// Preliminary end can be caused by an error, so when Next() return false, check Err() for an error
+type InfluxQLChunkedResult struct {
+	body   io.ReadCloser
+	format InfluxQLFormat
+	// JSON format
+	decoder *json.Decoder
+	pending []*InfluxQLStatementResult
+	// CSV format
+	csvReader  *csv.Reader
+	csvColumns []string
+	pendingRow []string
+	result     *InfluxQLStatementResult
+	err        error
+	done       bool
+}
+
+// newInfluxQLChunkedResult returns new InfluxQLChunkedResult reading response in format
+func newInfluxQLChunkedResult(rawResponse io.ReadCloser, format InfluxQLFormat) *InfluxQLChunkedResult {
+	r := &InfluxQLChunkedResult{body: rawResponse, format: format}
+	if format == InfluxQLFormatCSV {
+		r.csvReader = csv.NewReader(rawResponse)
+		r.csvReader.FieldsPerRecord = -1
+	} else {
+		r.decoder = json.NewDecoder(rawResponse)
+		r.decoder.UseNumber()
+	}
+	return r
+}
+
+// Next advances to the next chunk of a statement result.
+// Returns false in case of end or an error, otherwise true
+func (r *InfluxQLChunkedResult) Next() bool {
+	r.result = nil
+	if r.done {
+		return false
+	}
+	var err error
+	if r.format == InfluxQLFormatCSV {
+		r.result, err = r.nextCSV()
+	} else {
+		r.result, err = r.nextJSON()
+	}
+	if err != nil || r.result == nil {
+		if err != io.EOF {
+			r.err = err
+		}
+		r.done = true
+		if cerr := r.Close(); cerr != nil && r.err == nil {
+			r.err = cerr
+		}
+		return false
+	}
+	return true
+}
+
+// Close reads remaining data and closes underlying response
+func (r *InfluxQLChunkedResult) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	_, _ = io.Copy(io.Discard, r.body)
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Result returns the actual chunk of a statement result
+func (r *InfluxQLChunkedResult) Result() *InfluxQLStatementResult {
+	return r.result
+}
+
+// Err returns an error raised during reading the response
+func (r *InfluxQLChunkedResult) Err() error {
+	return r.err
+}
+
+// nextJSON returns next statement result from JSON response
+func (r *InfluxQLChunkedResult) nextJSON() (*InfluxQLStatementResult, error) {
+	for len(r.pending) == 0 {
+		var resp InfluxQLResult
+		if err := r.decoder.Decode(&resp); err != nil {
+			return nil, err
+		}
+		if resp.Error != "" {
+			return nil, errors.New(resp.Error)
+		}
+		r.pending = resp.Results
+	}
+	res := r.pending[0]
+	r.pending = r.pending[1:]
+	for _, s := range res.Series {
+		if err := convertJSONValues(s); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// convertJSONValues converts JSON numbers to float64 and time column to time.Time.
+// Integral numbers are not converted to int64, so that values of a float column have the same type.
+func convertJSONValues(s *InfluxQLSeries) error {
+	timeCol := s.ColumnIndex("time")
+	for _, row := range s.Values {
+		for i, v := range row {
+			switch v := v.(type) {
+			case json.Number:
+				f, err := v.Float64()
+				if err != nil {
+					return err
+				}
+				row[i] = f
+			case string:
+				if i == timeCol {
+					t, err := time.Parse(time.RFC3339Nano, v)
+					if err != nil {
+						return err
+					}
+					row[i] = t
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// nextCSV returns next series from CSV response.
+// Rows are read until series name, tags or header change.
+func (r *InfluxQLChunkedResult) nextCSV() (*InfluxQLStatementResult, error) {
+	var series *InfluxQLSeries
+	var tags string
+	for {
+		row := r.pendingRow
+		r.pendingRow = nil
+		if row == nil {
+			var err error
+			row, err = r.csvReader.Read()
+			if err == io.EOF && series != nil {
+				return &InfluxQLStatementResult{Series: []*InfluxQLSeries{series}}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(row) >= 2 && row[0] == "name" && row[1] == "tags" {
+			if series != nil {
+				r.pendingRow = row
+				return &InfluxQLStatementResult{Series: []*InfluxQLSeries{series}}, nil
+			}
+			r.csvColumns = append(r.csvColumns[:0], row[2:]...)
+			continue
+		}
+		if r.csvColumns == nil {
+			return nil, errors.New("parsing error, header not found")
+		}
+		if len(row) != len(r.csvColumns)+2 {
+			return nil, fmt.Errorf("parsing error, row has different number of columns than the header: %d vs %d", len(row)-2, len(r.csvColumns))
+		}
+		if series != nil && (row[0] != series.Name || row[1] != tags) {
+			r.pendingRow = row
+			return &InfluxQLStatementResult{Series: []*InfluxQLSeries{series}}, nil
+		}
+		if series == nil {
+			tags = row[1]
+			series = &InfluxQLSeries{Name: row[0], Tags: parseCSVTags(tags), Columns: append([]string(nil), r.csvColumns...)}
+		}
+		values := make([]interface{}, len(r.csvColumns))
+		for i, v := range row[2:] {
+			if r.csvColumns[i] == "time" {
+				ns, err := strconv.ParseInt(v, 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				values[i] = time.Unix(0, ns).UTC()
+				continue
+			}
+			values[i] = parseCSVValue(v)
+		}
+		series.Values = append(series.Values, values)
+	}
+}
+
+// parseCSVTags parses tags in the form key1=value1,key2=value2
+func parseCSVTags(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if i := strings.IndexByte(pair, '='); i > 0 {
+			tags[pair[:i]] = pair[i+1:]
+		}
+	}
+	return tags
+}
+
+// parseCSVValue converts CSV value to int64, float64, bool or string according to its text
+func parseCSVValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	// avoid parsing strings like NaN or Inf as numbers
+	if c := s[0]; c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+		return s
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
@@ -0,0 +1,169 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func influxQLServer(t *testing.T, contentType, response string, check func(r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/query", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		if check != nil {
+			check(r)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(response))
+	}))
+}
+
+func TestInfluxQLQueryJSON(t *testing.T) {
+	response := `{"results":[{"statement_id":0,"series":[{"name":"cpu","tags":{"host":"a"},"columns":["time","usage","count","ok","note"],"values":[["2020-02-18T10:34:08.135814545Z",1.5,10,true,"x"],["2020-02-18T10:35:08Z",2,null,false,"y"]]}]},{"statement_id":1,"error":"measurement not found"}]}`
+	server := influxQLServer(t, "application/json", response, func(r *http.Request) {
+		assert.Equal(t, "my-db", r.URL.Query().Get("db"))
+		assert.Equal(t, "autogen", r.URL.Query().Get("rp"))
+		assert.Equal(t, "", r.URL.Query().Get("chunked"))
+		assert.Equal(t, "SELECT * FROM cpu; SELECT * FROM mem", r.PostForm.Get("q"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+	})
+	defer server.Close()
+
+	queryAPI := NewInfluxQLQueryAPI(http2.NewService(server.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatJSON)
+	result, err := queryAPI.Query(context.Background(), "my-db", "autogen", "SELECT * FROM cpu; SELECT * FROM mem")
+	require.NoError(t, err)
+	require.Len(t, result.Results, 2)
+	require.Len(t, result.Results[0].Series, 1)
+	series := result.Results[0].Series[0]
+	assert.Equal(t, "cpu", series.Name)
+	assert.Equal(t, map[string]string{"host": "a"}, series.Tags)
+	assert.Equal(t, 2, series.ColumnIndex("count"))
+	assert.Equal(t, -1, series.ColumnIndex("missing"))
+	require.Len(t, series.Values, 2)
+	assert.Equal(t, []interface{}{mustParseTime("2020-02-18T10:34:08.135814545Z"), 1.5, 10.0, true, "x"}, series.Values[0])
+	assert.Equal(t, []interface{}{mustParseTime("2020-02-18T10:35:08Z"), 2.0, nil, false, "y"}, series.Values[1])
+	assert.Equal(t, 1, result.Results[1].StatementID)
+	assert.Equal(t, "measurement not found", result.Results[1].Error)
+}
+
+func TestInfluxQLQueryChunked(t *testing.T) {
+	response := `{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","usage"],"values":[["2020-02-18T10:34:08Z",1]],"partial":true}],"partial":true}]}
+{"results":[{"statement_id":0,"series":[{"name":"cpu","columns":["time","usage"],"values":[["2020-02-18T10:35:08Z",2]]}],"partial":true}]}
+{"results":[{"statement_id":0,"series":[{"name":"mem","columns":["time","free"],"values":[["2020-02-18T10:35:08Z",3]]}]}]}
+`
+	var params url.Values
+	server := influxQLServer(t, "application/json", response, func(r *http.Request) {
+		params = r.URL.Query()
+	})
+	defer server.Close()
+	queryAPI := NewInfluxQLQueryAPI(http2.NewService(server.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatJSON)
+
+	chunks, err := queryAPI.QueryChunked(context.Background(), "my-db", "", "SELECT * FROM cpu, mem", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "true", params.Get("chunked"))
+	assert.Equal(t, "1", params.Get("chunk_size"))
+	assert.Equal(t, "", params.Get("rp"))
+	var rows []float64
+	var partial []bool
+	for chunks.Next() {
+		for _, s := range chunks.Result().Series {
+			rows = append(rows, s.Values[0][1].(float64))
+			partial = append(partial, s.Partial)
+		}
+	}
+	require.NoError(t, chunks.Err())
+	assert.Equal(t, []float64{1, 2, 3}, rows)
+	assert.Equal(t, []bool{true, false, false}, partial)
+
+	// complete result merges chunks
+	result, err := queryAPI.Query(context.Background(), "my-db", "", "SELECT * FROM cpu, mem")
+	require.NoError(t, err)
+	require.Len(t, result.Results, 1)
+	require.Len(t, result.Results[0].Series, 2)
+	assert.Len(t, result.Results[0].Series[0].Values, 2)
+	assert.False(t, result.Results[0].Series[0].Partial)
+	assert.Equal(t, "mem", result.Results[0].Series[1].Name)
+}
+
+func TestInfluxQLQueryCSV(t *testing.T) {
+	response := "name,tags,time,usage,note,ok\r\n" +
+		"cpu,\"host=a,region=us\",1582022048135814545,1.5,x,true\r\n" +
+		"cpu,\"host=a,region=us\",1582022108000000000,2,,false\r\n" +
+		"cpu,\"host=b,region=us\",1582022048000000000,3,NaN,true\r\n" +
+		"name,tags,time,free\r\n" +
+		"mem,,1582022048000000000,100\r\n"
+	server := influxQLServer(t, "application/csv", response, func(r *http.Request) {
+		assert.Equal(t, "application/csv", r.Header.Get("Accept"))
+	})
+	defer server.Close()
+	queryAPI := NewInfluxQLQueryAPI(http2.NewService(server.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatCSV)
+
+	result, err := queryAPI.Query(context.Background(), "my-db", "", "SELECT * FROM cpu GROUP BY host; SELECT * FROM mem")
+	require.NoError(t, err)
+	require.Len(t, result.Results, 1)
+	series := result.Results[0].Series
+	require.Len(t, series, 3)
+	assert.Equal(t, map[string]string{"host": "a", "region": "us"}, series[0].Tags)
+	assert.Equal(t, []string{"time", "usage", "note", "ok"}, series[0].Columns)
+	assert.Equal(t, []interface{}{time.Unix(0, 1582022048135814545).UTC(), 1.5, "x", true}, series[0].Values[0])
+	assert.Equal(t, []interface{}{time.Unix(0, 1582022108000000000).UTC(), int64(2), nil, false}, series[0].Values[1])
+	assert.Equal(t, "b", series[1].Tags["host"])
+	assert.Equal(t, "NaN", series[1].Values[0][2])
+	assert.Equal(t, "mem", series[2].Name)
+	assert.Nil(t, series[2].Tags)
+	assert.Equal(t, []string{"time", "free"}, series[2].Columns)
+	assert.Equal(t, int64(100), series[2].Values[0][1])
+}
+
+func TestInfluxQLQueryErrors(t *testing.T) {
+	server := influxQLServer(t, "application/json", `{"error":"error parsing query: found EOF"}`, nil)
+	defer server.Close()
+	queryAPI := NewInfluxQLQueryAPI(http2.NewService(server.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatJSON)
+	_, err := queryAPI.Query(context.Background(), "my-db", "", "SELECT")
+	assert.EqualError(t, err, "error parsing query: found EOF")
+
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Influxdb-Error", "database not found: my-db")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = io.WriteString(w, `{"error":"database not found: my-db"}`)
+	}))
+	defer server2.Close()
+	queryAPI = NewInfluxQLQueryAPI(http2.NewService(server2.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatJSON)
+	_, err = queryAPI.Query(context.Background(), "my-db", "", "SELECT * FROM cpu")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "database not found: my-db")
+
+	server3 := influxQLServer(t, "application/csv", "cpu,,1,2\r\n", nil)
+	defer server3.Close()
+	queryAPI = NewInfluxQLQueryAPI(http2.NewService(server3.URL+"/", "", http2.DefaultOptions()), InfluxQLFormatCSV)
+	_, err = queryAPI.Query(context.Background(), "my-db", "", "SELECT * FROM cpu")
+	assert.EqualError(t, err, "parsing error, header not found")
+}
+
+func TestInfluxQLQueryV1Auth(t *testing.T) {
+	server := influxQLServer(t, "application/json", `{"results":[{"statement_id":0}]}`, func(r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+	})
+	defer server.Close()
+	queryAPI := NewInfluxQLQueryAPIV1("user", "pass", http2.NewService(server.URL+"/", "my-token", http2.DefaultOptions()), InfluxQLFormatJSON)
+	result, err := queryAPI.Query(context.Background(), "my-db", "", "SHOW MEASUREMENTS")
+	require.NoError(t, err)
+	assert.Len(t, result.Results, 1)
+}
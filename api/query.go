@@ -8,7 +8,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -18,10 +17,7 @@ import (
 	"net/url"
 	"path"
 	"reflect"
-	"strconv"
-	"strings"
 	"sync"
-	"time"
 
 	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/influxdata/influxdb-client-go/v2/api/query"
@@ -84,7 +80,8 @@ func NewQueryAPI(org string, service http2.Service) QueryAPI {
 // QueryTableResult parses streamed flux query response into structures representing flux table parts
 // Walking though the result is done by repeatedly calling Next() until returns false.
 // Actual flux table info (columns with names, data types, etc) is returned by TableMetadata() method.
-// Data are acquired by Record() method.
+// Data are acquired by Record() method, or without allocations by typed accessors, e.g. Float64(), Time() or String(),
+// which take index of the column in the actual table.
 // Preliminary end can be caused by an error, so when Next() return false, check Err() for an error
 type QueryTableResult struct {
 	io.Closer
@@ -92,14 +89,19 @@ type QueryTableResult struct {
 	tablePosition int
 	tableChanged  bool
 	table         *query.FluxTableMetadata
-	record        *query.FluxRecord
-	err           error
+	// parsed values of the actual row, reused for all rows of a table
+	values []columnValue
+	hasRow bool
+	// record is created from values on demand
+	record *query.FluxRecord
+	err    error
 }
 
 // NewQueryTableResult returns new QueryTableResult
 func NewQueryTableResult(rawResponse io.ReadCloser) *QueryTableResult {
 	csvReader := csv.NewReader(rawResponse)
 	csvReader.FieldsPerRecord = -1
+	csvReader.ReuseRecord = true
 	return &QueryTableResult{Closer: rawResponse, csvReader: csvReader}
 }
 
@@ -218,9 +220,7 @@ func (q *queryAPI) QueryWithParams(ctx context.Context, query string, params int
 					return err
 				}
 			}
-			csvReader := csv.NewReader(resp.Body)
-			csvReader.FieldsPerRecord = -1
-			queryResult = &QueryTableResult{Closer: resp.Body, csvReader: csvReader}
+			queryResult = NewQueryTableResult(resp.Body)
 			return nil
 		})
 	if perror != nil {
@@ -317,8 +317,12 @@ func (q *QueryTableResult) TableChanged() bool {
 }
 
 // Record returns last parsed flux table data row
-// Use Record methods to access value and row properties
+// Use Record methods to access value and row properties.
+// The record is created on the first call for the actual row, prefer typed accessors when reading many rows.
 func (q *QueryTableResult) Record() *query.FluxRecord {
+	if q.record == nil && q.hasRow {
+		q.record = q.newRecord()
+	}
 	return q.record
 }
 
@@ -404,6 +408,7 @@ readRow:
 						q.table.Column(i).SetName(n)
 					}
 				}
+				q.prepareValues()
 				parsingState = parsingStateNormal
 			}
 			goto readRow
@@ -421,16 +426,12 @@ readRow:
 			q.err = fmt.Errorf("%s%s", message, reference)
 			return false
 		}
-		values := make(map[string]interface{})
-		for i, v := range row[1:] {
-			if q.table.Column(i) != nil {
-				values[q.table.Column(i).Name()], q.err = toValue(stringTernary(v, q.table.Column(i).DefaultValue()), q.table.Column(i).DataType(), q.table.Column(i).Name())
-				if q.err != nil {
-					return false
-				}
-			}
+		q.record = nil
+		q.hasRow = false
+		if q.err = q.parseRow(row[1:]); q.err != nil {
+			return false
 		}
-		q.record = query.NewFluxRecord(q.table.Position(), values)
+		q.hasRow = true
 	case "#datatype":
 		dataTypeAnnotationFound = true
 		for i, d := range row[1:] {
@@ -472,43 +473,3 @@ func (q *QueryTableResult) Close() error {
 	}
 	return q.Closer.Close()
 }
-
-// stringTernary returns a if not empty, otherwise b
-func stringTernary(a, b string) string {
-	if a == "" {
-		return b
-	}
-	return a
-}
-
-// toValues converts s into type by t
-func toValue(s, t, name string) (interface{}, error) {
-	if s == "" {
-		return nil, nil
-	}
-	switch t {
-	case stringDatatype:
-		return s, nil
-	case timeDatatypeRFC:
-		return time.Parse(time.RFC3339, s)
-	case timeDatatypeRFCNano:
-		return time.Parse(time.RFC3339Nano, s)
-	case durationDatatype:
-		return time.ParseDuration(s)
-	case doubleDatatype:
-		return strconv.ParseFloat(s, 64)
-	case boolDatatype:
-		if strings.ToLower(s) == "false" {
-			return false, nil
-		}
-		return true, nil
-	case longDatatype:
-		return strconv.ParseInt(s, 10, 64)
-	case uLongDatatype:
-		return strconv.ParseUint(s, 10, 64)
-	case base64BinaryDataType:
-		return base64.StdEncoding.DecodeString(s)
-	default:
-		return nil, fmt.Errorf("%s has unknown data type %s", name, t)
-	}
-}
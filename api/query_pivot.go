@@ -0,0 +1,174 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+// PivotedTableResult iterates over rows of a flux query result, where each row holds values of all fields of a series at a single time.
+// It performs the same transformation as the flux pivot(rowKey:["_time"], columnKey: ["_field"], valueColumn: "_value") function, but on the client side.
+//
+// Rows are merged from records of the tables, which have the same group key except for the _field column.
+// A record of the row contains the group key columns, _time column and for each field a column named by the field with its value.
+// Other columns are taken from the first record of the row.
+//
+// Tables with the same group key, except for the _field column, are expected to follow each other, as the flux tables are sorted by group key.
+// Only rows of a single series are buffered in memory.
+// Tables without _field column are considered as already pivoted and their records are returned unchanged.
+type PivotedTableResult struct {
+	result *QueryTableResult
+	// group columns of the actual table, except for _field
+	groupColumns []string
+	// whether the actual table has the _field column
+	hasField  bool
+	seriesKey string
+	// rows of the actual series
+	rows    map[int64]*query.FluxRecord
+	pending []*query.FluxRecord
+	record  *query.FluxRecord
+	done    bool
+}
+
+// Pivot returns PivotedTableResult reading the remaining records of q
+func (q *QueryTableResult) Pivot() *PivotedTableResult {
+	return &PivotedTableResult{result: q}
+}
+
+// Next advances to the next pivoted row.
+// Actual row is available through Record() function.
+// Returns false in case of end or an error, otherwise true
+func (p *PivotedTableResult) Next() bool {
+	for len(p.pending) == 0 {
+		if p.done {
+			p.record = nil
+			return false
+		}
+		p.read()
+	}
+	p.record = p.pending[0]
+	p.pending[0] = nil
+	p.pending = p.pending[1:]
+	return true
+}
+
+// read reads records until a series is complete
+func (p *PivotedTableResult) read() {
+	for p.result.Next() {
+		rec := p.result.Record()
+		if p.result.TableChanged() {
+			p.tableChanged(p.result.TableMetadata())
+		}
+		if !p.hasField {
+			p.flush()
+			p.pending = append(p.pending, rec)
+			return
+		}
+		key := p.key(rec)
+		if p.rows != nil && key != p.seriesKey {
+			p.flush()
+			p.add(key, rec)
+			return
+		}
+		p.add(key, rec)
+	}
+	p.done = true
+	p.flush()
+}
+
+func (p *PivotedTableResult) tableChanged(table *query.FluxTableMetadata) {
+	p.groupColumns = p.groupColumns[:0]
+	p.hasField = false
+	for _, c := range table.Columns() {
+		if c.Name() == "_field" {
+			p.hasField = true
+		} else if c.IsGroup() {
+			p.groupColumns = append(p.groupColumns, c.Name())
+		}
+	}
+}
+
+// key creates series key of record from group columns
+func (p *PivotedTableResult) key(rec *query.FluxRecord) string {
+	var b strings.Builder
+	b.WriteString(rec.Result())
+	for _, c := range p.groupColumns {
+		b.WriteByte(0)
+		b.WriteString(c)
+		b.WriteByte('=')
+		b.WriteString(fmt.Sprint(rec.ValueByKey(c)))
+	}
+	return b.String()
+}
+
+// add merges record to the row of the actual series
+func (p *PivotedTableResult) add(key string, rec *query.FluxRecord) {
+	if p.rows == nil {
+		p.rows = make(map[int64]*query.FluxRecord)
+		p.seriesKey = key
+	}
+	var ts int64
+	if t, ok := rec.ValueByKey("_time").(time.Time); ok {
+		ts = t.UnixNano()
+	}
+	row, ok := p.rows[ts]
+	if !ok {
+		values := make(map[string]interface{}, len(rec.Values()))
+		for k, v := range rec.Values() {
+			if k != "_field" && k != "_value" {
+				values[k] = v
+			}
+		}
+		row = query.NewFluxRecord(p.result.TablePosition(), values)
+		p.rows[ts] = row
+	}
+	row.Values()[rec.Field()] = rec.Value()
+}
+
+// flush moves rows of the actual series, sorted by time, to pending rows
+func (p *PivotedTableResult) flush() {
+	if p.rows == nil {
+		return
+	}
+	times := make([]int64, 0, len(p.rows))
+	for ts := range p.rows {
+		times = append(times, ts)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	for _, ts := range times {
+		p.pending = append(p.pending, p.rows[ts])
+	}
+	p.rows = nil
+}
+
+// Record returns the actual pivoted row
+func (p *PivotedTableResult) Record() *query.FluxRecord {
+	return p.record
+}
+
+// Decode decodes the actual row into a custom structure pointed by x.
+// See RecordToData for details about mapping of the record columns to struct fields.
+func (p *PivotedTableResult) Decode(x interface{}) error {
+	if p.record == nil {
+		return errors.New("no record to decode, call Next() first")
+	}
+	return RecordToData(p.record, x)
+}
+
+// Err returns an error raised during flux query response parsing
+func (p *PivotedTableResult) Err() error {
+	return p.result.Err()
+}
+
+// Close reads remaining data and closes underlying query result
+func (p *PivotedTableResult) Close() error {
+	return p.result.Close()
+}
@@ -0,0 +1,102 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPivotedTableResult(t *testing.T) {
+	csvTable := `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string
+#group,false,false,true,true,false,false,true,true,true
+#default,_result,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,sensor
+,,0,2020-02-17T00:00:00Z,2020-02-19T00:00:00Z,2020-02-18T10:00:00Z,23.5,temp,air,s1
+,,0,2020-02-17T00:00:00Z,2020-02-19T00:00:00Z,2020-02-18T11:00:00Z,24.5,temp,air,s1
+
+#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,long,string,string,string
+#group,false,false,true,true,false,false,true,true,true
+#default,_result,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,sensor
+,,1,2020-02-17T00:00:00Z,2020-02-19T00:00:00Z,2020-02-18T09:00:00Z,50,hum,air,s1
+,,1,2020-02-17T00:00:00Z,2020-02-19T00:00:00Z,2020-02-18T10:00:00Z,55,hum,air,s1
+
+#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string
+#group,false,false,true,true,false,false,true,true,true
+#default,_result,,,,,,,,
+,result,table,_start,_stop,_time,_value,_field,_measurement,sensor
+,,2,2020-02-17T00:00:00Z,2020-02-19T00:00:00Z,2020-02-18T10:00:00Z,20.1,temp,air,s2
+
+#datatype,string,long,dateTime:RFC3339,string
+#group,false,false,false,true
+#default,_result,,,
+,result,table,_time,host
+,,3,2020-02-18T10:00:00Z,h1
+
+`
+	result := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable))).Pivot()
+	start := mustParseTime("2020-02-17T00:00:00Z")
+	stop := mustParseTime("2020-02-19T00:00:00Z")
+	row := func(table int, ts string, sensor string, fields map[string]interface{}) *query.FluxRecord {
+		values := map[string]interface{}{
+			"result":       "_result",
+			"table":        int64(table),
+			"_start":       start,
+			"_stop":        stop,
+			"_time":        mustParseTime(ts),
+			"_measurement": "air",
+			"sensor":       sensor,
+		}
+		for k, v := range fields {
+			values[k] = v
+		}
+		return query.NewFluxRecord(table, values)
+	}
+	expected := []*query.FluxRecord{
+		row(1, "2020-02-18T09:00:00Z", "s1", map[string]interface{}{"hum": int64(50)}),
+		row(0, "2020-02-18T10:00:00Z", "s1", map[string]interface{}{"temp": 23.5, "hum": int64(55)}),
+		row(0, "2020-02-18T11:00:00Z", "s1", map[string]interface{}{"temp": 24.5}),
+		row(2, "2020-02-18T10:00:00Z", "s2", map[string]interface{}{"temp": 20.1}),
+		query.NewFluxRecord(3, map[string]interface{}{
+			"result": "_result",
+			"table":  int64(3),
+			"_time":  mustParseTime("2020-02-18T10:00:00Z"),
+			"host":   "h1",
+		}),
+	}
+	for i, e := range expected {
+		require.True(t, result.Next(), "row %d: %v", i, result.Err())
+		assert.Equal(t, e, result.Record(), "row %d", i)
+	}
+	var s struct {
+		Host string    `lp:"tag,host"`
+		Time time.Time `lp:"timestamp"`
+	}
+	require.NoError(t, result.Decode(&s))
+	assert.Equal(t, "h1", s.Host)
+	assert.False(t, result.Next())
+	assert.Nil(t, result.Record())
+	assert.NoError(t, result.Err())
+	assert.Error(t, result.Decode(&s))
+}
+
+func TestPivotedTableResultError(t *testing.T) {
+	csvTable := `#datatype,string,string
+#group,true,true
+#default,,
+,error,reference
+,failed to create physical plan: invalid time bounds from procedure from: bounds contain zero time,897`
+	result := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable))).Pivot()
+	assert.False(t, result.Next())
+	require.Error(t, result.Err())
+	assert.Equal(t, "failed to create physical plan: invalid time bounds from procedure from: bounds contain zero time,897", result.Err().Error())
+}
@@ -104,8 +104,7 @@ func TestQueryCVSResultSingleTable(t *testing.T) {
 	require.Nil(t, queryResult.Err())
 }
 
-func TestQueryCVSResultMultiTables(t *testing.T) {
-	csvTable := `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string,string
+const multiTablesCSV = `#datatype,string,long,dateTime:RFC3339,dateTime:RFC3339,dateTime:RFC3339,double,string,string,string,string
 #group,false,false,true,true,false,false,true,true,true,true
 #default,_result1,,,,,,,,,
 ,result,table,_start,_stop,_time,_value,_field,_measurement,a,b
@@ -134,6 +133,9 @@ func TestQueryCVSResultMultiTables(t *testing.T) {
 ,,3,2020-02-17T22:19:49.747562847Z,2020-02-18T22:19:49.747562847Z,2020-02-18T22:08:44.969100374Z,2,i,test,0,adsfasdf
 
 `
+
+func TestQueryCVSResultMultiTables(t *testing.T) {
+	csvTable := multiTablesCSV
 	expectedTable1 := query.NewFluxTableMetadataFull(0,
 		[]*query.FluxColumn{
 			query.NewFluxColumnFull("string", "_result1", "result", false, 0),
@@ -1066,3 +1068,95 @@ func makeCSVstring(rows []string) string {
 	csvTable := strings.Join(rows, "\r\n")
 	return fmt.Sprintf("%s\r\n", csvTable)
 }
+
+func TestQueryTableResultTypedAccessors(t *testing.T) {
+	csvTable := `#datatype,string,long,dateTime:RFC3339,double,unsignedLong,boolean,duration,base64Binary,string
+#group,false,false,false,false,false,false,false,false,true
+#default,_result,,,,,,,,
+,result,table,_time,_value,count,ok,elapsed,note,sensor
+,,0,2020-04-28T12:38:11.480545389Z,1.5,10,true,1m1s,ZGF0YWluYmFzZTY0,BME280
+,,0,2020-04-28T12:39:11.480545389Z,,11,false,2s,eHh4eHhjY2NjY2NkZGRkZA==,
+`
+	queryResult := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable)))
+	require.True(t, queryResult.Next(), queryResult.Err())
+	assert.Equal(t, 3, queryResult.ColumnIndex("_value"))
+	assert.Equal(t, -1, queryResult.ColumnIndex("missing"))
+
+	assert.Equal(t, "_result", queryResult.String(0))
+	assert.Equal(t, int64(0), queryResult.Int64(1))
+	assert.Equal(t, mustParseTime("2020-04-28T12:38:11.480545389Z"), queryResult.Time(2))
+	assert.Equal(t, 1.5, queryResult.Float64(3))
+	assert.Equal(t, uint64(10), queryResult.Uint64(4))
+	assert.Equal(t, 10.0, queryResult.Float64(4))
+	assert.True(t, queryResult.Bool(5))
+	assert.Equal(t, time.Minute+time.Second, queryResult.Duration(6))
+	assert.Equal(t, []byte("datainbase64"), queryResult.Bytes(7))
+	assert.Equal(t, "BME280", queryResult.String(8))
+	assert.Equal(t, "1.5", queryResult.String(3))
+
+	// type mismatch and invalid index
+	assert.Equal(t, 0.0, queryResult.Float64(0))
+	assert.True(t, queryResult.Time(3).IsZero())
+	assert.Equal(t, "", queryResult.String(20))
+	assert.True(t, queryResult.IsNull(-1))
+
+	require.True(t, queryResult.Next(), queryResult.Err())
+	assert.True(t, queryResult.IsNull(3))
+	assert.Equal(t, 0.0, queryResult.Float64(3))
+	assert.False(t, queryResult.Bool(5))
+	assert.Equal(t, []byte("xxxxxccccccddddd"), queryResult.Bytes(7))
+	assert.True(t, queryResult.IsNull(8))
+
+	// compatibility record
+	record := queryResult.Record()
+	require.NotNil(t, record)
+	assert.Nil(t, record.Value())
+	assert.Equal(t, uint64(11), record.ValueByKey("count"))
+	assert.Equal(t, 2*time.Second, record.ValueByKey("elapsed"))
+	assert.Equal(t, []byte("xxxxxccccccddddd"), record.ValueByKey("note"))
+	assert.Same(t, record, queryResult.Record())
+
+	require.False(t, queryResult.Next())
+	require.NoError(t, queryResult.Err())
+}
+
+// benchmarkQueryCSV returns multiTablesCSV with tables repeated n times
+func benchmarkQueryCSV(n int) string {
+	return strings.Repeat(multiTablesCSV, n)
+}
+
+func BenchmarkQueryTableResultRecord(b *testing.B) {
+	csvTable := benchmarkQueryCSV(100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		queryResult := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable)))
+		for queryResult.Next() {
+			_ = queryResult.Record().Value()
+		}
+		if queryResult.Err() != nil {
+			b.Fatal(queryResult.Err())
+		}
+	}
+}
+
+func BenchmarkQueryTableResultTyped(b *testing.B) {
+	csvTable := benchmarkQueryCSV(100)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		queryResult := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable)))
+		var timeCol, valueCol int
+		for queryResult.Next() {
+			if queryResult.TableChanged() {
+				timeCol = queryResult.ColumnIndex("_time")
+				valueCol = queryResult.ColumnIndex("_value")
+			}
+			_ = queryResult.Time(timeCol)
+			_ = queryResult.Float64(valueCol)
+		}
+		if queryResult.Err() != nil {
+			b.Fatal(queryResult.Err())
+		}
+	}
+}
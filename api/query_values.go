@@ -0,0 +1,274 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+// columnType is parsed flux data type of a column
+type columnType int
+
+const (
+	columnTypeUnknown columnType = iota
+	columnTypeString
+	columnTypeDouble
+	columnTypeBool
+	columnTypeLong
+	columnTypeULong
+	columnTypeDuration
+	columnTypeBase64Binary
+	columnTypeTimeRFC
+	columnTypeTimeRFCNano
+)
+
+func toColumnType(t string) columnType {
+	switch t {
+	case stringDatatype:
+		return columnTypeString
+	case doubleDatatype:
+		return columnTypeDouble
+	case boolDatatype:
+		return columnTypeBool
+	case longDatatype:
+		return columnTypeLong
+	case uLongDatatype:
+		return columnTypeULong
+	case durationDatatype:
+		return columnTypeDuration
+	case base64BinaryDataType:
+		return columnTypeBase64Binary
+	case timeDatatypeRFC:
+		return columnTypeTimeRFC
+	case timeDatatypeRFCNano:
+		return columnTypeTimeRFCNano
+	default:
+		return columnTypeUnknown
+	}
+}
+
+// columnValue holds parsed value of a column of the actual row.
+// Only the field matching the column type is set.
+type columnValue struct {
+	column *query.FluxColumn
+	typ    columnType
+	// unparsed value, or the column default value
+	raw  string
+	null bool
+	f    float64
+	// long value or duration in nanoseconds
+	i     int64
+	u     uint64
+	b     bool
+	t     time.Time
+	bytes []byte
+}
+
+// zeroValue is returned by the typed accessors for an invalid column index
+var zeroValue = columnValue{null: true}
+
+// prepareValues prepares parsed values for columns of a new table
+func (q *QueryTableResult) prepareValues() {
+	columns := q.table.Columns()
+	if cap(q.values) < len(columns) {
+		q.values = make([]columnValue, len(columns))
+	}
+	q.values = q.values[:len(columns)]
+	for i, c := range columns {
+		q.values[i] = columnValue{column: c, typ: toColumnType(c.DataType()), bytes: q.values[i].bytes[:0]}
+	}
+}
+
+// parseRow parses values of a table row, without the leading annotation column, into the actual values
+func (q *QueryTableResult) parseRow(row []string) error {
+	for i, s := range row {
+		v := &q.values[i]
+		if s == "" {
+			s = v.column.DefaultValue()
+		}
+		v.raw = s
+		v.null = s == ""
+		if v.null {
+			continue
+		}
+		var err error
+		switch v.typ {
+		case columnTypeString:
+		case columnTypeDouble:
+			v.f, err = strconv.ParseFloat(s, 64)
+		case columnTypeBool:
+			v.b = strings.ToLower(s) != "false"
+		case columnTypeLong:
+			v.i, err = strconv.ParseInt(s, 10, 64)
+		case columnTypeULong:
+			v.u, err = strconv.ParseUint(s, 10, 64)
+		case columnTypeDuration:
+			var d time.Duration
+			d, err = time.ParseDuration(s)
+			v.i = int64(d)
+		case columnTypeBase64Binary:
+			var n int
+			v.bytes = growBytes(v.bytes, base64.StdEncoding.DecodedLen(len(s)))
+			n, err = base64.StdEncoding.Decode(v.bytes, []byte(s))
+			v.bytes = v.bytes[:n]
+		case columnTypeTimeRFC:
+			v.t, err = time.Parse(time.RFC3339, s)
+		case columnTypeTimeRFCNano:
+			v.t, err = time.Parse(time.RFC3339Nano, s)
+		default:
+			err = fmt.Errorf("%s has unknown data type %s", v.column.Name(), v.column.DataType())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// growBytes returns b resized to n bytes, reusing its memory if possible
+func growBytes(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// newRecord creates FluxRecord from the actual values
+func (q *QueryTableResult) newRecord() *query.FluxRecord {
+	values := make(map[string]interface{}, len(q.values))
+	for i := range q.values {
+		v := &q.values[i]
+		values[v.column.Name()] = v.value()
+	}
+	return query.NewFluxRecord(q.table.Position(), values)
+}
+
+// value returns the parsed value as a type used by FluxRecord
+func (v *columnValue) value() interface{} {
+	if v.null {
+		return nil
+	}
+	switch v.typ {
+	case columnTypeDouble:
+		return v.f
+	case columnTypeBool:
+		return v.b
+	case columnTypeLong:
+		return v.i
+	case columnTypeULong:
+		return v.u
+	case columnTypeDuration:
+		return time.Duration(v.i)
+	case columnTypeBase64Binary:
+		return append([]byte(nil), v.bytes...)
+	case columnTypeTimeRFC, columnTypeTimeRFCNano:
+		return v.t
+	default:
+		return v.raw
+	}
+}
+
+// columnValue returns the actual value of column col
+func (q *QueryTableResult) columnValue(col int) *columnValue {
+	if !q.hasRow || col < 0 || col >= len(q.values) {
+		return &zeroValue
+	}
+	return &q.values[col]
+}
+
+// ColumnIndex returns index of the column name in the actual table, or -1 if there is no such column.
+// The index is used by the typed accessors.
+func (q *QueryTableResult) ColumnIndex(name string) int {
+	for i := range q.values {
+		if q.values[i].column.Name() == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsNull returns true if column col of the actual row has no value
+func (q *QueryTableResult) IsNull(col int) bool {
+	return q.columnValue(col).null
+}
+
+// String returns value of string column col of the actual row.
+// For columns of other types it returns the value as received from the server.
+func (q *QueryTableResult) String(col int) string {
+	return q.columnValue(col).raw
+}
+
+// Float64 returns value of double column col of the actual row.
+// Values of long and unsignedLong columns are converted, zero is returned for other types or null.
+func (q *QueryTableResult) Float64(col int) float64 {
+	v := q.columnValue(col)
+	switch {
+	case v.null:
+		return 0
+	case v.typ == columnTypeDouble:
+		return v.f
+	case v.typ == columnTypeLong:
+		return float64(v.i)
+	case v.typ == columnTypeULong:
+		return float64(v.u)
+	default:
+		return 0
+	}
+}
+
+// Int64 returns value of long column col of the actual row, zero is returned for other types or null
+func (q *QueryTableResult) Int64(col int) int64 {
+	if v := q.columnValue(col); !v.null && v.typ == columnTypeLong {
+		return v.i
+	}
+	return 0
+}
+
+// Uint64 returns value of unsignedLong column col of the actual row, zero is returned for other types or null
+func (q *QueryTableResult) Uint64(col int) uint64 {
+	if v := q.columnValue(col); !v.null && v.typ == columnTypeULong {
+		return v.u
+	}
+	return 0
+}
+
+// Bool returns value of boolean column col of the actual row, false is returned for other types or null
+func (q *QueryTableResult) Bool(col int) bool {
+	if v := q.columnValue(col); !v.null && v.typ == columnTypeBool {
+		return v.b
+	}
+	return false
+}
+
+// Time returns value of dateTime column col of the actual row, zero time is returned for other types or null
+func (q *QueryTableResult) Time(col int) time.Time {
+	if v := q.columnValue(col); !v.null && (v.typ == columnTypeTimeRFC || v.typ == columnTypeTimeRFCNano) {
+		return v.t
+	}
+	return time.Time{}
+}
+
+// Duration returns value of duration column col of the actual row, zero is returned for other types or null
+func (q *QueryTableResult) Duration(col int) time.Duration {
+	if v := q.columnValue(col); !v.null && v.typ == columnTypeDuration {
+		return time.Duration(v.i)
+	}
+	return 0
+}
+
+// Bytes returns value of base64Binary column col of the actual row, nil is returned for other types or null.
+// The returned slice is reused by the next call of Next(), copy it to keep the value.
+func (q *QueryTableResult) Bytes(col int) []byte {
+	if v := q.columnValue(col); !v.null && v.typ == columnTypeBase64Binary {
+		return v.bytes
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+)
+
+// durationType is the exact type for the Duration
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// bytesType is the exact type for the base64Binary values
+var bytesType = reflect.TypeOf([]byte(nil))
+
+// RecordToData decodes flux record into a custom structure pointed by x.
+// It is the inverse of DataToPoint. Struct fields are mapped to record columns using 'lp' annotation:
+//   - measurement is taken from the _measurement column
+//   - tag,name is taken from the column name
+//   - field,name is taken from the column name, or from the _value column if the _field column of the record equals to name
+//   - timestamp is taken from the _time column
+//
+// Any column, e.g. _start or result, can be mapped using 'flux' annotation with the column name, which takes precedence over 'lp' annotation.
+// Fields annotated with "-" or without annotation are skipped. Fields for missing columns or columns with no value are left unchanged.
+//
+// Column values are converted to the field type, if possible without loss, otherwise an error is returned.
+// Pointer fields are allocated, interface{} fields receive the value as is.
+//
+//	 type TemperatureSensor struct {
+//		  Measurement string `lp:"measurement"`
+//		  Sensor string `lp:"tag,sensor"`
+//		  Temp float64 `lp:"field,temperature"`
+//		  Time time.Time `lp:"timestamp"`
+//		  Start time.Time `flux:"_start"`
+//	 }
+func RecordToData(record *query.FluxRecord, x interface{}) error {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot decode record into %v, pointer to struct is required", reflect.TypeOf(x))
+	}
+	v = v.Elem()
+	t := v.Type()
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode record into %v, pointer to struct is required", reflect.TypeOf(x))
+	}
+	for _, f := range reflect.VisibleFields(t) {
+		if f.Anonymous || f.PkgPath != "" {
+			continue
+		}
+		column, err := recordColumn(record, f)
+		if err != nil {
+			return err
+		}
+		if column == "" {
+			continue
+		}
+		value, ok := record.Values()[column]
+		if !ok || value == nil {
+			continue
+		}
+		if err := setFieldValue(v.FieldByIndex(f.Index), value); err != nil {
+			return fmt.Errorf("cannot decode column '%s' into field '%s': %w", column, f.Name, err)
+		}
+	}
+	return nil
+}
+
+// recordColumn returns name of the record column mapped to the struct field f, or empty string if field is not mapped
+func recordColumn(record *query.FluxRecord, f reflect.StructField) (string, error) {
+	if tag, ok := f.Tag.Lookup("flux"); ok {
+		if tag == "-" {
+			return "", nil
+		}
+		return tag, nil
+	}
+	tag, ok := f.Tag.Lookup("lp")
+	if !ok || tag == "-" {
+		return "", nil
+	}
+	parts := strings.Split(tag, ",")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("multiple tag attributes are not supported")
+	}
+	name := f.Name
+	if len(parts) == 2 {
+		name = parts[1]
+	}
+	switch parts[0] {
+	case "measurement":
+		return "_measurement", nil
+	case "tag":
+		return name, nil
+	case "field":
+		if _, ok := record.Values()[name]; !ok && record.Field() == name {
+			return "_value", nil
+		}
+		return name, nil
+	case "timestamp":
+		return "_time", nil
+	default:
+		return "", fmt.Errorf("invalid tag %s", parts[0])
+	}
+}
+
+// setFieldValue assigns value to the field, converting it to the field type
+func setFieldValue(field reflect.Value, value interface{}) error {
+	t := field.Type()
+	switch {
+	case t.Kind() == reflect.Interface:
+		field.Set(reflect.ValueOf(value))
+		return nil
+	case t.Kind() == reflect.Ptr:
+		p := reflect.New(t.Elem())
+		if err := setFieldValue(p.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(p)
+		return nil
+	case t == timeType, t == durationType, t == bytesType:
+		v := reflect.ValueOf(value)
+		if v.Type() != t {
+			return mismatchError(value, t)
+		}
+		field.Set(v)
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			field.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			field.SetBool(b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch n := value.(type) {
+		case int64:
+			if field.OverflowInt(n) {
+				return overflowError(value, t)
+			}
+			field.SetInt(n)
+			return nil
+		case uint64:
+			if n > math.MaxInt64 || field.OverflowInt(int64(n)) {
+				return overflowError(value, t)
+			}
+			field.SetInt(int64(n))
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch n := value.(type) {
+		case uint64:
+			if field.OverflowUint(n) {
+				return overflowError(value, t)
+			}
+			field.SetUint(n)
+			return nil
+		case int64:
+			if n < 0 || field.OverflowUint(uint64(n)) {
+				return overflowError(value, t)
+			}
+			field.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch n := value.(type) {
+		case float64:
+			if field.OverflowFloat(n) {
+				return overflowError(value, t)
+			}
+			field.SetFloat(n)
+			return nil
+		case int64:
+			field.SetFloat(float64(n))
+			return nil
+		case uint64:
+			field.SetFloat(float64(n))
+			return nil
+		}
+	}
+	return mismatchError(value, t)
+}
+
+func mismatchError(value interface{}, t reflect.Type) error {
+	return fmt.Errorf("cannot use value '%v' of type %T as %v", value, value, t)
+}
+
+func overflowError(value interface{}, t reflect.Type) error {
+	return fmt.Errorf("value '%v' overflows %v", value, t)
+}
+
+// Decode decodes the actual record into a custom structure pointed by x.
+// See RecordToData for details about mapping of the record columns to struct fields.
+func (q *QueryTableResult) Decode(x interface{}) error {
+	record := q.Record()
+	if record == nil {
+		return errors.New("no record to decode, call Next() first")
+	}
+	return RecordToData(record, x)
+}
+
+// DecodeAll reads all remaining records and appends them decoded into the slice pointed by slicePtr.
+// Slice elements can be structs or pointers to structs. See RecordToData for details about mapping of the record columns to struct fields.
+func (q *QueryTableResult) DecodeAll(slicePtr interface{}) error {
+	v := reflect.ValueOf(slicePtr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("cannot decode records into %v, pointer to slice is required", reflect.TypeOf(slicePtr))
+	}
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot decode records into %v, slice of structs is required", slice.Type())
+	}
+	for q.Next() {
+		elem := reflect.New(elemType)
+		if err := RecordToData(q.Record(), elem.Interface()); err != nil {
+			_ = q.Close()
+			return err
+		}
+		if isPtr {
+			slice.Set(reflect.Append(slice, elem))
+		} else {
+			slice.Set(reflect.Append(slice, elem.Elem()))
+		}
+	}
+	return q.Err()
+}
+
+// QueryInto executes flux query using queryAPI and appends all result records decoded into the slice pointed by slicePtr.
+// Slice elements can be structs or pointers to structs. See RecordToData for details about mapping of the record columns to struct fields.
+//
+//	var sensors []TemperatureSensor
+//	err := api.QueryInto(ctx, queryAPI, `from(bucket:"my-bucket")|> range(start: -1h) |> pivot(rowKey:["_time"], columnKey: ["_field"], valueColumn: "_value")`, &sensors)
+func QueryInto(ctx context.Context, queryAPI QueryAPI, query string, slicePtr interface{}) error {
+	result, err := queryAPI.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	return result.DecodeAll(slicePtr)
+}
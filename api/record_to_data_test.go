@@ -0,0 +1,204 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordToData(t *testing.T) {
+	now := time.Now()
+	record := query.NewFluxRecord(0, map[string]interface{}{
+		"result":       "_result",
+		"table":        int64(1),
+		"_start":       now.Add(-time.Hour),
+		"_time":        now,
+		"_measurement": "air",
+		"sensor":       "SHT31",
+		"temperature":  23.5,
+		"humidity":     int64(55),
+		"count":        uint64(10),
+		"elapsed":      time.Second,
+		"raw":          []byte("abc"),
+		"ok":           true,
+		"missing":      nil,
+	})
+	type sensor struct {
+		Measurement string        `lp:"measurement"`
+		Sensor      string        `lp:"tag,sensor"`
+		Temp        float64       `lp:"field,temperature"`
+		Hum         int           `lp:"field,humidity"`
+		HumFloat    float32       `flux:"humidity"`
+		Count       *uint16       `lp:"field,count"`
+		Elapsed     time.Duration `flux:"elapsed"`
+		Raw         []byte        `flux:"raw"`
+		OK          bool          `lp:"field,ok"`
+		Any         interface{}   `flux:"table"`
+		Missing     string        `lp:"field,missing"`
+		Time        time.Time     `lp:"timestamp"`
+		Start       time.Time     `flux:"_start"`
+		Description string        `lp:"-"`
+		Untagged    string
+	}
+	var s sensor
+	s.Missing = "default"
+	require.NoError(t, RecordToData(record, &s))
+	count := uint16(10)
+	assert.Equal(t, sensor{
+		Measurement: "air",
+		Sensor:      "SHT31",
+		Temp:        23.5,
+		Hum:         55,
+		HumFloat:    55,
+		Count:       &count,
+		Elapsed:     time.Second,
+		Raw:         []byte("abc"),
+		OK:          true,
+		Any:         int64(1),
+		Missing:     "default",
+		Time:        now,
+		Start:       now.Add(-time.Hour),
+	}, s)
+}
+
+func TestRecordToDataFieldValue(t *testing.T) {
+	record := query.NewFluxRecord(0, map[string]interface{}{
+		"_measurement": "air",
+		"_field":       "temperature",
+		"_value":       23.5,
+	})
+	var s struct {
+		Temp float64 `lp:"field,temperature"`
+		Hum  float64 `lp:"field,humidity"`
+	}
+	require.NoError(t, RecordToData(record, &s))
+	assert.Equal(t, 23.5, s.Temp)
+	assert.Equal(t, 0.0, s.Hum)
+}
+
+func TestRecordToDataErrors(t *testing.T) {
+	record := query.NewFluxRecord(0, map[string]interface{}{
+		"s":   "text",
+		"i":   int64(-300),
+		"u":   uint64(300),
+		"f":   1.5,
+		"big": uint64(1 << 63),
+	})
+	tests := []struct {
+		name  string
+		x     interface{}
+		error string
+	}{
+		{"not pointer", struct{}{}, "cannot decode record into struct {}, pointer to struct is required"},
+		{"not struct", new(int), "cannot decode record into *int, pointer to struct is required"},
+		{"string to int", &struct {
+			I int `flux:"s"`
+		}{}, "cannot decode column 's' into field 'I': cannot use value 'text' of type string as int"},
+		{"int overflow", &struct {
+			I int8 `flux:"i"`
+		}{}, "cannot decode column 'i' into field 'I': value '-300' overflows int8"},
+		{"negative to uint", &struct {
+			U uint `flux:"i"`
+		}{}, "cannot decode column 'i' into field 'U': value '-300' overflows uint"},
+		{"uint overflow", &struct {
+			U uint8 `flux:"u"`
+		}{}, "cannot decode column 'u' into field 'U': value '300' overflows uint8"},
+		{"uint to int overflow", &struct {
+			I int64 `flux:"big"`
+		}{}, "cannot decode column 'big' into field 'I': value '9223372036854775808' overflows int64"},
+		{"float to int", &struct {
+			I int `lp:"field,f"`
+		}{}, "cannot decode column 'f' into field 'I': cannot use value '1.5' of type float64 as int"},
+		{"string to time", &struct {
+			T time.Time `lp:"field,s"`
+		}{}, "cannot decode column 's' into field 'T': cannot use value 'text' of type string as time.Time"},
+		{"invalid tag", &struct {
+			T string `lp:"foo"`
+		}{}, "invalid tag foo"},
+		{"multiple attributes", &struct {
+			T string `lp:"field,a,b"`
+		}{}, "multiple tag attributes are not supported"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := RecordToData(record, test.x)
+			require.Error(t, err)
+			assert.Equal(t, test.error, err.Error())
+		})
+	}
+}
+
+func TestQueryInto(t *testing.T) {
+	csvTable := `#datatype,string,long,dateTime:RFC3339,string,string,double,long
+#group,false,false,false,true,true,false,false
+#default,_result,,,,,,
+,result,table,_time,_measurement,sensor,temperature,humidity
+,,0,2020-02-18T10:34:08.135814545Z,air,SHT31,23.5,55
+,,0,2020-02-18T10:35:08.135814545Z,air,SHT31,24.1,54
+
+#datatype,string,long,dateTime:RFC3339,string,string,double,long
+#group,false,false,false,true,true,false,false
+#default,_result,,,,,,
+,result,table,_time,_measurement,sensor,temperature,humidity
+,,1,2020-02-18T10:34:08.135814545Z,air,DHT22,22.9,
+
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/csv")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(csvTable))
+	}))
+	defer server.Close()
+	queryAPI := NewQueryAPI("org", http2.NewService(server.URL, "a", http2.DefaultOptions()))
+
+	type sensor struct {
+		Measurement string    `lp:"measurement"`
+		Sensor      string    `lp:"tag,sensor"`
+		Temp        float64   `lp:"field,temperature"`
+		Hum         *int      `lp:"field,humidity"`
+		Time        time.Time `lp:"timestamp"`
+	}
+	var sensors []sensor
+	require.NoError(t, QueryInto(context.Background(), queryAPI, "from", &sensors))
+	require.Len(t, sensors, 3)
+	assert.Equal(t, "SHT31", sensors[0].Sensor)
+	assert.Equal(t, 23.5, sensors[0].Temp)
+	require.NotNil(t, sensors[0].Hum)
+	assert.Equal(t, 55, *sensors[0].Hum)
+	assert.Equal(t, mustParseTime("2020-02-18T10:35:08.135814545Z"), sensors[1].Time)
+	assert.Equal(t, "DHT22", sensors[2].Sensor)
+	assert.Nil(t, sensors[2].Hum)
+
+	var sensorPtrs []*sensor
+	result := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable)))
+	require.True(t, result.Next())
+	var first sensor
+	require.NoError(t, result.Decode(&first))
+	assert.Equal(t, 23.5, first.Temp)
+	require.NoError(t, result.DecodeAll(&sensorPtrs))
+	require.Len(t, sensorPtrs, 2)
+	assert.Equal(t, 24.1, sensorPtrs[0].Temp)
+
+	assert.EqualError(t, NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable))).Decode(&first), "no record to decode, call Next() first")
+	assert.EqualError(t, result.DecodeAll(sensors), "cannot decode records into []api.sensor, pointer to slice is required")
+	var ints []int
+	assert.EqualError(t, result.DecodeAll(&ints), "cannot decode records into []int, slice of structs is required")
+	var wrong []struct {
+		Temp string `lp:"field,temperature"`
+	}
+	err := NewQueryTableResult(io.NopCloser(strings.NewReader(csvTable))).DecodeAll(&wrong)
+	assert.EqualError(t, err, "cannot decode column 'temperature' into field 'Temp': cannot use value '23.5' of type float64 as string")
+}
@@ -0,0 +1,575 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+	lp "github.com/influxdata/line-protocol"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoRoute reports data discarded by RouterWriteAPI, because no route was found for it
+var ErrNoRoute = errors.New("no route for data")
+
+// RouteTarget is organization and bucket, to which RouterWriteAPI writes data
+type RouteTarget struct {
+	Org    string
+	Bucket string
+}
+
+// String returns org/bucket
+func (t RouteTarget) String() string {
+	return t.Org + "/" + t.Bucket
+}
+
+// RouteFunc returns target for data with the measurement and tags. It returns false if there is no target for the data,
+// the data are then discarded and reported by RouteError nesting ErrNoRoute.
+// It is called synchronously by write methods of RouterWriteAPI, possibly concurrently.
+type RouteFunc func(measurement string, tags map[string]string) (RouteTarget, bool)
+
+// RoutingRule is a declarative rule of RouteByRules
+type RoutingRule struct {
+	// Measurement matched by the rule, empty value matches any measurement
+	Measurement string
+	// Tag, which must be present in matched data, empty value matches data without regard to tags
+	Tag string
+	// Value of Tag matched by the rule, empty value matches any value
+	TagValue string
+	// Target organization
+	Org string
+	// Target bucket. If it is empty, the value of Tag is used as the bucket name, e.g. for a tag holding tenant.
+	Bucket string
+}
+
+// matches returns true if the rule matches data with the measurement and tags
+func (r *RoutingRule) matches(measurement string, tags map[string]string) bool {
+	if r.Measurement != "" && r.Measurement != measurement {
+		return false
+	}
+	if r.Tag == "" {
+		return true
+	}
+	value, ok := tags[r.Tag]
+	return ok && (r.TagValue == "" || r.TagValue == value)
+}
+
+// RouteByRules returns RouteFunc routing data to the target of the first matching rule
+func RouteByRules(rules ...RoutingRule) RouteFunc {
+	return func(measurement string, tags map[string]string) (RouteTarget, bool) {
+		for i := range rules {
+			r := &rules[i]
+			if !r.matches(measurement, tags) {
+				continue
+			}
+			bucket := r.Bucket
+			if bucket == "" {
+				bucket = tags[r.Tag]
+			}
+			if bucket == "" {
+				continue
+			}
+			return RouteTarget{Org: r.Org, Bucket: bucket}, true
+		}
+		return RouteTarget{}, false
+	}
+}
+
+// RouteError is an error of writing data routed by RouterWriteAPI
+type RouteError struct {
+	// Target of the data, it is empty for ErrNoRoute
+	Target RouteTarget
+	// Err is the error of writing
+	Err error
+	// Lines of a record, which could not be routed, the other lines of the record are written
+	Lines []string
+}
+
+// Error returns error message with the target
+func (e *RouteError) Error() string {
+	if e.Target == (RouteTarget{}) {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s: %s", e.Target, e.Err.Error())
+}
+
+// Unwrap returns the error of writing
+func (e *RouteError) Unwrap() error {
+	return e.Err
+}
+
+// routedWriter is WriteAPI for a target with its usage
+type routedWriter struct {
+	writeAPI *WriteAPIImpl
+	lastUsed time.Time
+	// number of ongoing write calls, writer cannot be closed while in use
+	inUse int
+}
+
+// RouterWriteAPI is WriteAPI writing each point and record to the organization and bucket selected by RouteFunc.
+// WriteAPI for a target is created on the first write to the target, with the same write options and callbacks.
+// WriteAPIs not used for the idle timeout are flushed and closed, and created again when needed.
+// Errors of all targets are reported by a single Errors channel, as RouteError with the target.
+// Lines of a record are routed separately, acknowledgement of a record is resolved when lines of all its targets are resolved.
+// Lines of a record without route are reported by RouteError with the lines, the other lines of the record are written.
+type RouterWriteAPI struct {
+	service      http2.Service
+	writeOptions *write.Options
+	route        RouteFunc
+	idleTimeout  time.Duration
+	lock         sync.Mutex
+	writers      map[RouteTarget]*routedWriter
+	observers    []write.Observer
+	failedCb     WriteFailedCallback
+	succeededCb  WriteSucceededCallback
+	undelivered  UndeliveredCallback
+	errCh        chan error
+	closed       bool
+	stop         chan struct{}
+	done         chan struct{}
+	errWg        sync.WaitGroup
+}
+
+// NewRouterWriteAPI returns RouterWriteAPI writing data routed by route, using service and writeOptions.
+// WriteAPIs not used for idleTimeout are closed, zero value means they are closed only by Close.
+func NewRouterWriteAPI(service http2.Service, writeOptions *write.Options, route RouteFunc, idleTimeout time.Duration) *RouterWriteAPI {
+	r := &RouterWriteAPI{
+		service:      service,
+		writeOptions: writeOptions,
+		route:        route,
+		idleTimeout:  idleTimeout,
+		writers:      make(map[RouteTarget]*routedWriter),
+		errCh:        make(chan error, 1),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go r.closeIdleProc()
+	return r
+}
+
+// closeIdleProc periodically closes idle writers, until the router is closed
+func (r *RouterWriteAPI) closeIdleProc() {
+	defer close(r.done)
+	if r.idleTimeout <= 0 {
+		<-r.stop
+		return
+	}
+	ticker := time.NewTicker(r.idleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.closeIdle()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// closeIdle closes writers not used for the idle timeout
+func (r *RouterWriteAPI) closeIdle() {
+	var idle []*WriteAPIImpl
+	r.lock.Lock()
+	for target, w := range r.writers {
+		if w.inUse == 0 && time.Since(w.lastUsed) >= r.idleTimeout {
+			log.Debugf("Closing idle WriteAPI for %s", target)
+			idle = append(idle, w.writeAPI)
+			delete(r.writers, target)
+		}
+	}
+	r.lock.Unlock()
+	for _, w := range idle {
+		w.Close()
+	}
+}
+
+// acquire returns writer for target, which is created if it doesn't exist. The writer must be released after writing.
+// It returns nil if the router is closed.
+func (r *RouterWriteAPI) acquire(target RouteTarget) *routedWriter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		log.Warn("RouterWriteAPI is closed, discarding data")
+		return nil
+	}
+	w, ok := r.writers[target]
+	if !ok {
+		w = &routedWriter{writeAPI: r.newWriteAPI(target)}
+		r.writers[target] = w
+	}
+	w.inUse++
+	w.lastUsed = time.Now()
+	return w
+}
+
+// release marks end of writing by w
+func (r *RouterWriteAPI) release(w *routedWriter) {
+	r.lock.Lock()
+	w.inUse--
+	r.lock.Unlock()
+}
+
+// newWriteAPI creates WriteAPI for target with callbacks and observers of the router and forwards its errors
+func (r *RouterWriteAPI) newWriteAPI(target RouteTarget) *WriteAPIImpl {
+	w := NewWriteAPI(target.Org, target.Bucket, r.service, r.writeOptions, r.observers...)
+	if r.failedCb != nil {
+		w.SetWriteFailedCallback(r.failedCb)
+	}
+	if r.succeededCb != nil {
+		w.SetWriteSucceededCallback(r.succeededCb)
+	}
+	if r.undelivered != nil {
+		w.SetUndeliveredCallback(r.undelivered)
+	}
+	r.errWg.Add(1)
+	go func(errCh <-chan error) {
+		defer r.errWg.Done()
+		// channel is closed when the writer is closed
+		for err := range errCh {
+			r.reportError(&RouteError{Target: target, Err: err})
+		}
+	}(w.Errors())
+	return w
+}
+
+// reportError sends err to the Errors channel, if it is read
+func (r *RouterWriteAPI) reportError(err error) {
+	select {
+	case r.errCh <- err:
+	default:
+		log.Warn("Cannot write error to error channel, it is not read")
+	}
+}
+
+// routeRecord returns target for the line protocol line
+func (r *RouterWriteAPI) routeRecord(line string) (RouteTarget, error) {
+	metrics, err := lp.NewParser(lp.NewMetricHandler()).Parse([]byte(line))
+	if err != nil {
+		return RouteTarget{}, err
+	}
+	if len(metrics) == 0 {
+		return RouteTarget{}, ErrNoRoute
+	}
+	tags := make(map[string]string, len(metrics[0].TagList()))
+	for _, t := range metrics[0].TagList() {
+		tags[t.Key] = t.Value
+	}
+	if target, ok := r.route(metrics[0].Name(), tags); ok {
+		return target, nil
+	}
+	return RouteTarget{}, ErrNoRoute
+}
+
+// routePoint returns target for point
+func (r *RouterWriteAPI) routePoint(point *write.Point) (RouteTarget, error) {
+	tags := make(map[string]string, len(point.TagList()))
+	for _, t := range point.TagList() {
+		tags[t.Key] = t.Value
+	}
+	if target, ok := r.route(point.Name(), tags); ok {
+		return target, nil
+	}
+	return RouteTarget{}, ErrNoRoute
+}
+
+// routingError reports data, which cannot be routed, and resolves ack with err
+func (r *RouterWriteAPI) routingError(err *RouteError, ack *write.Ack) {
+	log.Errorf("Routing error: %s", err.Error())
+	if ack != nil {
+		ack.Resolve(err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.closed {
+		r.reportError(err)
+	}
+}
+
+// writeRecord routes lines of the record and writes lines of each target by fn as a single record.
+// Lines without route are reported by a single RouteError, the other lines are written.
+func (r *RouterWriteAPI) writeRecord(line string, ack *write.Ack, fn func(w *WriteAPIImpl, line string, ack *write.Ack)) {
+	var targets []RouteTarget
+	lines := make(map[RouteTarget][]string)
+	var routeErr *RouteError
+	for _, l := range strings.Split(line, "\n") {
+		trimmed := strings.TrimSpace(l)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		target, err := r.routeRecord(l)
+		if err != nil {
+			if routeErr == nil {
+				routeErr = &RouteError{Err: err}
+			}
+			routeErr.Lines = append(routeErr.Lines, l)
+			continue
+		}
+		if _, ok := lines[target]; !ok {
+			targets = append(targets, target)
+		}
+		lines[target] = append(lines[target], l)
+	}
+	parts := len(targets)
+	if routeErr != nil {
+		parts++
+	}
+	if parts == 0 && ack != nil {
+		// nothing to write
+		ack.Resolve(nil)
+	}
+	var joined *fanOutAck
+	if ack != nil && parts > 1 {
+		joined = newFanOutAck(ack, parts)
+	}
+	if routeErr != nil {
+		if joined != nil {
+			r.routingError(routeErr, nil)
+			joined.resolve(routeErr)
+		} else {
+			r.routingError(routeErr, ack)
+		}
+	}
+	for _, target := range targets {
+		w := r.acquire(target)
+		if w == nil {
+			switch {
+			case joined != nil:
+				joined.resolve(&RouteError{Target: target, Err: write.ErrWriteAPIClosed})
+			case ack != nil:
+				ack.Resolve(write.ErrWriteAPIClosed)
+			}
+			continue
+		}
+		record := strings.Join(lines[target], "\n")
+		switch {
+		case joined != nil:
+			targetAck := write.NewAck(nil)
+			fn(w.writeAPI, record, targetAck)
+			joined.wait(targetAck, func(err error) error {
+				return &RouteError{Target: target, Err: err}
+			})
+		default:
+			fn(w.writeAPI, record, ack)
+		}
+		r.release(w)
+	}
+}
+
+// writePoint routes point and writes it by fn
+func (r *RouterWriteAPI) writePoint(point *write.Point, ack *write.Ack, fn func(w *WriteAPIImpl)) {
+	target, err := r.routePoint(point)
+	if err != nil {
+		r.routingError(&RouteError{Err: err}, ack)
+		return
+	}
+	w := r.acquire(target)
+	if w == nil {
+		if ack != nil {
+			ack.Resolve(write.ErrWriteAPIClosed)
+		}
+		return
+	}
+	fn(w.writeAPI)
+	r.release(w)
+}
+
+// WriteRecord writes asynchronously line protocol record into the bucket selected by the route
+func (r *RouterWriteAPI) WriteRecord(line string) {
+	r.writeRecord(line, nil, func(w *WriteAPIImpl, line string, _ *write.Ack) {
+		w.WriteRecord(line)
+	})
+}
+
+// WritePoint writes asynchronously Point into the bucket selected by the route
+func (r *RouterWriteAPI) WritePoint(point *write.Point) {
+	r.writePoint(point, nil, func(w *WriteAPIImpl) {
+		w.WritePoint(point)
+	})
+}
+
+// WriteRecordWithAck writes asynchronously line protocol record into the bucket selected by the route, the same way as WriteRecord.
+// It returns acknowledgement with the correlation id, which is resolved when the batch with the record is written or discarded.
+func (r *RouterWriteAPI) WriteRecordWithAck(line string, id interface{}) *write.Ack {
+	ack := write.NewAck(id)
+	r.writeRecord(line, ack, func(w *WriteAPIImpl, line string, ack *write.Ack) {
+		w.writeRecord(line, ack, trace.SpanContext{})
+	})
+	return ack
+}
+
+// WritePointWithAck writes asynchronously Point into the bucket selected by the route, the same way as WritePoint.
+// It returns acknowledgement with the correlation id, which is resolved when the batch with the point is written or discarded.
+func (r *RouterWriteAPI) WritePointWithAck(point *write.Point, id interface{}) *write.Ack {
+	ack := write.NewAck(id)
+	r.writePoint(point, ack, func(w *WriteAPIImpl) {
+		w.writePoint(point, ack, trace.SpanContext{})
+	})
+	return ack
+}
+
+// WriteRecordWithContext writes asynchronously line protocol record into the bucket selected by the route, the same way as WriteRecord.
+// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the record is linked to the span in ctx.
+func (r *RouterWriteAPI) WriteRecordWithContext(ctx context.Context, line string) {
+	r.writeRecord(line, nil, func(w *WriteAPIImpl, line string, _ *write.Ack) {
+		w.WriteRecordWithContext(ctx, line)
+	})
+}
+
+// WritePointWithContext writes asynchronously Point into the bucket selected by the route, the same way as WritePoint.
+// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the point is linked to the span in ctx.
+func (r *RouterWriteAPI) WritePointWithContext(ctx context.Context, point *write.Point) {
+	r.writePoint(point, nil, func(w *WriteAPIImpl) {
+		w.WritePointWithContext(ctx, point)
+	})
+}
+
+// acquireAll returns the actual writers, which are marked used so that they are not closed until released
+func (r *RouterWriteAPI) acquireAll() []*routedWriter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	writers := make([]*routedWriter, 0, len(r.writers))
+	for _, w := range r.writers {
+		w.inUse++
+		writers = append(writers, w)
+	}
+	return writers
+}
+
+// Flush forces all pending writes of all targets to be sent
+func (r *RouterWriteAPI) Flush() {
+	for _, w := range r.acquireAll() {
+		w.writeAPI.Flush()
+		r.release(w)
+	}
+}
+
+// Errors returns a channel for reading errors of all targets, which are RouteError with the target.
+// Data without route are reported by RouteError nesting ErrNoRoute.
+// New error is skipped when channel is not read.
+func (r *RouterWriteAPI) Errors() <-chan error {
+	return r.errCh
+}
+
+// SetWriteFailedCallback sets callback allowing custom handling of failed writes of all targets.
+// If callback returns true, failed batch will be retried, otherwise discarded.
+func (r *RouterWriteAPI) SetWriteFailedCallback(cb WriteFailedCallback) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.failedCb = cb
+	for _, w := range r.writers {
+		w.writeAPI.SetWriteFailedCallback(cb)
+	}
+}
+
+// SetWriteSucceededCallback sets callback notified about successfully written batches of all targets.
+func (r *RouterWriteAPI) SetWriteSucceededCallback(cb WriteSucceededCallback) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.succeededCb = cb
+	for _, w := range r.writers {
+		w.writeAPI.SetWriteSucceededCallback(cb)
+	}
+}
+
+// SetUndeliveredCallback sets callback notified about batches discarded while WriteAPIs of targets are being closed.
+func (r *RouterWriteAPI) SetUndeliveredCallback(cb UndeliveredCallback) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.undelivered = cb
+	for _, w := range r.writers {
+		w.writeAPI.SetUndeliveredCallback(cb)
+	}
+}
+
+// AddObserver adds observer notified about batches of all targets.
+// It must be called before any write.
+func (r *RouterWriteAPI) AddObserver(observer write.Observer) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.observers = append(r.observers, observer)
+	for _, w := range r.writers {
+		w.writeAPI.AddObserver(observer)
+	}
+}
+
+// Targets returns sorted targets with open WriteAPIs
+func (r *RouterWriteAPI) Targets() []RouteTarget {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	targets := make([]RouteTarget, 0, len(r.writers))
+	for t := range r.writers {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].String() < targets[j].String()
+	})
+	return targets
+}
+
+// RetryQueueDepth returns number of batches waiting for retry in WriteAPIs of all targets
+func (r *RouterWriteAPI) RetryQueueDepth() int {
+	n := 0
+	for _, w := range r.acquireAll() {
+		n += w.writeAPI.RetryQueueDepth()
+		r.release(w)
+	}
+	return n
+}
+
+// InFlightRequests returns number of write requests in progress in WriteAPIs of all targets
+func (r *RouterWriteAPI) InFlightRequests() int {
+	n := 0
+	for _, w := range r.acquireAll() {
+		n += w.writeAPI.InFlightRequests()
+		r.release(w)
+	}
+	return n
+}
+
+// Close closes WriteAPIs of all targets and the Errors channel. Data written after closing are discarded
+// and their acknowledgements are resolved with write.ErrWriteAPIClosed.
+func (r *RouterWriteAPI) Close() {
+	_, _ = r.CloseWithContext(context.Background())
+}
+
+// CloseWithContext closes WriteAPIs of all targets with ctx, the same way as WriteAPIImpl.CloseWithContext,
+// and returns the summary report.
+func (r *RouterWriteAPI) CloseWithContext(ctx context.Context) (write.ShutdownReport, error) {
+	var report write.ShutdownReport
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return report, nil
+	}
+	r.closed = true
+	writers := r.writers
+	r.writers = make(map[RouteTarget]*routedWriter)
+	r.lock.Unlock()
+	close(r.stop)
+	<-r.done
+	var err error
+	for _, w := range writers {
+		rep, cerr := w.writeAPI.CloseWithContext(ctx)
+		report.Add(rep)
+		if cerr != nil {
+			err = cerr
+		}
+	}
+	r.errWg.Wait()
+	close(r.errCh)
+	return report, err
+}
+
+// ensure RouterWriteAPI implements WriteAPI
+var _ WriteAPI = (*RouterWriteAPI)(nil)
@@ -0,0 +1,172 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bucketLines collects written lines by org/bucket
+type bucketLines struct {
+	lock  sync.Mutex
+	lines map[string][]string
+}
+
+func (b *bucketLines) handler(u string, body io.Reader) error {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	key := parsed.Query().Get("org") + "/" + parsed.Query().Get("bucket")
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.lines[key] = append(b.lines[key], strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")...)
+	return nil
+}
+
+func (b *bucketLines) get(key string) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.lines[key]
+}
+
+func TestRouteByRules(t *testing.T) {
+	route := RouteByRules(
+		RoutingRule{Measurement: "audit", Org: "ops", Bucket: "audit"},
+		RoutingRule{Tag: "tenant", TagValue: "acme", Org: "acme", Bucket: "acme-data"},
+		RoutingRule{Tag: "tenant", Org: "saas"},
+	)
+	target, ok := route("audit", map[string]string{"tenant": "acme"})
+	assert.True(t, ok)
+	assert.Equal(t, RouteTarget{Org: "ops", Bucket: "audit"}, target)
+	target, ok = route("cpu", map[string]string{"tenant": "acme"})
+	assert.True(t, ok)
+	assert.Equal(t, RouteTarget{Org: "acme", Bucket: "acme-data"}, target)
+	target, ok = route("cpu", map[string]string{"tenant": "t1"})
+	assert.True(t, ok)
+	assert.Equal(t, RouteTarget{Org: "saas", Bucket: "t1"}, target)
+	assert.Equal(t, "saas/t1", target.String())
+	_, ok = route("cpu", map[string]string{"host": "h1"})
+	assert.False(t, ok)
+}
+
+func TestRouterWrite(t *testing.T) {
+	service := test.NewTestService(nil, "http://localhost:8888")
+	lines := &bucketLines{lines: make(map[string][]string)}
+	service.SetRequestHandler(lines.handler)
+	router := NewRouterWriteAPI(service, write.DefaultOptions().SetBatchSize(10), RouteByRules(RoutingRule{Tag: "tenant", Org: "my-org"}), 0)
+	errCh := router.Errors()
+
+	router.WriteRecord("cpu,tenant=t1 f=1i 1\ncpu,tenant=t2 f=2i 2\n\ncpu,tenant=t1 f=3i 3")
+	router.WritePoint(write.NewPoint("mem", map[string]string{"tenant": "t2"}, map[string]interface{}{"f": 4}, time.Unix(0, 4)))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ack := router.WriteRecordWithAck("cpu,tenant=t3 f=5i 5\ncpu,tenant=t1 f=6i 6", 1)
+	assert.Equal(t, []RouteTarget{{Org: "my-org", Bucket: "t1"}, {Org: "my-org", Bucket: "t2"}, {Org: "my-org", Bucket: "t3"}}, router.Targets())
+	router.Flush()
+	require.NoError(t, ack.Wait(ctx))
+	assert.Equal(t, 1, ack.ID())
+	assert.Equal(t, []string{"cpu,tenant=t1 f=1i 1", "cpu,tenant=t1 f=3i 3", "cpu,tenant=t1 f=6i 6"}, lines.get("my-org/t1"))
+	assert.Equal(t, []string{"cpu,tenant=t2 f=2i 2", "mem,tenant=t2 f=4i 4"}, lines.get("my-org/t2"))
+	assert.Equal(t, []string{"cpu,tenant=t3 f=5i 5"}, lines.get("my-org/t3"))
+
+	// data without route
+	ack = router.WritePointWithAck(write.NewPoint("cpu", nil, map[string]interface{}{"f": 1}, time.Unix(0, 1)), 2)
+	require.Error(t, ack.Wait(ctx))
+	assert.ErrorIs(t, ack.Err(), ErrNoRoute)
+	select {
+	case err := <-errCh:
+		assert.ErrorIs(t, err, ErrNoRoute)
+	case <-ctx.Done():
+		require.Fail(t, "error not reported")
+	}
+
+	// lines without route are reported, the other lines are written
+	ack = router.WriteRecordWithAck("cpu f=8i 8\ncpu,tenant=t3 f=9i 9", 3)
+	router.Flush()
+	require.Error(t, ack.Wait(ctx))
+	assert.ErrorIs(t, ack.Err(), ErrNoRoute)
+	select {
+	case err := <-errCh:
+		var routeErr *RouteError
+		require.True(t, errors.As(err, &routeErr))
+		assert.Equal(t, []string{"cpu f=8i 8"}, routeErr.Lines)
+	case <-ctx.Done():
+		require.Fail(t, "error not reported")
+	}
+	assert.Equal(t, []string{"cpu,tenant=t3 f=5i 5", "cpu,tenant=t3 f=9i 9"}, lines.get("my-org/t3"))
+
+	// errors of targets
+	service.SetReplyError(&http.Error{
+		StatusCode: 400,
+		Code:       "invalid",
+		Message:    "data",
+	})
+	router.WriteRecord("cpu,tenant=t2 f=7i 7")
+	router.Flush()
+	select {
+	case err := <-errCh:
+		var routeErr *RouteError
+		require.True(t, errors.As(err, &routeErr))
+		assert.Equal(t, RouteTarget{Org: "my-org", Bucket: "t2"}, routeErr.Target)
+		assert.Equal(t, "my-org/t2: write failed (attempts 0): invalid: data", err.Error())
+	case <-ctx.Done():
+		require.Fail(t, "error not reported")
+	}
+
+	router.Close()
+	_, ok := <-errCh
+	assert.False(t, ok)
+	assert.Len(t, router.Targets(), 0)
+
+	// data written after closing are discarded
+	ack = router.WriteRecordWithAck("cpu,tenant=t4 f=10i 10\ncpu,tenant=t5 f=11i 11", 4)
+	assert.ErrorIs(t, ack.Wait(ctx), write.ErrWriteAPIClosed)
+	router.WritePoint(write.NewPoint("cpu", map[string]string{"tenant": "t4"}, map[string]interface{}{"f": 12}, time.Unix(0, 12)))
+	assert.Len(t, router.Targets(), 0)
+	assert.Nil(t, lines.get("my-org/t4"))
+}
+
+func TestRouterCloseIdle(t *testing.T) {
+	service := test.NewTestService(nil, "http://localhost:8888")
+	lines := &bucketLines{lines: make(map[string][]string)}
+	service.SetRequestHandler(lines.handler)
+	router := NewRouterWriteAPI(service, write.DefaultOptions(), func(measurement string, _ map[string]string) (RouteTarget, bool) {
+		return RouteTarget{Org: "my-org", Bucket: measurement}, true
+	}, 50*time.Millisecond)
+
+	router.WriteRecord("a f=1i 1")
+	router.WriteRecord("b f=1i 1")
+	assert.Len(t, router.Targets(), 2)
+	// idle writers are flushed and closed
+	require.Eventually(t, func() bool {
+		return len(router.Targets()) == 0 && len(lines.get("my-org/a")) == 1 && len(lines.get("my-org/b")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a f=1i 1"}, lines.get("my-org/a"))
+	assert.Equal(t, []string{"b f=1i 1"}, lines.get("my-org/b"))
+
+	// writer is created again
+	router.WriteRecord("a f=2i 2")
+	assert.Equal(t, []RouteTarget{{Org: "my-org", Bucket: "a"}}, router.Targets())
+	router.Close()
+	assert.Equal(t, []string{"a f=1i 1", "a f=2i 2"}, lines.get("my-org/a"))
+}
@@ -6,6 +6,8 @@ package api
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -15,96 +17,334 @@ import (
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/influxdata/influxdb-client-go/v2/internal/log"
 	iwrite "github.com/influxdata/influxdb-client-go/v2/internal/write"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // WriteFailedCallback is synchronously notified in case non-blocking write fails.
 // batch contains complete payload, error holds detailed error information,
 // retryAttempts means number of retries, 0 if it failed during first write.
 // It must return true if WriteAPI should continue with retrying, false will discard the batch.
+// In case of a partial write, error nests write.PartialWriteError with rejected lines, and the batch is never retried.
 type WriteFailedCallback func(batch string, error http2.Error, retryAttempts uint) bool
 
+// WriteSucceededCallback is synchronously notified when a batch is written by non-blocking write.
+// result holds the batch, its size, number of write attempts and headers of the server response.
+// With write.Options.SetConcurrency greater than 1, it can be called concurrently.
+type WriteSucceededCallback func(result write.Result)
+
+// UndeliveredCallback is synchronously notified about a batch, which is discarded while WriteAPI is being closed,
+// e.g. because the shutdown deadline passed. batch contains complete payload, which can be persisted and written later.
+type UndeliveredCallback func(batch string)
+
 // WriteAPI is Write client interface with non-blocking methods for writing time series data asynchronously in batches into an InfluxDB server.
 // WriteAPI can be used concurrently.
 // When using multiple goroutines for writing, use a single WriteAPI instance in all goroutines.
 type WriteAPI interface {
 	// WriteRecord writes asynchronously line protocol record into bucket.
 	// WriteRecord adds record into the buffer which is sent on the background when it reaches the batch size.
+	// If record processing is enabled by write.Options.SetProcessRecords, invalid record is reported via the Errors channel.
 	// Blocking alternative is available in the WriteAPIBlocking interface
 	WriteRecord(line string)
 	// WritePoint writes asynchronously Point into bucket.
 	// WritePoint adds Point into the buffer which is sent on the background when it reaches the batch size.
 	// Blocking alternative is available in the WriteAPIBlocking interface
 	WritePoint(point *write.Point)
+	// WriteRecordWithAck writes asynchronously line protocol record into bucket, the same way as WriteRecord.
+	// It returns acknowledgement with the correlation id, which is resolved when the batch with the record is written or discarded.
+	WriteRecordWithAck(line string, id interface{}) *write.Ack
+	// WritePointWithAck writes asynchronously Point into bucket, the same way as WritePoint.
+	// It returns acknowledgement with the correlation id, which is resolved when the batch with the point is written or discarded.
+	// Encoding error resolves the acknowledgement immediately.
+	WritePointWithAck(point *write.Point, id interface{}) *write.Ack
+	// WriteRecordWithContext writes asynchronously line protocol record into bucket, the same way as WriteRecord.
+	// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the record is linked to the span in ctx.
+	WriteRecordWithContext(ctx context.Context, line string)
+	// WritePointWithContext writes asynchronously Point into bucket, the same way as WritePoint.
+	// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the point is linked to the span in ctx.
+	WritePointWithContext(ctx context.Context, point *write.Point)
 	// Flush forces all pending writes from the buffer to be sent
 	Flush()
 	// Errors returns a channel for reading errors which occurs during async writes.
 	// Must be called before performing any writes for errors to be collected.
 	// The chan is unbuffered and must be drained or the writer will block.
+	// Lines rejected by the server are reported by an error nesting write.PartialWriteError.
+	// Failure to use the persistent retry queue set by write.Options.SetRetryQueueDir is reported as the first error.
 	Errors() <-chan error
 	// SetWriteFailedCallback sets callback allowing custom handling of failed writes.
 	// If callback returns true, failed batch will be retried, otherwise discarded.
 	SetWriteFailedCallback(cb WriteFailedCallback)
+	// SetWriteSucceededCallback sets callback notified about successfully written batches.
+	SetWriteSucceededCallback(cb WriteSucceededCallback)
+	// SetUndeliveredCallback sets callback notified about batches discarded while WriteAPI is being closed.
+	SetUndeliveredCallback(cb UndeliveredCallback)
 }
 
 // WriteAPIImpl provides main implementation for WriteAPI
 type WriteAPIImpl struct {
-	service     *iwrite.Service
+	service *iwrite.Service
+	// services of write workers, the first one is service
+	services    []*iwrite.Service
 	writeBuffer []string
+	// size of lines in writeBuffer in bytes
+	writeBufferBytes int
+	// acknowledgements of lines in writeBuffer
+	writeAcks []*write.Ack
+	// span contexts of writes of lines in writeBuffer
+	writeSpans []trace.SpanContext
 
 	errCh        chan error
 	writeCh      chan *iwrite.Batch
-	bufferCh     chan string
+	bufferCh     chan bufferItem
 	writeStop    chan struct{}
 	bufferStop   chan struct{}
 	bufferFlush  chan struct{}
 	doneCh       chan struct{}
 	bufferInfoCh chan writeBuffInfoReq
-	writeInfoCh  chan writeBuffInfoReq
 	writeOptions *write.Options
-	closingMu    *sync.Mutex
+	// ctx is cancelled when the shutdown deadline passes, it interrupts ongoing writes
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stats of writes used for the shutdown report
+	stats *write.StatsCollector
+	// callback notified about written batches
+	succeededCb WriteSucceededCallback
+	// callback notified about batches discarded during closing
+	undeliveredCb UndeliveredCallback
+	// 1 while closing, more appropriate Bool type from sync/atomic cannot be used because it is available since go 1.19
+	closing int32
+	// number of batches sent to write workers and not handled yet
+	pendingBatches int32
+	closingMu      *sync.Mutex
+	// writeMu guards closed, writes hold the read lock while passing data to the buffer
+	writeMu sync.RWMutex
+	// true when closed, data written afterwards are discarded
+	closed bool
+	// time of the last write call in unix nanoseconds
+	lastWrite int64
 	// more appropriate Bool type from sync/atomic cannot be used because it is available since go 1.19
 	isErrChReader int32
 }
 
+// bufferItem is a line with optional acknowledgement and span context of the write sent to the buffer
+type bufferItem struct {
+	line        string
+	ack         *write.Ack
+	spanContext trace.SpanContext
+}
+
 type writeBuffInfoReq struct {
 	writeBuffLen int
 }
 
-// NewWriteAPI returns new non-blocking write client for writing data to  bucket belonging to org
-func NewWriteAPI(org string, bucket string, service http2.Service, writeOptions *write.Options) *WriteAPIImpl {
+// NewWriteAPI returns new non-blocking write client for writing data to  bucket belonging to org.
+// observers are notified about the lifecycle of batches in addition to the observer set in writeOptions,
+// including batches persisted by a previous instance, which are written right after creation.
+func NewWriteAPI(org string, bucket string, service http2.Service, writeOptions *write.Options, observers ...write.Observer) *WriteAPIImpl {
+	return newWriteAPI(func() *iwrite.Service {
+		return iwrite.NewService(org, bucket, service, writeOptions)
+	}, writeOptions, observers)
+}
+
+// NewWriteAPIV1 returns new non-blocking write client for writing data to database db and retention policy rp of InfluxDB 1.x,
+// using the /write endpoint. Empty rp means the default retention policy.
+// If username is not empty, requests are authenticated by username and password instead of the authorization of service.
+// observers are notified about the lifecycle of batches the same way as in NewWriteAPI.
+func NewWriteAPIV1(db, rp, username, password string, service http2.Service, writeOptions *write.Options, observers ...write.Observer) *WriteAPIImpl {
+	return newWriteAPI(func() *iwrite.Service {
+		return iwrite.NewServiceV1(db, rp, username, password, service, writeOptions)
+	}, writeOptions, observers)
+}
+
+// newWriteAPI creates WriteAPIImpl with write workers according to writeOptions.Concurrency, newService creates service for each worker.
+// observers are added before the workers start.
+func newWriteAPI(newService func() *iwrite.Service, writeOptions *write.Options, observers []write.Observer) *WriteAPIImpl {
+	workers := int(writeOptions.Concurrency())
+	if workers == 0 {
+		workers = 1
+	}
+	services := make([]*iwrite.Service, workers)
+	for i := range services {
+		services[i] = newService()
+	}
 	w := &WriteAPIImpl{
-		service:      iwrite.NewService(org, bucket, service, writeOptions),
+		service:      services[0],
+		services:     services,
 		errCh:        make(chan error, 1),
 		writeBuffer:  make([]string, 0, writeOptions.BatchSize()+1),
 		writeCh:      make(chan *iwrite.Batch),
-		bufferCh:     make(chan string),
+		bufferCh:     make(chan bufferItem),
 		bufferStop:   make(chan struct{}),
 		writeStop:    make(chan struct{}),
 		bufferFlush:  make(chan struct{}),
 		doneCh:       make(chan struct{}),
 		bufferInfoCh: make(chan writeBuffInfoReq),
-		writeInfoCh:  make(chan writeBuffInfoReq),
 		writeOptions: writeOptions,
 		closingMu:    &sync.Mutex{},
+		stats:        write.NewStatsCollector(),
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.lastWrite = time.Now().UnixNano()
+	w.AddObserver(w.stats)
+	w.AddObserver(undeliveredObserver{w: w})
+	w.AddObserver(succeededObserver{w: w})
+	for _, o := range observers {
+		w.AddObserver(o)
+	}
+	if writeOptions.RetryQueueDir() != "" {
+		for i, s := range w.services {
+			dir := writeOptions.RetryQueueDir()
+			if i > 0 {
+				// other workers than the first one persist batches to own subdirectories
+				dir = filepath.Join(dir, fmt.Sprintf("worker%d", i))
+			}
+			if err := s.UsePersistentRetryQueue(dir); err != nil {
+				log.Errorf("Cannot use persistent retry queue, using in-memory queue: %s", err.Error())
+				w.queueError(fmt.Errorf("cannot use persistent retry queue: %w", err))
+			}
+		}
+		w.mergeRetryQueues(writeOptions.RetryQueueDir())
 	}
 
 	go w.bufferProc()
-	go w.writeProc()
+	for _, s := range w.services {
+		// batches persisted by a previous instance are written first, flushing waits for them
+		replay := s.RetryQueueLen() > 0
+		if replay {
+			atomic.AddInt32(&w.pendingBatches, 1)
+		}
+		go w.writeProc(s, replay)
+	}
 
 	return w
 }
 
+// mergeRetryQueues moves batches persisted in dir by workers, which are not used with the actual concurrency,
+// to the retry queue of the first worker, so that they are written
+func (w *WriteAPIImpl) mergeRetryQueues(dir string) {
+	workerDirs, err := filepath.Glob(filepath.Join(dir, "worker*"))
+	if err != nil {
+		return
+	}
+	for _, workerDir := range workerDirs {
+		var i int
+		if _, err := fmt.Sscanf(filepath.Base(workerDir), "worker%d", &i); err != nil || i < len(w.services) {
+			continue
+		}
+		if err := w.service.MergePersistentRetryQueue(workerDir); err != nil {
+			log.Errorf("Cannot merge persistent retry queue of %s: %s", workerDir, err.Error())
+		}
+	}
+}
+
 // SetWriteFailedCallback sets callback allowing custom handling of failed writes.
 // If callback returns true, failed batch will be retried, otherwise discarded.
 func (w *WriteAPIImpl) SetWriteFailedCallback(cb WriteFailedCallback) {
-	w.service.SetBatchErrorCallback(func(batch *iwrite.Batch, error2 http2.Error) bool {
-		return cb(batch.Batch, error2, batch.RetryAttempts)
-	})
+	for _, s := range w.services {
+		s.SetBatchErrorCallback(func(batch *iwrite.Batch, error2 http2.Error) bool {
+			return cb(batch.Batch, error2, batch.RetryAttempts)
+		})
+	}
+}
+
+// SetWriteSucceededCallback sets callback notified about successfully written batches.
+// It must be called before performing any writes.
+func (w *WriteAPIImpl) SetWriteSucceededCallback(cb WriteSucceededCallback) {
+	w.succeededCb = cb
+}
+
+// succeededObserver notifies WriteSucceededCallback about written batches
+type succeededObserver struct {
+	write.NoopObserver
+	w *WriteAPIImpl
+}
+
+// BatchSucceeded notifies WriteSucceededCallback
+func (o succeededObserver) BatchSucceeded(batch *write.Batch) {
+	if o.w.succeededCb != nil {
+		o.w.succeededCb(batch.Result())
+	}
+}
+
+// SetUndeliveredCallback sets callback notified about batches discarded while WriteAPI is being closed.
+// It must be called before closing.
+func (w *WriteAPIImpl) SetUndeliveredCallback(cb UndeliveredCallback) {
+	w.undeliveredCb = cb
+}
+
+// undeliveredObserver notifies UndeliveredCallback about batches lost while closing
+type undeliveredObserver struct {
+	write.NoopObserver
+	w *WriteAPIImpl
+}
+
+func (o undeliveredObserver) undelivered(batch *write.Batch) {
+	if o.w.undeliveredCb != nil && atomic.LoadInt32(&o.w.closing) > 0 {
+		o.w.undeliveredCb(batch.Batch)
+	}
+}
+
+// BatchEvicted notifies UndeliveredCallback
+func (o undeliveredObserver) BatchEvicted(batch *write.Batch) {
+	o.undelivered(batch)
+}
+
+// BatchExpired notifies UndeliveredCallback
+func (o undeliveredObserver) BatchExpired(batch *write.Batch) {
+	o.undelivered(batch)
+}
+
+// BatchDropped notifies UndeliveredCallback
+func (o undeliveredObserver) BatchDropped(batch *write.Batch, _ error) {
+	o.undelivered(batch)
+}
+
+// SetRetryQueue replaces the default in-memory retry queue, which is limited by write.Options.RetryBufferLimit.
+// It must be called before performing any writes.
+// A retry queue cannot be shared by write workers, so with write.Options.Concurrency greater than 1,
+// queue is used only by the first worker and the others keep their default retry queues.
+func (w *WriteAPIImpl) SetRetryQueue(queue write.RetryQueue) {
+	w.service.SetRetryQueue(queue)
+}
+
+// SetRetryPolicy sets policy deciding about retrying of failed writes, replacing the policy set in write.Options.
+// It must be called before performing any writes.
+func (w *WriteAPIImpl) SetRetryPolicy(policy write.RetryPolicy) {
+	for _, s := range w.services {
+		s.SetRetryPolicy(policy)
+	}
+}
+
+// AddObserver adds observer notified about the lifecycle of batches, in addition to the observer set in write.Options.
+// It must be called before performing any writes. Batches persisted by a previous instance are written right after creation,
+// observers notified about them must be passed to NewWriteAPI.
+func (w *WriteAPIImpl) AddObserver(observer write.Observer) {
+	for _, s := range w.services {
+		s.AddObserver(observer)
+	}
+}
+
+// RetryQueueDepth returns number of batches waiting for retry in retry queues of write workers
+func (w *WriteAPIImpl) RetryQueueDepth() int {
+	n := 0
+	for _, s := range w.services {
+		n += s.RetryQueueDepth()
+	}
+	return n
+}
+
+// InFlightRequests returns number of write requests currently sent by write workers
+func (w *WriteAPIImpl) InFlightRequests() int {
+	n := 0
+	for _, s := range w.services {
+		n += s.InFlightRequests()
+	}
+	return n
 }
 
 // Errors returns a channel for reading errors which occurs during async writes.
 // Must be called before performing any writes for errors to be collected.
 // New error is skipped when channel is not read.
+// Failure to use the persistent retry queue is reported as the first error.
 func (w *WriteAPIImpl) Errors() <-chan error {
 	w.setErrChanRead()
 	return w.errCh
@@ -113,9 +353,16 @@ func (w *WriteAPIImpl) Errors() <-chan error {
 // Flush forces all pending writes from the buffer to be sent.
 // Flush also tries sending batches from retry queue without additional retrying.
 func (w *WriteAPIImpl) Flush() {
+	w.writeMu.RLock()
+	defer w.writeMu.RUnlock()
+	if w.closed {
+		return
+	}
 	w.bufferFlush <- struct{}{}
 	w.waitForFlushing()
-	w.service.Flush()
+	for _, s := range w.services {
+		s.Flush(w.ctx)
+	}
 }
 
 func (w *WriteAPIImpl) waitForFlushing() {
@@ -128,12 +375,7 @@ func (w *WriteAPIImpl) waitForFlushing() {
 		log.Info("Waiting buffer is flushed")
 		<-time.After(time.Millisecond)
 	}
-	for {
-		w.writeInfoCh <- writeBuffInfoReq{}
-		writeBuffInfo := <-w.writeInfoCh
-		if writeBuffInfo.writeBuffLen == 0 {
-			break
-		}
+	for atomic.LoadInt32(&w.pendingBatches) > 0 {
 		log.Info("Waiting buffer is flushed")
 		<-time.After(time.Millisecond)
 	}
@@ -145,9 +387,21 @@ func (w *WriteAPIImpl) bufferProc() {
 x:
 	for {
 		select {
-		case line := <-w.bufferCh:
-			w.writeBuffer = append(w.writeBuffer, line)
-			if len(w.writeBuffer) == int(w.writeOptions.BatchSize()) {
+		case item := <-w.bufferCh:
+			maxBytes := int(w.writeOptions.MaxBatchBytes())
+			if maxBytes > 0 && w.writeBufferBytes+len(item.line) > maxBytes {
+				// line doesn't fit into the current batch
+				w.flushBuffer()
+			}
+			w.writeBuffer = append(w.writeBuffer, item.line)
+			w.writeBufferBytes += len(item.line)
+			if item.ack != nil {
+				w.writeAcks = append(w.writeAcks, item.ack)
+			}
+			if item.spanContext.IsValid() {
+				w.writeSpans = append(w.writeSpans, item.spanContext)
+			}
+			if len(w.writeBuffer) == int(w.writeOptions.BatchSize()) || (maxBytes > 0 && w.writeBufferBytes >= maxBytes) {
 				w.flushBuffer()
 			}
 		case <-ticker.C:
@@ -171,8 +425,18 @@ func (w *WriteAPIImpl) flushBuffer() {
 	if len(w.writeBuffer) > 0 {
 		log.Info("sending batch")
 		batch := iwrite.NewBatch(buffer(w.writeBuffer), w.writeOptions.MaxRetryTime())
+		if len(w.writeAcks) > 0 {
+			batch.Acks = w.writeAcks
+			w.writeAcks = nil
+		}
+		if len(w.writeSpans) > 0 {
+			batch.SpanContexts = w.writeSpans
+			w.writeSpans = nil
+		}
+		atomic.AddInt32(&w.pendingBatches, 1)
 		w.writeCh <- batch
 		w.writeBuffer = w.writeBuffer[:0]
+		w.writeBufferBytes = 0
 	}
 }
 func (w *WriteAPIImpl) isErrChanRead() bool {
@@ -183,40 +447,94 @@ func (w *WriteAPIImpl) setErrChanRead() {
 	atomic.StoreInt32(&w.isErrChReader, 1)
 }
 
-func (w *WriteAPIImpl) writeProc() {
+// writeProc is a write worker, which writes batches received from the buffer using service.
+// If replay is true, it starts with writing batches persisted in the retry queue by a previous instance.
+func (w *WriteAPIImpl) writeProc(service *iwrite.Service, replay bool) {
 	log.Info("Write proc started")
+	if replay {
+		w.handleWrite(service, nil)
+		atomic.AddInt32(&w.pendingBatches, -1)
+	}
 x:
 	for {
 		select {
 		case batch := <-w.writeCh:
-			err := w.service.HandleWrite(context.Background(), batch)
-			if err != nil && w.isErrChanRead() {
-				select {
-				case w.errCh <- err:
-				default:
-					log.Warn("Cannot write error to error channel, it is not read")
-				}
-			}
+			w.handleWrite(service, batch)
+			atomic.AddInt32(&w.pendingBatches, -1)
 		case <-w.writeStop:
 			log.Info("Write proc: received stop")
 			break x
-		case buffInfo := <-w.writeInfoCh:
-			buffInfo.writeBuffLen = len(w.writeCh)
-			w.writeInfoCh <- buffInfo
 		}
 	}
 	log.Info("Write proc finished")
 	w.doneCh <- struct{}{}
 }
 
+func (w *WriteAPIImpl) handleWrite(service *iwrite.Service, batch *iwrite.Batch) {
+	if err := service.HandleWrite(w.ctx, batch); err != nil {
+		w.reportError(err)
+	}
+}
+
+// reportError sends err to the Errors channel, if it is read, without blocking
+func (w *WriteAPIImpl) reportError(err error) {
+	if w.isErrChanRead() {
+		select {
+		case w.errCh <- err:
+		default:
+			log.Warn("Cannot write error to error channel, it is not read")
+		}
+	}
+}
+
+// queueError stores err of the retry queue setup to the error channel, so that it is received by the first reader of Errors.
+// It doesn't block if the channel already holds an error.
+func (w *WriteAPIImpl) queueError(err error) {
+	select {
+	case w.errCh <- err:
+	default:
+	}
+}
+
 // Close finishes outstanding write operations,
 // stop background routines and closes all channels
 func (w *WriteAPIImpl) Close() {
+	_, _ = w.CloseWithContext(context.Background())
+}
+
+// CloseWithContext finishes outstanding write operations, stops background routines and closes all channels, the same way as Close.
+// Flushing of buffered and retried batches is interrupted when ctx is done, the remaining batches are discarded,
+// except for batches in the persistent retry queue. Discarded batches are passed to UndeliveredCallback.
+// It returns report of batches delivered and abandoned during closing, and ctx.Err() if flushing was interrupted.
+func (w *WriteAPIImpl) CloseWithContext(ctx context.Context) (write.ShutdownReport, error) {
 	w.closingMu.Lock()
 	defer w.closingMu.Unlock()
+	var report write.ShutdownReport
+	var err error
 	if w.writeCh != nil {
-		// Flush outstanding metrics
-		w.Flush()
+		atomic.StoreInt32(&w.closing, 1)
+		before := w.stats.Stats()
+
+		// Flush outstanding metrics, until ctx is done
+		flushed := make(chan struct{})
+		go func() {
+			w.Flush()
+			close(flushed)
+		}()
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			log.Warn("Shutdown deadline passed, abandoning remaining batches")
+			err = ctx.Err()
+			// interrupt ongoing writes and wait for the flush to finish
+			w.cancel()
+			<-flushed
+		}
+
+		// discard following writes, data already passed to the buffer are flushed by buffer proc
+		w.writeMu.Lock()
+		w.closed = true
+		w.writeMu.Unlock()
 
 		// stop and wait for buffer proc
 		close(w.bufferStop)
@@ -225,42 +543,182 @@ func (w *WriteAPIImpl) Close() {
 		close(w.bufferFlush)
 		close(w.bufferCh)
 
-		// stop and wait for write proc
+		// stop and wait for write procs
 		close(w.writeStop)
-		<-w.doneCh
+		for range w.services {
+			<-w.doneCh
+		}
 
 		close(w.writeCh)
-		close(w.writeInfoCh)
 		close(w.bufferInfoCh)
 		w.writeCh = nil
 
 		close(w.errCh)
 		w.errCh = nil
+
+		for _, s := range w.services {
+			report.PersistedBatches += s.PersistedBatches()
+			if err := s.Close(); err != nil {
+				log.Errorf("Error closing retry queue: %s", err.Error())
+			}
+		}
+		w.cancel()
+
+		after := w.stats.Stats()
+		report.DeliveredBatches = int(after.BatchesWritten - before.BatchesWritten)
+		report.DeliveredPoints = int(after.PointsWritten - before.PointsWritten)
+		report.AbandonedBatches = int(after.BatchesEvicted + after.BatchesExpired + after.BatchesDropped -
+			before.BatchesEvicted - before.BatchesExpired - before.BatchesDropped)
+		report.AbandonedPoints = int(after.PointsLost - before.PointsLost)
 	}
+	return report, err
 }
 
 // WriteRecord writes asynchronously line protocol record into bucket.
 // WriteRecord adds record into the buffer which is sent on the background when it reaches the batch size.
+// If record processing is enabled by write.Options.SetProcessRecords, invalid record is reported via the Errors channel.
 // Blocking alternative is available in the WriteAPIBlocking interface
 func (w *WriteAPIImpl) WriteRecord(line string) {
+	w.writeRecord(line, nil, trace.SpanContext{})
+}
+
+// WriteRecordWithAck writes asynchronously line protocol record into bucket, the same way as WriteRecord.
+// It returns acknowledgement with the correlation id, which is resolved when the batch with the record is written or discarded.
+func (w *WriteAPIImpl) WriteRecordWithAck(line string, id interface{}) *write.Ack {
+	ack := write.NewAck(id)
+	w.writeRecord(line, ack, trace.SpanContext{})
+	return ack
+}
+
+// WriteRecordWithContext writes asynchronously line protocol record into bucket, the same way as WriteRecord.
+// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the record is linked to the span in ctx.
+func (w *WriteAPIImpl) WriteRecordWithContext(ctx context.Context, line string) {
+	w.writeRecord(line, nil, w.spanContext(ctx))
+}
+
+// spanContext returns span context of ctx, which is linked from the span of the batch write, if tracing is enabled
+func (w *WriteAPIImpl) spanContext(ctx context.Context) trace.SpanContext {
+	if w.writeOptions.TracerProvider() == nil {
+		return trace.SpanContext{}
+	}
+	return trace.SpanContextFromContext(ctx)
+}
+
+// LastWriteTime returns time of the last call of a write method, or time of creation if nothing was written yet
+func (w *WriteAPIImpl) LastWriteTime() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&w.lastWrite))
+}
+
+// beginWrite returns false if WriteAPI is closed, otherwise the write must be finished by endWrite.
+// Data written after closing is discarded by discardClosed.
+func (w *WriteAPIImpl) beginWrite() bool {
+	w.writeMu.RLock()
+	if w.closed {
+		w.writeMu.RUnlock()
+		return false
+	}
+	atomic.StoreInt64(&w.lastWrite, time.Now().UnixNano())
+	return true
+}
+
+// endWrite finishes write started by beginWrite
+func (w *WriteAPIImpl) endWrite() {
+	w.writeMu.RUnlock()
+}
+
+// discardClosed resolves ack and passes batch written after closing to the dead letter sink, if set
+func (w *WriteAPIImpl) discardClosed(batch string, ack *write.Ack) {
+	log.Error("WriteAPI is closed, discarding data")
+	if ack != nil {
+		ack.Resolve(write.ErrWriteAPIClosed)
+	}
+	sink := w.writeOptions.DeadLetterSink()
+	if sink == nil || batch == "" {
+		return
+	}
+	letter := &write.DeadLetter{
+		Batch:  batch,
+		Reason: write.DeadLetterClosed,
+		Err:    write.ErrWriteAPIClosed,
+		Time:   time.Now(),
+	}
+	if err := sink.WriteDeadLetter(letter); err != nil {
+		log.Errorf("Cannot write dead letter: %s", err.Error())
+	}
+}
+
+func (w *WriteAPIImpl) writeRecord(line string, ack *write.Ack, spanContext trace.SpanContext) {
+	if !w.beginWrite() {
+		w.discardClosed(line+"\n", ack)
+		return
+	}
+	defer w.endWrite()
+	if w.writeOptions.ProcessRecords() {
+		encoded, err := w.service.EncodeRecords(line)
+		if err != nil {
+			log.Errorf("record parsing error: %s\n", err.Error())
+			w.encodingError(err, ack)
+			return
+		}
+		if encoded == "" {
+			// nothing to write
+			if ack != nil {
+				ack.Resolve(nil)
+			}
+			return
+		}
+		w.bufferCh <- bufferItem{line: encoded, ack: ack, spanContext: spanContext}
+		return
+	}
 	b := []byte(line)
 	b = append(b, 0xa)
-	w.bufferCh <- string(b)
+	w.bufferCh <- bufferItem{line: string(b), ack: ack, spanContext: spanContext}
 }
 
 // WritePoint writes asynchronously Point into bucket.
 // WritePoint adds Point into the buffer which is sent on the background when it reaches the batch size.
 // Blocking alternative is available in the WriteAPIBlocking interface
 func (w *WriteAPIImpl) WritePoint(point *write.Point) {
+	w.writePoint(point, nil, trace.SpanContext{})
+}
+
+// WritePointWithAck writes asynchronously Point into bucket, the same way as WritePoint.
+// It returns acknowledgement with the correlation id, which is resolved when the batch with the point is written or discarded.
+// Encoding error resolves the acknowledgement immediately.
+func (w *WriteAPIImpl) WritePointWithAck(point *write.Point, id interface{}) *write.Ack {
+	ack := write.NewAck(id)
+	w.writePoint(point, ack, trace.SpanContext{})
+	return ack
+}
+
+// WritePointWithContext writes asynchronously Point into bucket, the same way as WritePoint.
+// If tracing is enabled by write.Options.SetTracerProvider, the span of the write of the batch with the point is linked to the span in ctx.
+func (w *WriteAPIImpl) WritePointWithContext(ctx context.Context, point *write.Point) {
+	w.writePoint(point, nil, w.spanContext(ctx))
+}
+
+func (w *WriteAPIImpl) writePoint(point *write.Point, ack *write.Ack, spanContext trace.SpanContext) {
+	if !w.beginWrite() {
+		line, _ := w.service.EncodePoints(point)
+		w.discardClosed(line, ack)
+		return
+	}
+	defer w.endWrite()
 	line, err := w.service.EncodePoints(point)
 	if err != nil {
 		log.Errorf("point encoding error: %s\n", err.Error())
-		if w.errCh != nil {
-			w.errCh <- err
-		}
+		w.encodingError(err, ack)
 	} else {
-		w.bufferCh <- line
+		w.bufferCh <- bufferItem{line: line, ack: ack, spanContext: spanContext}
+	}
+}
+
+// encodingError resolves ack and reports err of data rejected before sending it to the buffer
+func (w *WriteAPIImpl) encodingError(err error, ack *write.Ack) {
+	if ack != nil {
+		ack.Resolve(err)
 	}
+	w.reportError(err)
 }
 
 func buffer(lines []string) string {
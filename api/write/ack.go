@@ -0,0 +1,106 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrBatchExpired resolves acknowledgements of a batch discarded from the retry queue after MaxRetryTime
+	ErrBatchExpired = errors.New("batch expired in retry queue")
+	// ErrWriteAPIClosed resolves acknowledgements of batches remaining in the retry queue when WriteAPI is closed,
+	// and of data written by WriteAPI after it was closed
+	ErrWriteAPIClosed = errors.New("write API closed before the batch was written")
+)
+
+// Ack is a delivery acknowledgement of data written asynchronously.
+// It is resolved when the batch containing the data is written to the server or discarded.
+type Ack struct {
+	id   interface{}
+	done chan struct{}
+	once sync.Once
+	err  error
+	// called when the acknowledgement is resolved
+	onResolve func(err error)
+}
+
+// NewAck returns unresolved acknowledgement with the correlation id
+func NewAck(id interface{}) *Ack {
+	return &Ack{id: id, done: make(chan struct{})}
+}
+
+// ID returns correlation id given when writing data
+func (a *Ack) ID() interface{} {
+	return a.id
+}
+
+// Done returns a channel, which is closed when the acknowledgement is resolved
+func (a *Ack) Done() <-chan struct{} {
+	return a.done
+}
+
+// Err returns nil if data was written, or the error why data was discarded.
+// It is valid only after the Done channel is closed.
+func (a *Ack) Err() error {
+	select {
+	case <-a.done:
+		return a.err
+	default:
+		return nil
+	}
+}
+
+// Wait waits until the acknowledgement is resolved and returns its error, or until ctx is done and returns ctx error.
+func (a *Ack) Wait(ctx context.Context) error {
+	select {
+	case <-a.done:
+		return a.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resolve resolves the acknowledgement with err, nil means the data was written.
+// Only the first call has effect.
+func (a *Ack) Resolve(err error) {
+	a.once.Do(func() {
+		a.err = err
+		close(a.done)
+		if a.onResolve != nil {
+			a.onResolve(err)
+		}
+	})
+}
+
+// joinAcks returns n new acknowledgements, which resolve parents when all of them are resolved.
+// Parents are resolved with the first error of the new acknowledgements, or with nil if there was none.
+func joinAcks(parents []*Ack, n int) []*Ack {
+	var lock sync.Mutex
+	remaining := n
+	var firstErr error
+	onResolve := func(err error) {
+		lock.Lock()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		remaining--
+		done := remaining == 0
+		lock.Unlock()
+		if done {
+			for _, p := range parents {
+				p.Resolve(firstErr)
+			}
+		}
+	}
+	acks := make([]*Ack, n)
+	for i := range acks {
+		acks[i] = NewAck(nil)
+		acks[i].onResolve = onResolve
+	}
+	return acks
+}
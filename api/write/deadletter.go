@@ -0,0 +1,297 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeadLetterReason is the reason why WriteAPI discarded a batch
+type DeadLetterReason int
+
+const (
+	// DeadLetterNotRetryable means the write failed with an error, which is not retryable, e.g. a partial write
+	DeadLetterNotRetryable DeadLetterReason = iota
+	// DeadLetterRetriesExhausted means the write failed with a retryable error, but the batch was not retried anymore,
+	// because the maximum number of retries was reached, or the retry policy or WriteFailedCallback discarded it
+	DeadLetterRetriesExhausted
+	// DeadLetterExpired means the maximum retry time of the batch elapsed
+	DeadLetterExpired
+	// DeadLetterEvicted means the batch was removed from the full retry queue to make space for newer batches
+	DeadLetterEvicted
+	// DeadLetterOverflow means the batch could not be stored into the full retry queue
+	DeadLetterOverflow
+	// DeadLetterClosed means WriteAPI was closed before the batch was written
+	DeadLetterClosed
+	// DeadLetterError means the batch was discarded because of another error, e.g. a failure of the retry queue
+	DeadLetterError
+)
+
+var deadLetterReasonNames = []string{"not_retryable", "retries_exhausted", "expired", "evicted", "overflow", "closed", "error"}
+
+// String returns name of the reason
+func (r DeadLetterReason) String() string {
+	if r < 0 || int(r) >= len(deadLetterReasonNames) {
+		return "unknown"
+	}
+	return deadLetterReasonNames[r]
+}
+
+// parseDeadLetterReason returns reason with the name, or DeadLetterError if the name is not known
+func parseDeadLetterReason(name string) DeadLetterReason {
+	for i, n := range deadLetterReasonNames {
+		if n == name {
+			return DeadLetterReason(i)
+		}
+	}
+	return DeadLetterError
+}
+
+// DeadLetter is a batch discarded by WriteAPI
+type DeadLetter struct {
+	// Lines of the batch
+	Batch string
+	// Why the batch was discarded
+	Reason DeadLetterReason
+	// The last error of a write of the batch, or the error causing discarding if the batch was not written yet. It can be nil.
+	Err error
+	// Number of retries of the batch
+	RetryAttempts uint
+	// Time when the batch was discarded
+	Time time.Time
+}
+
+// DeadLetterSink receives batches discarded by WriteAPI, set by Options.SetDeadLetterSink.
+// WriteDeadLetter is called synchronously by write goroutines, possibly concurrently. Returned error is logged.
+// Blocking writes don't use the sink, because their errors are returned to the caller.
+type DeadLetterSink interface {
+	WriteDeadLetter(letter *DeadLetter) error
+}
+
+// channelDeadLetterSink is DeadLetterSink sending dead letters to a channel
+type channelDeadLetterSink struct {
+	ch chan<- *DeadLetter
+}
+
+// NewChannelDeadLetterSink returns DeadLetterSink sending dead letters to ch.
+// Sending blocks writing until the dead letter is received, so ch must be read.
+func NewChannelDeadLetterSink(ch chan<- *DeadLetter) DeadLetterSink {
+	return &channelDeadLetterSink{ch: ch}
+}
+
+// WriteDeadLetter sends letter to the channel
+func (s *channelDeadLetterSink) WriteDeadLetter(letter *DeadLetter) error {
+	s.ch <- letter
+	return nil
+}
+
+const (
+	// deadLetterExt is extension of dead letter files
+	deadLetterExt = ".lp"
+	// deadLetterHeader starts comment line with information about a dead letter, which is followed by lines of the batch
+	deadLetterHeader = "# dead letter:"
+)
+
+// FileDeadLetterSink is DeadLetterSink appending dead letters to line protocol files in a directory.
+// Each batch is preceded by a comment line with the reason, retry attempts, time and error.
+// When the current file reaches the maximum size, a new file is started. Files are named by increasing sequence numbers.
+// Files can be read by ReadDeadLetterFile and replayed by api.ReplayDeadLetterFile.
+type FileDeadLetterSink struct {
+	dir         string
+	maxFileSize int64
+	lock        sync.Mutex
+	file        *os.File
+	size        int64
+	seq         uint64
+}
+
+// NewFileDeadLetterSink creates FileDeadLetterSink writing to dir, which is created if it doesn't exist.
+// New file is started when size of the current file would exceed maxFileSize, zero value means no limit.
+// Files left by previous instances are not modified.
+func NewFileDeadLetterSink(dir string, maxFileSize int64) (*FileDeadLetterSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileDeadLetterSink{dir: dir, maxFileSize: maxFileSize}
+	files, err := s.Files()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		s.seq, _ = strconv.ParseUint(strings.TrimSuffix(filepath.Base(files[len(files)-1]), deadLetterExt), 10, 64)
+	}
+	return s, nil
+}
+
+// Files returns sorted paths of dead letter files in the directory
+func (s *FileDeadLetterSink) Files() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, deadLetterExt) {
+			continue
+		}
+		if _, err := strconv.ParseUint(strings.TrimSuffix(name, deadLetterExt), 10, 64); err != nil {
+			continue
+		}
+		files = append(files, filepath.Join(s.dir, name))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// WriteDeadLetter appends letter to the current file and syncs it to disk
+func (s *FileDeadLetterSink) WriteDeadLetter(letter *DeadLetter) error {
+	entry := formatDeadLetter(letter)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file != nil && s.maxFileSize > 0 && s.size+int64(len(entry)) > s.maxFileSize {
+		if err := s.closeFile(); err != nil {
+			return err
+		}
+	}
+	if s.file == nil {
+		s.seq++
+		f, err := os.OpenFile(filepath.Join(s.dir, fmt.Sprintf("%020d%s", s.seq, deadLetterExt)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = f
+		s.size = 0
+	}
+	n, err := io.WriteString(s.file, entry)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// Close closes the current file
+func (s *FileDeadLetterSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closeFile()
+}
+
+func (s *FileDeadLetterSink) closeFile() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// formatDeadLetter returns header line followed by lines of the batch
+func formatDeadLetter(letter *DeadLetter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s reason=%s attempts=%d time=%s", deadLetterHeader, letter.Reason, letter.RetryAttempts, letter.Time.UTC().Format(time.RFC3339Nano))
+	if letter.Err != nil {
+		fmt.Fprintf(&b, " error=%s", strconv.Quote(letter.Err.Error()))
+	}
+	b.WriteString("\n")
+	b.WriteString(letter.Batch)
+	if !strings.HasSuffix(letter.Batch, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// parseDeadLetterHeader fills letter with information from header line
+func parseDeadLetterHeader(header string, letter *DeadLetter) {
+	rest := strings.TrimSpace(strings.TrimPrefix(header, deadLetterHeader))
+	for rest != "" {
+		if strings.HasPrefix(rest, "error=") {
+			// error is the last field
+			if msg, err := strconv.Unquote(strings.TrimPrefix(rest, "error=")); err == nil {
+				letter.Err = errors.New(msg)
+			}
+			return
+		}
+		field := rest
+		rest = ""
+		if i := strings.IndexByte(field, ' '); i >= 0 {
+			field, rest = field[:i], field[i+1:]
+		}
+		key, value := field, ""
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			key, value = field[:i], field[i+1:]
+		}
+		switch key {
+		case "reason":
+			letter.Reason = parseDeadLetterReason(value)
+		case "attempts":
+			attempts, _ := strconv.ParseUint(value, 10, 32)
+			letter.RetryAttempts = uint(attempts)
+		case "time":
+			letter.Time, _ = time.Parse(time.RFC3339Nano, value)
+		}
+	}
+}
+
+// ReadDeadLetterFile reads dead letters from a file written by FileDeadLetterSink.
+// Errors of dead letters are restored only as messages.
+func ReadDeadLetterFile(path string) ([]*DeadLetter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var letters []*DeadLetter
+	var letter *DeadLetter
+	var lines strings.Builder
+	// finish adds lines read so far to the actual letter
+	finish := func() {
+		if letter != nil && lines.Len() > 0 {
+			letter.Batch = lines.String()
+			letters = append(letters, letter)
+		}
+		lines.Reset()
+	}
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line != "" {
+			switch {
+			case strings.HasPrefix(line, deadLetterHeader):
+				finish()
+				letter = &DeadLetter{}
+				parseDeadLetterHeader(strings.TrimRight(line, "\r\n"), letter)
+			case strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "":
+				// other comments and empty lines are skipped
+			default:
+				if letter == nil {
+					// lines without header
+					letter = &DeadLetter{Reason: DeadLetterError}
+				}
+				lines.WriteString(strings.TrimRight(line, "\r\n"))
+				lines.WriteString("\n")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	finish()
+	return letters, nil
+}
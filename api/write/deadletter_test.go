@@ -0,0 +1,82 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadLetterReason(t *testing.T) {
+	assert.Equal(t, "not_retryable", write.DeadLetterNotRetryable.String())
+	assert.Equal(t, "retries_exhausted", write.DeadLetterRetriesExhausted.String())
+	assert.Equal(t, "closed", write.DeadLetterClosed.String())
+	assert.Equal(t, "unknown", write.DeadLetterReason(100).String())
+}
+
+func TestFileDeadLetterSink(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := write.NewFileDeadLetterSink(dir, 250)
+	require.NoError(t, err)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	letters := []*write.DeadLetter{
+		{Batch: "a f=1i 1\na f=2i 2\n", Reason: write.DeadLetterRetriesExhausted, Err: errors.New("service unavailable\nretry later"), RetryAttempts: 5, Time: now},
+		{Batch: "a f=3i 3", Reason: write.DeadLetterExpired, RetryAttempts: 2, Time: now},
+		{Batch: "a f=4i 4\n", Reason: write.DeadLetterClosed, Err: errors.New(`write API "closed"`), Time: now},
+	}
+	for _, l := range letters {
+		require.NoError(t, sink.WriteDeadLetter(l))
+	}
+	require.NoError(t, sink.Close())
+	files, err := sink.Files()
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, filepath.Join(dir, "00000000000000000001.lp"), files[0])
+
+	read, err := write.ReadDeadLetterFile(files[0])
+	require.NoError(t, err)
+	require.Len(t, read, 2)
+	assert.Equal(t, letters[0], read[0])
+	assert.Equal(t, "a f=3i 3\n", read[1].Batch)
+	assert.Equal(t, write.DeadLetterExpired, read[1].Reason)
+	assert.EqualValues(t, 2, read[1].RetryAttempts)
+	assert.Nil(t, read[1].Err)
+	read, err = write.ReadDeadLetterFile(files[1])
+	require.NoError(t, err)
+	require.Len(t, read, 1)
+	assert.Equal(t, letters[2], read[0])
+
+	// new sink continues with the next file
+	sink, err = write.NewFileDeadLetterSink(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, sink.WriteDeadLetter(letters[1]))
+	require.NoError(t, sink.Close())
+	files, err = sink.Files()
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+
+	// lines without header are read as well
+	path := filepath.Join(dir, "manual.lp")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\na f=5i 5\n\na f=6i 6"), 0o644))
+	read, err = write.ReadDeadLetterFile(path)
+	require.NoError(t, err)
+	require.Len(t, read, 1)
+	assert.Equal(t, "a f=5i 5\na f=6i 6\n", read[0].Batch)
+}
+
+func TestChannelDeadLetterSink(t *testing.T) {
+	ch := make(chan *write.DeadLetter, 1)
+	sink := write.NewChannelDeadLetterSink(ch)
+	letter := &write.DeadLetter{Batch: "a f=1i\n", Reason: write.DeadLetterEvicted}
+	require.NoError(t, sink.WriteDeadLetter(letter))
+	assert.Equal(t, letter, <-ch)
+}
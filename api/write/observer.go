@@ -0,0 +1,110 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"time"
+)
+
+// Observer is notified about the lifecycle of batches written by WriteAPI and WriteAPIBlocking.
+// Methods are called synchronously by write goroutines, possibly concurrently, so they must be fast and safe for concurrent use.
+// Embed NoopObserver to implement only some methods.
+type Observer interface {
+	// BatchCreated is called when a new batch is created from the write buffer
+	BatchCreated(batch *Batch)
+	// BatchSent is called after each write request with the batch, with duration of the request,
+	// size of the batch in bytes before compression and the error of the request, or nil if it succeeded
+	BatchSent(batch *Batch, latency time.Duration, bytes int, err error)
+	// BatchSucceeded is called when the batch is written
+	BatchSucceeded(batch *Batch)
+	// BatchRetried is called when the write of the batch failed with err and the batch is kept for retrying
+	BatchRetried(batch *Batch, err error)
+	// BatchEvicted is called when the batch is removed from the full retry queue to make space for newer batches
+	BatchEvicted(batch *Batch)
+	// BatchExpired is called when the batch is discarded, because its maximum retry time elapsed
+	BatchExpired(batch *Batch)
+	// BatchDropped is called when the batch is discarded because of err, e.g. when the write failed with a not retryable error
+	BatchDropped(batch *Batch, err error)
+}
+
+// NoopObserver is Observer with methods doing nothing
+type NoopObserver struct{}
+
+// BatchCreated does nothing
+func (NoopObserver) BatchCreated(*Batch) {}
+
+// BatchSent does nothing
+func (NoopObserver) BatchSent(*Batch, time.Duration, int, error) {}
+
+// BatchSucceeded does nothing
+func (NoopObserver) BatchSucceeded(*Batch) {}
+
+// BatchRetried does nothing
+func (NoopObserver) BatchRetried(*Batch, error) {}
+
+// BatchEvicted does nothing
+func (NoopObserver) BatchEvicted(*Batch) {}
+
+// BatchExpired does nothing
+func (NoopObserver) BatchExpired(*Batch) {}
+
+// BatchDropped does nothing
+func (NoopObserver) BatchDropped(*Batch, error) {}
+
+// multiObserver notifies several observers
+type multiObserver []Observer
+
+// NewMultiObserver returns Observer notifying all non-nil observers in the given order
+func NewMultiObserver(observers ...Observer) Observer {
+	m := make(multiObserver, 0, len(observers))
+	for _, o := range observers {
+		if o != nil {
+			m = append(m, o)
+		}
+	}
+	return m
+}
+
+func (m multiObserver) BatchCreated(batch *Batch) {
+	for _, o := range m {
+		o.BatchCreated(batch)
+	}
+}
+
+func (m multiObserver) BatchSent(batch *Batch, latency time.Duration, bytes int, err error) {
+	for _, o := range m {
+		o.BatchSent(batch, latency, bytes, err)
+	}
+}
+
+func (m multiObserver) BatchSucceeded(batch *Batch) {
+	for _, o := range m {
+		o.BatchSucceeded(batch)
+	}
+}
+
+func (m multiObserver) BatchRetried(batch *Batch, err error) {
+	for _, o := range m {
+		o.BatchRetried(batch, err)
+	}
+}
+
+func (m multiObserver) BatchEvicted(batch *Batch) {
+	for _, o := range m {
+		o.BatchEvicted(batch)
+	}
+}
+
+func (m multiObserver) BatchExpired(batch *Batch) {
+	for _, o := range m {
+		o.BatchExpired(batch)
+	}
+}
+
+func (m multiObserver) BatchDropped(batch *Batch, err error) {
+	for _, o := range m {
+		o.BatchDropped(batch, err)
+	}
+}
@@ -6,12 +6,16 @@ package write
 
 import (
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Options holds write configuration properties
 type Options struct {
 	// Maximum number of points sent to server in single request. Default 5000
 	batchSize uint
+	// Maximum size of batch in bytes. Default 0, batches are limited only by batchSize
+	maxBatchBytes uint
 	// Interval, in ms, in which is buffer flushed if it has not been already written (by reaching batch size) . Default 1000ms
 	flushInterval uint
 	// Precision to use in writes for timestamp. In unit of duration: time.Nanosecond, time.Microsecond, time.Millisecond, time.Second
@@ -27,6 +31,10 @@ type Options struct {
 	maxRetries uint
 	// Maximum number of points to keep for retry. Should be multiple of BatchSize. Default 50,000.
 	retryBufferLimit uint
+	// Maximum total size in bytes of batches kept for retry. If set, it is used instead of retryBufferLimit. Default 0
+	retryBufferLimitBytes uint
+	// What to do with a batch that doesn't fit into the full retry buffer. Default OverflowDropOldest
+	overflowPolicy OverflowPolicy
 	// The maximum delay between each retry attempt in milliseconds, default 125,000.
 	maxRetryInterval uint
 	// The maximum total retry timeout in millisecond, default 180,000.
@@ -35,6 +43,26 @@ type Options struct {
 	exponentialBase uint
 	// InfluxDB Enterprise write consistency as explained in https://docs.influxdata.com/enterprise_influxdb/v1.9/concepts/clustering/#write-consistency
 	consistency Consistency
+	// Directory where batches waiting for retry are persisted. Default "", retry queue is kept only in memory
+	retryQueueDir string
+	// Number of workers of WriteAPI sending batches concurrently. Default 1
+	concurrency uint
+	// Whether line protocol records are parsed, validated and extended with default tags before writing. Default false
+	processRecords bool
+	// Precision of timestamps in line protocol records, used when records are processed. Default 0, the same as precision
+	recordPrecision time.Duration
+	// Decides about retrying of failed writes. Default nil, DefaultRetryPolicy is used
+	retryPolicy RetryPolicy
+	// DefaultRetryPolicy configured by these options, used if retryPolicy is nil
+	defaultRetryPolicy *DefaultRetryPolicy
+	// Notified about the lifecycle of written batches. Default nil
+	observer Observer
+	// Provider of tracer tracing writes of batches. Default nil, writes are not traced
+	tracerProvider trace.TracerProvider
+	// Receives batches discarded by WriteAPI. Default nil, discarded batches are only logged
+	deadLetterSink DeadLetterSink
+	// limiter pacing writes of batches
+	rateLimiter *RateLimiter
 }
 
 const (
@@ -65,6 +93,19 @@ func (o *Options) SetBatchSize(batchSize uint) *Options {
 	return o
 }
 
+// MaxBatchBytes returns maximum size of batch in bytes, or 0 if not set
+func (o *Options) MaxBatchBytes() uint {
+	return o.maxBatchBytes
+}
+
+// SetMaxBatchBytes sets maximum size in bytes of line protocol sent in single request.
+// A batch is sent when it reaches either the batch size or this size. A line larger than the limit is sent in a batch alone.
+// Setting zero value (default) means batches are limited only by BatchSize.
+func (o *Options) SetMaxBatchBytes(maxBatchBytes uint) *Options {
+	o.maxBatchBytes = maxBatchBytes
+	return o
+}
+
 // FlushInterval returns flush interval in ms
 func (o *Options) FlushInterval() uint {
 	return o.flushInterval
@@ -110,6 +151,30 @@ func (o *Options) SetRetryBufferLimit(retryBufferLimit uint) *Options {
 	return o
 }
 
+// RetryBufferLimitBytes returns maximum total size in bytes of batches kept for retry, or 0 if not set.
+func (o *Options) RetryBufferLimitBytes() uint {
+	return o.retryBufferLimitBytes
+}
+
+// SetRetryBufferLimitBytes sets maximum total size in bytes of batches kept for retry.
+// If set, the retry buffer is limited by size of batches instead of number of points set by SetRetryBufferLimit.
+// Setting zero value (default) means the retry buffer is limited by RetryBufferLimit.
+func (o *Options) SetRetryBufferLimitBytes(retryBufferLimitBytes uint) *Options {
+	o.retryBufferLimitBytes = retryBufferLimitBytes
+	return o
+}
+
+// OverflowPolicy returns policy for batches that don't fit into the full retry buffer. Default OverflowDropOldest.
+func (o *Options) OverflowPolicy() OverflowPolicy {
+	return o.overflowPolicy
+}
+
+// SetOverflowPolicy sets what happens with a batch that doesn't fit into the full retry buffer.
+func (o *Options) SetOverflowPolicy(overflowPolicy OverflowPolicy) *Options {
+	o.overflowPolicy = overflowPolicy
+	return o
+}
+
 // MaxRetryInterval returns the maximum delay between each retry attempt in milliseconds, default 125,000.
 func (o *Options) MaxRetryInterval() uint {
 	return o.maxRetryInterval
@@ -192,8 +257,141 @@ func (o *Options) SetConsistency(consistency Consistency) *Options {
 	return o
 }
 
+// RetryQueueDir returns directory where the retry queue of WriteAPI is persisted. Empty, if retry queue is kept in memory.
+func (o *Options) RetryQueueDir() string {
+	return o.retryQueueDir
+}
+
+// SetRetryQueueDir sets directory where WriteAPI persists batches waiting for retry.
+// Persisted batches survive restart or crash of the application and are written again
+// when a WriteAPI for the same org and bucket is created.
+// Each org/bucket pair uses its own subdirectory. Setting empty value (default) keeps retry queue only in memory.
+// Expiration and retry attempts of batches are persisted too, so the retry limits apply across restarts.
+// To keep batches during outages longer than the default limits allow, raise MaxRetryTime to the longest expected outage
+// and MaxRetries to at least MaxRetryTime divided by MaxRetryInterval.
+// If the directory cannot be used, WriteAPI keeps the retry queue in memory and reports the error by its Errors channel.
+func (o *Options) SetRetryQueueDir(dir string) *Options {
+	o.retryQueueDir = dir
+	return o
+}
+
+// Concurrency returns number of workers of WriteAPI sending batches concurrently. Default 1.
+func (o *Options) Concurrency() uint {
+	return o.concurrency
+}
+
+// SetConcurrency sets number of workers of WriteAPI sending batches concurrently.
+// Each worker has its own retry queue and retries its batches in order, so the order of batches is kept only within a worker.
+// With a persistent retry queue, batches persisted by workers, which are not used after lowering the concurrency, are retried by the first worker.
+// Setting zero value means 1.
+func (o *Options) SetConcurrency(concurrency uint) *Options {
+	o.concurrency = concurrency
+	return o
+}
+
+// ProcessRecords returns true if line protocol records are parsed, validated and extended with default tags before writing
+func (o *Options) ProcessRecords() bool {
+	return o.processRecords
+}
+
+// SetProcessRecords specifies whether line protocol records passed to WriteRecord are parsed before writing.
+// Processed records are validated, default tags not present in a record are added to it,
+// and timestamps are converted from RecordPrecision to Precision.
+// Invalid records are rejected and not sent to the server.
+// Default false, records are sent unchanged.
+func (o *Options) SetProcessRecords(processRecords bool) *Options {
+	o.processRecords = processRecords
+	return o
+}
+
+// RecordPrecision returns precision of timestamps in line protocol records. Zero value means the same precision as Precision.
+func (o *Options) RecordPrecision() time.Duration {
+	return o.recordPrecision
+}
+
+// SetRecordPrecision sets precision of timestamps in line protocol records passed to WriteRecord, when records are processed.
+// In unit of duration: time.Nanosecond, time.Microsecond, time.Millisecond, time.Second.
+// Setting zero value (default) means records use the same precision as set by SetPrecision.
+func (o *Options) SetRecordPrecision(precision time.Duration) *Options {
+	o.recordPrecision = precision
+	return o
+}
+
+// RetryPolicy returns policy deciding about retrying of failed writes. Default is DefaultRetryPolicy configured by these options.
+func (o *Options) RetryPolicy() RetryPolicy {
+	switch {
+	case o.retryPolicy != nil:
+		return o.retryPolicy
+	case o.defaultRetryPolicy != nil:
+		return o.defaultRetryPolicy
+	default:
+		return NewDefaultRetryPolicy(o)
+	}
+}
+
+// SetRetryPolicy sets policy deciding about retrying of failed writes of WriteAPI.
+// If set, retry related options, such as MaxRetries or RetryInterval, are used only if the policy uses them.
+// Setting nil value means DefaultRetryPolicy.
+func (o *Options) SetRetryPolicy(retryPolicy RetryPolicy) *Options {
+	o.retryPolicy = retryPolicy
+	return o
+}
+
+// Observer returns observer notified about the lifecycle of written batches, or nil if not set
+func (o *Options) Observer() Observer {
+	return o.observer
+}
+
+// SetObserver sets observer notified about the lifecycle of batches written by WriteAPI and WriteAPIBlocking.
+// It must be set before the write APIs are created.
+func (o *Options) SetObserver(observer Observer) *Options {
+	o.observer = observer
+	return o
+}
+
+// TracerProvider returns provider of OpenTelemetry tracer tracing writes of batches, or nil if not set
+func (o *Options) TracerProvider() trace.TracerProvider {
+	return o.tracerProvider
+}
+
+// SetTracerProvider sets provider of OpenTelemetry tracer creating a span for each write of a batch.
+// Spans of batches written by WriteAPI are linked to the spans of contexts passed to WritePointWithContext and WriteRecordWithContext.
+// Setting nil value (default) disables tracing. It must be set before the write APIs are created.
+func (o *Options) SetTracerProvider(tracerProvider trace.TracerProvider) *Options {
+	o.tracerProvider = tracerProvider
+	return o
+}
+
+// DeadLetterSink returns sink receiving batches discarded by WriteAPI, or nil if not set
+func (o *Options) DeadLetterSink() DeadLetterSink {
+	return o.deadLetterSink
+}
+
+// SetDeadLetterSink sets sink receiving batches, which WriteAPI discards because of not retryable errors,
+// exhausted retries, expiration, overflow of the retry queue or closing.
+// Setting nil value (default) means discarded batches are only logged. It must be set before the write APIs are created.
+func (o *Options) SetDeadLetterSink(sink DeadLetterSink) *Options {
+	o.deadLetterSink = sink
+	return o
+}
+
+// RateLimiter returns limiter pacing writes of batches, or nil if not set
+func (o *Options) RateLimiter() *RateLimiter {
+	return o.rateLimiter
+}
+
+// SetRateLimiter sets limiter pacing writes of batches by WriteAPI and WriteAPIBlocking to the rates of points and bytes per second,
+// and adapting to writes throttled by the server. The limiter is shared by all write APIs created with the options.
+// Setting nil value (default) disables rate limiting. It must be set before the write APIs are created.
+func (o *Options) SetRateLimiter(limiter *RateLimiter) *Options {
+	o.rateLimiter = limiter
+	return o
+}
+
 // DefaultOptions returns Options object with default values
 func DefaultOptions() *Options {
-	return &Options{batchSize: 5_000, flushInterval: 1_000, precision: time.Nanosecond, useGZip: false, retryBufferLimit: 50_000, defaultTags: make(map[string]string),
-		maxRetries: 5, retryInterval: 5_000, maxRetryInterval: 125_000, maxRetryTime: 180_000, exponentialBase: 2}
+	o := &Options{batchSize: 5_000, flushInterval: 1_000, precision: time.Nanosecond, useGZip: false, retryBufferLimit: 50_000, defaultTags: make(map[string]string),
+		maxRetries: 5, retryInterval: 5_000, maxRetryInterval: 125_000, maxRetryTime: 180_000, exponentialBase: 2, concurrency: 1}
+	o.defaultRetryPolicy = NewDefaultRetryPolicy(o)
+	return o
 }
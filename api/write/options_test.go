@@ -10,31 +10,50 @@ import (
 	"time"
 
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestDefaultOptions(t *testing.T) {
 	opts := write.DefaultOptions()
 	assert.EqualValues(t, 5_000, opts.BatchSize())
+	assert.EqualValues(t, 0, opts.MaxBatchBytes())
 	assert.EqualValues(t, false, opts.UseGZip())
 	assert.EqualValues(t, 1_000, opts.FlushInterval())
 	assert.EqualValues(t, time.Nanosecond, opts.Precision())
 	assert.EqualValues(t, 50_000, opts.RetryBufferLimit())
+	assert.EqualValues(t, 0, opts.RetryBufferLimitBytes())
+	assert.Equal(t, write.OverflowDropOldest, opts.OverflowPolicy())
 	assert.EqualValues(t, 5_000, opts.RetryInterval())
 	assert.EqualValues(t, 5, opts.MaxRetries())
 	assert.EqualValues(t, 125_000, opts.MaxRetryInterval())
 	assert.EqualValues(t, 180_000, opts.MaxRetryTime())
 	assert.EqualValues(t, 2, opts.ExponentialBase())
 	assert.EqualValues(t, "", opts.Consistency())
+	assert.EqualValues(t, "", opts.RetryQueueDir())
+	assert.EqualValues(t, 1, opts.Concurrency())
+	assert.False(t, opts.ProcessRecords())
+	assert.EqualValues(t, 0, opts.RecordPrecision())
+	assert.IsType(t, &write.DefaultRetryPolicy{}, opts.RetryPolicy())
+	assert.Same(t, opts.RetryPolicy(), opts.RetryPolicy())
+	assert.Nil(t, opts.Observer())
+	assert.Nil(t, opts.TracerProvider())
+	assert.Nil(t, opts.DeadLetterSink())
+	assert.Nil(t, opts.RateLimiter())
 	assert.Len(t, opts.DefaultTags(), 0)
 }
 
 func TestSettingsOptions(t *testing.T) {
+	sink := write.NewChannelDeadLetterSink(make(chan *write.DeadLetter))
+	limiter := write.NewRateLimiter(1_000, 0)
 	opts := write.DefaultOptions().
 		SetBatchSize(5).
+		SetMaxBatchBytes(1_000_000).
 		SetUseGZip(true).
 		SetFlushInterval(5_000).
 		SetPrecision(time.Millisecond).
 		SetRetryBufferLimit(5).
+		SetRetryBufferLimitBytes(1_000_000).
+		SetOverflowPolicy(write.OverflowBlock).
 		SetRetryInterval(1_000).
 		SetMaxRetries(7).
 		SetMaxRetryInterval(150_000).
@@ -42,17 +61,38 @@ func TestSettingsOptions(t *testing.T) {
 		SetMaxRetryTime(200_000).
 		AddDefaultTag("a", "1").
 		AddDefaultTag("b", "2").
-		SetConsistency(write.ConsistencyOne)
+		SetConsistency(write.ConsistencyOne).
+		SetRetryQueueDir("/tmp/influx").
+		SetConcurrency(4).
+		SetProcessRecords(true).
+		SetRecordPrecision(time.Second).
+		SetRetryPolicy(write.NewFixedIntervalRetryPolicy(1_000, 3)).
+		SetObserver(write.NoopObserver{}).
+		SetTracerProvider(trace.NewNoopTracerProvider()).
+		SetDeadLetterSink(sink).
+		SetRateLimiter(limiter)
 	assert.EqualValues(t, 5, opts.BatchSize())
+	assert.EqualValues(t, 1_000_000, opts.MaxBatchBytes())
 	assert.EqualValues(t, true, opts.UseGZip())
 	assert.EqualValues(t, 5000, opts.FlushInterval())
 	assert.EqualValues(t, time.Millisecond, opts.Precision())
 	assert.EqualValues(t, 5, opts.RetryBufferLimit())
+	assert.EqualValues(t, 1_000_000, opts.RetryBufferLimitBytes())
+	assert.Equal(t, write.OverflowBlock, opts.OverflowPolicy())
 	assert.EqualValues(t, 1000, opts.RetryInterval())
 	assert.EqualValues(t, 7, opts.MaxRetries())
 	assert.EqualValues(t, 150_000, opts.MaxRetryInterval())
 	assert.EqualValues(t, 200_000, opts.MaxRetryTime())
 	assert.EqualValues(t, 3, opts.ExponentialBase())
 	assert.EqualValues(t, "one", opts.Consistency())
+	assert.EqualValues(t, "/tmp/influx", opts.RetryQueueDir())
+	assert.EqualValues(t, 4, opts.Concurrency())
+	assert.True(t, opts.ProcessRecords())
+	assert.EqualValues(t, time.Second, opts.RecordPrecision())
+	assert.Equal(t, write.NewFixedIntervalRetryPolicy(1_000, 3), opts.RetryPolicy())
+	assert.Equal(t, write.NoopObserver{}, opts.Observer())
+	assert.Equal(t, trace.NewNoopTracerProvider(), opts.TracerProvider())
+	assert.Equal(t, sink, opts.DeadLetterSink())
+	assert.Equal(t, limiter, opts.RateLimiter())
 	assert.Len(t, opts.DefaultTags(), 2)
 }
@@ -0,0 +1,49 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// RejectedLine describes a line of a batch rejected by the server
+type RejectedLine struct {
+	// Number of the line in the batch, starting from 1. Zero if the server didn't report the line.
+	Number int
+	// Line protocol text of the rejected line. Empty if the line is not known.
+	Line string
+	// Reason of the rejection reported by the server, e.g. field type conflict
+	Reason string
+}
+
+// PartialWriteError is an error of a write in which the server rejected some or all lines of a batch
+// because of their content, such as field type conflict, invalid line protocol or points beyond retention policy.
+// Such batch is never retried.
+// It is nested in the http.Error returned by writes, use errors.As to obtain it.
+type PartialWriteError struct {
+	// HTTP status code of the response
+	StatusCode int
+	// Error code returned by the server
+	Code string
+	// Error message returned by the server
+	Message string
+	// Number of points dropped by the server, if reported by the server, otherwise 0
+	Dropped int
+	// Rejected lines found in the server response
+	Rejected []RejectedLine
+}
+
+// Error fulfils error interface
+func (e *PartialWriteError) Error() string {
+	switch {
+	case e.Code != "" && e.Message != "":
+		return fmt.Sprintf("%s: %s", e.Code, e.Message)
+	case e.Message != "":
+		return e.Message
+	default:
+		return "Unexpected status code " + strconv.Itoa(e.StatusCode)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// throttledFactor multiplies the rate factor when the server throttles writes
+	throttledFactor = 0.5
+	// minRateFactor is the lowest fraction of the configured rates used after throttling
+	minRateFactor = 0.05
+	// recoveryStep is the fraction of the configured rates restored by each successful write
+	recoveryStep = 0.05
+)
+
+// RateLimiter paces writes of batches by token buckets of points and bytes per second, set by Options.SetRateLimiter.
+// A batch waits until the rates allow sending it, which blocks the write worker and, as a consequence,
+// WritePoint and WriteRecord calls once the WriteAPI buffer is full. Bursts are limited to one second of the rates.
+// When the server throttles writes with status 429, the rates are halved down to 5% of the configured ones
+// and writes are paused for the time given by the Retry-After header. Each successful write restores 5% of the configured rates.
+// A single RateLimiter can be shared by several write clients, e.g. writing to buckets of an organization with a write quota.
+type RateLimiter struct {
+	pointsPerSecond float64
+	bytesPerSecond  float64
+	lock            sync.Mutex
+	// available tokens, negative values are reserved by waiting writes
+	points float64
+	bytes  float64
+	// time of the last update of tokens
+	last time.Time
+	// fraction of the configured rates currently used
+	factor float64
+	// writes wait until this time after throttling
+	pausedUntil time.Time
+}
+
+// NewRateLimiter returns RateLimiter allowing pointsPerSecond points and bytesPerSecond bytes of line protocol per second.
+// Zero value means no limit, RateLimiter with both rates zero only pauses writes throttled by the server.
+func NewRateLimiter(pointsPerSecond, bytesPerSecond float64) *RateLimiter {
+	return &RateLimiter{
+		pointsPerSecond: pointsPerSecond,
+		bytesPerSecond:  bytesPerSecond,
+		points:          pointsPerSecond,
+		bytes:           bytesPerSecond,
+		last:            time.Now(),
+		factor:          1,
+	}
+}
+
+// Rates returns actual rates of points and bytes per second, lowered after throttling
+func (l *RateLimiter) Rates() (pointsPerSecond, bytesPerSecond float64) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.pointsPerSecond * l.factor, l.bytesPerSecond * l.factor
+}
+
+// refill adds tokens for the time since the last update, it must be called with the lock held
+func (l *RateLimiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if elapsed <= 0 {
+		return
+	}
+	l.points = math.Min(l.points+elapsed*l.pointsPerSecond*l.factor, l.pointsPerSecond*l.factor)
+	l.bytes = math.Min(l.bytes+elapsed*l.bytesPerSecond*l.factor, l.bytesPerSecond*l.factor)
+}
+
+// Wait waits until a batch with the given number of points and bytes can be written.
+// It returns ctx.Err() if ctx is done meanwhile.
+func (l *RateLimiter) Wait(ctx context.Context, points, bytes int) error {
+	l.lock.Lock()
+	now := time.Now()
+	l.refill(now)
+	var delay time.Duration
+	if l.pointsPerSecond > 0 {
+		l.points -= float64(points)
+		if l.points < 0 {
+			delay = time.Duration(-l.points / (l.pointsPerSecond * l.factor) * float64(time.Second))
+		}
+	}
+	if l.bytesPerSecond > 0 {
+		l.bytes -= float64(bytes)
+		if l.bytes < 0 {
+			if d := time.Duration(-l.bytes / (l.bytesPerSecond * l.factor) * float64(time.Second)); d > delay {
+				delay = d
+			}
+		}
+	}
+	if pause := l.pausedUntil.Sub(now); pause > delay {
+		delay = pause
+	}
+	l.lock.Unlock()
+	return sleep(ctx, delay)
+}
+
+// WaitResumed waits until writes paused after throttling can continue, without consuming tokens.
+// It returns ctx.Err() if ctx is done meanwhile.
+func (l *RateLimiter) WaitResumed(ctx context.Context) error {
+	l.lock.Lock()
+	pause := time.Until(l.pausedUntil)
+	l.lock.Unlock()
+	return sleep(ctx, pause)
+}
+
+// Throttled lowers the rates after the server rejected a write with status 429 and pauses writes for retryAfter
+func (l *RateLimiter) Throttled(retryAfter time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.refill(now)
+	l.factor = math.Max(l.factor*throttledFactor, minRateFactor)
+	// drop tokens accumulated for bursts
+	l.points = math.Min(l.points, 0)
+	l.bytes = math.Min(l.bytes, 0)
+	if until := now.Add(retryAfter); until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Succeeded restores part of the configured rates after a successful write
+func (l *RateLimiter) Succeeded() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.factor < 1 {
+		l.refill(time.Now())
+		l.factor = math.Min(l.factor+recoveryStep, 1)
+	}
+}
+
+// sleep waits for delay or until ctx is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterPacing(t *testing.T) {
+	ctx := context.Background()
+	l := NewRateLimiter(100, 0)
+	// burst of one second is allowed
+	start := time.Now()
+	require.NoError(t, l.Wait(ctx, 100, 10_000))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	// next points wait for tokens
+	start = time.Now()
+	require.NoError(t, l.Wait(ctx, 20, 10_000))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	l = NewRateLimiter(0, 1_000)
+	require.NoError(t, l.Wait(ctx, 10_000, 1_000))
+	start = time.Now()
+	require.NoError(t, l.Wait(ctx, 10_000, 200))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	// waiting is interrupted by ctx
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx, 0, 10_000), context.DeadlineExceeded)
+
+	l = NewRateLimiter(0, 0)
+	start = time.Now()
+	require.NoError(t, l.Wait(context.Background(), 1_000_000, 1_000_000))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestRateLimiterThrottling(t *testing.T) {
+	l := NewRateLimiter(1_000, 10_000)
+	l.Throttled(0)
+	points, bytes := l.Rates()
+	assert.EqualValues(t, 500, points)
+	assert.EqualValues(t, 5_000, bytes)
+	for i := 0; i < 10; i++ {
+		l.Throttled(0)
+	}
+	points, _ = l.Rates()
+	assert.InDelta(t, 50, points, 0.001)
+	for i := 0; i < 30; i++ {
+		l.Succeeded()
+	}
+	points, bytes = l.Rates()
+	assert.EqualValues(t, 1_000, points)
+	assert.EqualValues(t, 10_000, bytes)
+
+	// writes are paused for retry after
+	l.Throttled(time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.WaitResumed(ctx), context.DeadlineExceeded)
+	assert.ErrorIs(t, l.Wait(ctx, 1, 1), context.DeadlineExceeded)
+}
@@ -0,0 +1,26 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"net/http"
+	"time"
+)
+
+// Result holds information about a successfully written batch
+type Result struct {
+	// Lines of the batch
+	Batch string
+	// Number of lines in the batch
+	Lines int
+	// Size of the batch in bytes, before compression
+	Bytes int
+	// Number of write attempts, 1 if the batch was written on the first attempt
+	Attempts uint
+	// Headers of the server response
+	Header http.Header
+	// Duration of the successful write request
+	Latency time.Duration
+}
@@ -0,0 +1,205 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+)
+
+// RetryAction is a decision of RetryPolicy about a batch, which failed to be written
+type RetryAction int
+
+const (
+	// RetryActionRetry keeps the batch in the retry queue and writes it again after the retry delay
+	RetryActionRetry RetryAction = iota
+	// RetryActionDrop discards the batch
+	RetryActionDrop
+	// RetryActionSplit splits the batch into two halves, which are immediately written separately, keeping the order of lines.
+	// Halves are split again if they fail the same way. A batch with a single line is discarded.
+	RetryActionSplit
+	// RetryActionAccept considers the batch written, the error is only informational
+	RetryActionAccept
+)
+
+// RetryPolicy decides what happens with batches of WriteAPI that failed to be written.
+// A policy can be shared by several WriteAPI instances, so its methods can be called concurrently.
+type RetryPolicy interface {
+	// Decide returns what to do with a batch, whose write failed with err.
+	// attempts is the number of retries of the batch so far, 0 if it failed during the first write.
+	Decide(err *http2.Error, attempts uint) RetryAction
+	// RetryDelay returns delay in milliseconds before the next write after a write failed with err.
+	// attempts is the number of consecutive failed writes before this one.
+	// Zero means the failure is not caused by the server state, and writing can continue without delay.
+	RetryDelay(err *http2.Error, attempts uint) uint
+}
+
+// errStringHintedHandoffNotEmpty is an informational message about the state of the InfluxDB Enterprise cluster
+const errStringHintedHandoffNotEmpty = "hinted handoff queue not empty"
+
+// IsRetryableError returns true if a write failing with err can succeed later,
+// i.e. in case of connection errors and HTTP status codes 429 and higher.
+func IsRetryableError(err *http2.Error) bool {
+	return err.StatusCode == 0 || err.StatusCode >= http.StatusTooManyRequests
+}
+
+// decide implements the common classification of errors, retryable errors are retried up to maxRetries times.
+// Batches rejected by the server as too large are split.
+func decide(err *http2.Error, attempts uint, maxRetries uint) RetryAction {
+	if strings.Contains(err.Message, errStringHintedHandoffNotEmpty) {
+		return RetryActionAccept
+	}
+	if err.StatusCode == http.StatusRequestEntityTooLarge {
+		return RetryActionSplit
+	}
+	// Partial writes, such as "field type conflict", "points beyond retention policy" or line protocol errors,
+	// are not correctable at this point and retries would not be successful
+	var pe *PartialWriteError
+	if errors.As(err, &pe) {
+		return RetryActionDrop
+	}
+	if IsRetryableError(err) && attempts < maxRetries {
+		return RetryActionRetry
+	}
+	return RetryActionDrop
+}
+
+// retryAfter returns delay in milliseconds requested by the server in the Retry-After header, or 0
+func retryAfter(err *http2.Error) uint {
+	return err.RetryAfter * 1000
+}
+
+// DefaultRetryPolicy is the RetryPolicy used by WriteAPI if none is set.
+// Batches rejected with status 413 (Payload Too Large) are split into halves.
+// Retryable errors are retried up to Options.MaxRetries times, with exponentially growing random delays
+// between Options.RetryInterval * Options.ExponentialBase^attempts and Options.RetryInterval * Options.ExponentialBase^(attempts+1),
+// limited by Options.MaxRetryInterval. Delay requested by the server in the Retry-After header takes precedence.
+type DefaultRetryPolicy struct {
+	options *Options
+}
+
+// NewDefaultRetryPolicy returns DefaultRetryPolicy configured by options
+func NewDefaultRetryPolicy(options *Options) *DefaultRetryPolicy {
+	return &DefaultRetryPolicy{options: options}
+}
+
+// Decide returns what to do with a batch, whose write failed with err
+func (p *DefaultRetryPolicy) Decide(err *http2.Error, attempts uint) RetryAction {
+	return decide(err, attempts, p.options.MaxRetries())
+}
+
+// RetryDelay returns delay in milliseconds before the next write after a write failed with err
+func (p *DefaultRetryPolicy) RetryDelay(err *http2.Error, attempts uint) uint {
+	if !IsRetryableError(err) {
+		return 0
+	}
+	if d := retryAfter(err); d > 0 {
+		return d
+	}
+	return p.computeRetryDelay(attempts)
+}
+
+// computeRetryDelay calculates retry delay.
+// Retry delay is calculated as random value within the interval
+// [retry_interval * exponential_base^(attempts) and retry_interval * exponential_base^(attempts+1)]
+func (p *DefaultRetryPolicy) computeRetryDelay(attempts uint) uint {
+	minDelay := int(p.options.RetryInterval() * pow(p.options.ExponentialBase(), attempts))
+	maxDelay := int(p.options.RetryInterval() * pow(p.options.ExponentialBase(), attempts+1))
+	diff := maxDelay - minDelay
+	if diff <= 0 { //check overflows
+		return p.options.MaxRetryInterval()
+	}
+	retryDelay := uint(rand.Intn(diff) + minDelay)
+	if retryDelay > p.options.MaxRetryInterval() {
+		retryDelay = p.options.MaxRetryInterval()
+	}
+	return retryDelay
+}
+
+// pow computes x**y
+func pow(x, y uint) uint {
+	p := uint(1)
+	if y == 0 {
+		return 1
+	}
+	for i := uint(1); i <= y; i++ {
+		p = p * x
+	}
+	return p
+}
+
+// fixedIntervalRetryPolicy retries after a constant delay
+type fixedIntervalRetryPolicy struct {
+	intervalMs uint
+	maxRetries uint
+}
+
+// NewFixedIntervalRetryPolicy returns RetryPolicy, which retries retryable errors up to maxRetries times, always after intervalMs milliseconds,
+// unless the server requests a different delay in the Retry-After header.
+func NewFixedIntervalRetryPolicy(intervalMs uint, maxRetries uint) RetryPolicy {
+	return &fixedIntervalRetryPolicy{intervalMs: intervalMs, maxRetries: maxRetries}
+}
+
+func (p *fixedIntervalRetryPolicy) Decide(err *http2.Error, attempts uint) RetryAction {
+	return decide(err, attempts, p.maxRetries)
+}
+
+func (p *fixedIntervalRetryPolicy) RetryDelay(err *http2.Error, _ uint) uint {
+	if !IsRetryableError(err) {
+		return 0
+	}
+	if d := retryAfter(err); d > 0 {
+		return d
+	}
+	return p.intervalMs
+}
+
+// decorrelatedJitterRetryPolicy computes delays using the "decorrelated jitter" algorithm
+type decorrelatedJitterRetryPolicy struct {
+	baseMs     uint
+	capMs      uint
+	maxRetries uint
+	lock       sync.Mutex
+	// the last computed delay
+	delay uint
+}
+
+// NewDecorrelatedJitterRetryPolicy returns RetryPolicy, which retries retryable errors up to maxRetries times,
+// with delays computed by the decorrelated jitter algorithm: a random value between baseMs and three times the previous delay,
+// limited by capMs. Delay requested by the server in the Retry-After header takes precedence.
+func NewDecorrelatedJitterRetryPolicy(baseMs uint, capMs uint, maxRetries uint) RetryPolicy {
+	return &decorrelatedJitterRetryPolicy{baseMs: baseMs, capMs: capMs, maxRetries: maxRetries}
+}
+
+func (p *decorrelatedJitterRetryPolicy) Decide(err *http2.Error, attempts uint) RetryAction {
+	return decide(err, attempts, p.maxRetries)
+}
+
+func (p *decorrelatedJitterRetryPolicy) RetryDelay(err *http2.Error, attempts uint) uint {
+	if !IsRetryableError(err) {
+		return 0
+	}
+	if d := retryAfter(err); d > 0 {
+		return d
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if attempts == 0 || p.delay < p.baseMs {
+		p.delay = p.baseMs
+	}
+	upper := p.delay * 3
+	if upper > p.baseMs {
+		p.delay = p.baseMs + uint(rand.Int63n(int64(upper-p.baseMs)))
+	}
+	if p.delay > p.capMs {
+		p.delay = p.capMs
+	}
+	return p.delay
+}
@@ -0,0 +1,92 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPow(t *testing.T) {
+	assert.EqualValues(t, 1, pow(10, 0))
+	assert.EqualValues(t, 10, pow(10, 1))
+	assert.EqualValues(t, 4, pow(2, 2))
+	assert.EqualValues(t, 1, pow(1, 2))
+	assert.EqualValues(t, 125, pow(5, 3))
+}
+
+func assertBetween(t *testing.T, val, min, max uint) {
+	t.Helper()
+	assert.True(t, val >= min && val <= max, fmt.Sprintf("%d is outside <%d;%d>", val, min, max))
+}
+
+func TestComputeRetryDelay(t *testing.T) {
+	p := NewDefaultRetryPolicy(DefaultOptions())
+	assertBetween(t, p.computeRetryDelay(0), 5_000, 10_000)
+	assertBetween(t, p.computeRetryDelay(1), 10_000, 20_000)
+	assertBetween(t, p.computeRetryDelay(2), 20_000, 40_000)
+	assertBetween(t, p.computeRetryDelay(3), 40_000, 80_000)
+	assertBetween(t, p.computeRetryDelay(4), 80_000, 125_000)
+
+	for i := uint(5); i < 200; i++ { //test also limiting higher values
+		assert.EqualValues(t, 125_000, p.computeRetryDelay(i))
+	}
+}
+
+func TestDefaultRetryPolicy(t *testing.T) {
+	p := NewDefaultRetryPolicy(DefaultOptions().SetMaxRetries(2))
+	unavailable := &http.Error{StatusCode: 503}
+	assert.Equal(t, RetryActionRetry, p.Decide(unavailable, 0))
+	assert.Equal(t, RetryActionRetry, p.Decide(unavailable, 1))
+	assert.Equal(t, RetryActionDrop, p.Decide(unavailable, 2))
+	assert.Equal(t, RetryActionRetry, p.Decide(&http.Error{Err: errors.New("connection refused")}, 0))
+	assert.Equal(t, RetryActionDrop, p.Decide(&http.Error{StatusCode: 400}, 0))
+	assert.Equal(t, RetryActionSplit, p.Decide(&http.Error{StatusCode: 413}, 0))
+	assert.Equal(t, RetryActionDrop, p.Decide(&http.Error{StatusCode: 500, Err: &PartialWriteError{}}, 0))
+	assert.Equal(t, RetryActionAccept, p.Decide(&http.Error{StatusCode: 500, Message: "write failed: hinted handoff queue not empty"}, 0))
+
+	assertBetween(t, p.RetryDelay(unavailable, 0), 5_000, 10_000)
+	assert.EqualValues(t, 3_000, p.RetryDelay(&http.Error{StatusCode: 429, RetryAfter: 3}, 0))
+	assert.EqualValues(t, 0, p.RetryDelay(&http.Error{StatusCode: 400}, 0))
+	assert.EqualValues(t, 0, p.RetryDelay(&http.Error{StatusCode: 413}, 0))
+
+	p = NewDefaultRetryPolicy(DefaultOptions().SetMaxRetries(0))
+	assert.Equal(t, RetryActionDrop, p.Decide(unavailable, 0))
+}
+
+func TestFixedIntervalRetryPolicy(t *testing.T) {
+	p := NewFixedIntervalRetryPolicy(1_000, 1)
+	unavailable := &http.Error{StatusCode: 503}
+	assert.Equal(t, RetryActionRetry, p.Decide(unavailable, 0))
+	assert.Equal(t, RetryActionDrop, p.Decide(unavailable, 1))
+	for i := uint(0); i < 10; i++ {
+		assert.EqualValues(t, 1_000, p.RetryDelay(unavailable, i))
+	}
+	assert.EqualValues(t, 5_000, p.RetryDelay(&http.Error{StatusCode: 429, RetryAfter: 5}, 0))
+	assert.EqualValues(t, 0, p.RetryDelay(&http.Error{StatusCode: 401}, 0))
+}
+
+func TestDecorrelatedJitterRetryPolicy(t *testing.T) {
+	p := NewDecorrelatedJitterRetryPolicy(100, 2_000, 3)
+	unavailable := &http.Error{StatusCode: 503}
+	assert.Equal(t, RetryActionRetry, p.Decide(unavailable, 2))
+	assert.Equal(t, RetryActionDrop, p.Decide(unavailable, 3))
+	prev := uint(100)
+	for i := uint(0); i < 20; i++ {
+		d := p.RetryDelay(unavailable, i)
+		max := prev * 3
+		if max > 2_000 {
+			max = 2_000
+		}
+		assertBetween(t, d, 100, max)
+		prev = d
+	}
+	assert.EqualValues(t, 1_000, p.RetryDelay(&http.Error{StatusCode: 429, RetryAfter: 1}, 0))
+	assert.EqualValues(t, 0, p.RetryDelay(&http.Error{StatusCode: 400}, 0))
+}
@@ -0,0 +1,206 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"container/list"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Batch holds information for sending points batch
+type Batch struct {
+	// lines to send
+	Batch string
+	// retry attempts so far
+	RetryAttempts uint
+	// true if it was removed from queue
+	Evicted bool
+	// time when this batch expires
+	Expires time.Time
+	// acknowledgements of data in the batch, they are not stored in a persistent retry queue
+	Acks []*Ack
+	// span contexts of writes of data in the batch, linked from spans of writes of the batch.
+	// They are not stored in a persistent retry queue.
+	SpanContexts []trace.SpanContext
+	// headers of the response to the successful write of the batch, they are not stored in a persistent retry queue
+	ResponseHeader http.Header
+	// duration of the last write request of the batch
+	Latency time.Duration
+	// the last error of a write of the batch, it is not stored in a persistent retry queue
+	LastError error
+}
+
+// Result returns result of the successful write of the batch
+func (b *Batch) Result() Result {
+	return Result{
+		Batch:    b.Batch,
+		Lines:    b.Points(),
+		Bytes:    len(b.Batch),
+		Attempts: b.RetryAttempts + 1,
+		Header:   b.ResponseHeader,
+		Latency:  b.Latency,
+	}
+}
+
+// Resolve resolves all acknowledgements of the batch with err
+func (b *Batch) Resolve(err error) {
+	for _, a := range b.Acks {
+		a.Resolve(err)
+	}
+}
+
+// Points returns number of points (non-empty lines) in the batch
+func (b *Batch) Points() int {
+	n := 0
+	for _, l := range strings.Split(b.Batch, "\n") {
+		if l != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Split splits lines of the batch into two halves, or returns nil if the batch has a single line.
+// Acknowledgements of the batch are resolved when both halves are resolved.
+func (b *Batch) Split() []*Batch {
+	lines := strings.SplitAfter(strings.TrimRight(b.Batch, "\n"), "\n")
+	if len(lines) < 2 {
+		return nil
+	}
+	half := len(lines) / 2
+	halves := []*Batch{
+		{Batch: strings.Join(lines[:half], ""), Expires: b.Expires, SpanContexts: b.SpanContexts},
+		{Batch: strings.Join(lines[half:], "") + "\n", Expires: b.Expires, SpanContexts: b.SpanContexts},
+	}
+	if len(b.Acks) > 0 {
+		acks := joinAcks(b.Acks, len(halves))
+		for i, h := range halves {
+			h.Acks = []*Ack{acks[i]}
+		}
+	}
+	return halves
+}
+
+// NewBatch creates new batch
+func NewBatch(data string, expireDelayMs uint) *Batch {
+	return &Batch{
+		Batch:   data,
+		Expires: time.Now().Add(time.Duration(expireDelayMs) * time.Millisecond),
+	}
+}
+
+var (
+	// ErrRetryQueueFull is returned by RetryQueue.Push when there is no space for a batch
+	ErrRetryQueueFull = errors.New("retry queue is full")
+	// ErrBatchTooLarge is returned by RetryQueue.Push when a batch doesn't fit into the queue even if it was empty
+	ErrBatchTooLarge = errors.New("batch exceeds retry queue limit")
+)
+
+// RetryQueue holds batches of the non-blocking WriteAPI waiting for retry.
+// Batches are taken in the FIFO order.
+// A queue is used only by a single WriteAPI and its methods are not called concurrently.
+type RetryQueue interface {
+	// Push adds batch to the end of the queue.
+	// It returns ErrRetryQueueFull, without storing the batch, if the queue has no space for it.
+	// What happens then is decided by the OverflowPolicy set in Options.
+	// ErrBatchTooLarge means the batch can never be stored, and it is discarded.
+	Push(batch *Batch) error
+	// Pop removes and returns the oldest batch, or nil if the queue is empty
+	Pop() *Batch
+	// First returns the oldest batch without removing it, or nil if the queue is empty
+	First() *Batch
+	// Len returns number of batches in the queue
+	Len() int
+	// Bytes returns total size of batches in the queue
+	Bytes() int
+}
+
+// OverflowPolicy determines how WriteAPI handles a batch that doesn't fit into the full RetryQueue
+type OverflowPolicy int
+
+const (
+	// OverflowDropOldest discards the oldest batches from the retry queue to make space for the new one. It is the default.
+	OverflowDropOldest OverflowPolicy = iota
+	// OverflowDropNewest discards the batch that doesn't fit into the retry queue.
+	OverflowDropNewest
+	// OverflowBlock blocks writing, until there is space in the retry queue.
+	// As the WriteAPI buffer is not drained meanwhile, WritePoint and WriteRecord calls block too.
+	OverflowBlock
+)
+
+// String returns name of the policy
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowBlock:
+		return "block"
+	default:
+		return "unknown"
+	}
+}
+
+// memoryRetryQueue is in-memory RetryQueue
+type memoryRetryQueue struct {
+	list       *list.List
+	maxBatches int
+	maxBytes   int
+	bytes      int
+}
+
+// NewRetryQueue returns in-memory RetryQueue limited to maxBatches batches and maxBytes total size of batches.
+// Zero value means no limit.
+func NewRetryQueue(maxBatches, maxBytes int) RetryQueue {
+	return &memoryRetryQueue{list: list.New(), maxBatches: maxBatches, maxBytes: maxBytes}
+}
+
+func (q *memoryRetryQueue) Push(batch *Batch) error {
+	if q.maxBatches > 0 && q.list.Len() >= q.maxBatches {
+		return ErrRetryQueueFull
+	}
+	if q.maxBytes > 0 && len(batch.Batch) > q.maxBytes {
+		return ErrBatchTooLarge
+	}
+	if q.maxBytes > 0 && q.bytes+len(batch.Batch) > q.maxBytes {
+		return ErrRetryQueueFull
+	}
+	q.list.PushBack(batch)
+	q.bytes += len(batch.Batch)
+	return nil
+}
+
+func (q *memoryRetryQueue) Pop() *Batch {
+	el := q.list.Front()
+	if el != nil {
+		q.list.Remove(el)
+		batch := el.Value.(*Batch)
+		q.bytes -= len(batch.Batch)
+		return batch
+	}
+	return nil
+}
+
+func (q *memoryRetryQueue) First() *Batch {
+	el := q.list.Front()
+	if el != nil {
+		return el.Value.(*Batch)
+	}
+	return nil
+}
+
+func (q *memoryRetryQueue) Len() int {
+	return q.list.Len()
+}
+
+func (q *memoryRetryQueue) Bytes() int {
+	return q.bytes
+}
@@ -0,0 +1,58 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write_test
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryQueue(t *testing.T) {
+	que := write.NewRetryQueue(2, 0)
+	assert.Equal(t, 0, que.Len())
+	assert.Nil(t, que.First())
+	assert.Nil(t, que.Pop())
+	b := &write.Batch{Batch: "batch", RetryAttempts: 3}
+	require.NoError(t, que.Push(b))
+	assert.Equal(t, 1, que.Len())
+	assert.Equal(t, 5, que.Bytes())
+	b2 := que.Pop()
+	assert.Equal(t, b, b2)
+	assert.Equal(t, 0, que.Len())
+
+	require.NoError(t, que.Push(b))
+	require.NoError(t, que.Push(b))
+	assert.Equal(t, write.ErrRetryQueueFull, que.Push(b))
+	assert.Equal(t, 2, que.Len())
+	assert.Equal(t, 10, que.Bytes())
+	que.Pop()
+	que.Pop()
+	assert.Equal(t, 0, que.Len())
+	assert.Equal(t, 0, que.Bytes())
+	assert.Nil(t, que.Pop())
+}
+
+func TestRetryQueueBytesLimit(t *testing.T) {
+	que := write.NewRetryQueue(0, 10)
+	require.NoError(t, que.Push(&write.Batch{Batch: "12345"}))
+	require.NoError(t, que.Push(&write.Batch{Batch: "1234"}))
+	assert.Equal(t, write.ErrRetryQueueFull, que.Push(&write.Batch{Batch: "12"}))
+	require.NoError(t, que.Push(&write.Batch{Batch: "1"}))
+	assert.Equal(t, 3, que.Len())
+	assert.Equal(t, 10, que.Bytes())
+	assert.Equal(t, "12345", que.Pop().Batch)
+	assert.Equal(t, 5, que.Bytes())
+	assert.Equal(t, write.ErrBatchTooLarge, que.Push(&write.Batch{Batch: "12345678901"}))
+}
+
+func TestOverflowPolicyString(t *testing.T) {
+	assert.Equal(t, "drop-oldest", write.OverflowDropOldest.String())
+	assert.Equal(t, "drop-newest", write.OverflowDropNewest.String())
+	assert.Equal(t, "block", write.OverflowBlock.String())
+	assert.Equal(t, "unknown", write.OverflowPolicy(10).String())
+}
@@ -0,0 +1,28 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+// ShutdownReport summarizes delivery of data waiting in WriteAPI when it is closed
+type ShutdownReport struct {
+	// Number of batches written during the shutdown
+	DeliveredBatches int
+	// Number of points written during the shutdown
+	DeliveredPoints int
+	// Number of batches discarded during the shutdown, because they failed to be written or the shutdown deadline passed
+	AbandonedBatches int
+	// Number of points in the abandoned batches
+	AbandonedPoints int
+	// Number of batches left in the persistent retry queue, they are written by the next WriteAPI using the same directory
+	PersistedBatches int
+}
+
+// Add adds counts of other report to r
+func (r *ShutdownReport) Add(other ShutdownReport) {
+	r.DeliveredBatches += other.DeliveredBatches
+	r.DeliveredPoints += other.DeliveredPoints
+	r.AbandonedBatches += other.AbandonedBatches
+	r.AbandonedPoints += other.AbandonedPoints
+	r.PersistedBatches += other.PersistedBatches
+}
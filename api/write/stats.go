@@ -0,0 +1,132 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"sync"
+	"time"
+)
+
+// Stats holds statistics of writes
+type Stats struct {
+	// Number of batches created
+	BatchesCreated uint64
+	// Number of write requests
+	Requests uint64
+	// Number of failed write requests
+	FailedRequests uint64
+	// Number of batches written
+	BatchesWritten uint64
+	// Number of failed writes of batches kept for retrying
+	BatchesRetried uint64
+	// Number of batches evicted from the full retry queue
+	BatchesEvicted uint64
+	// Number of batches discarded because of their maximum retry time elapsed
+	BatchesExpired uint64
+	// Number of batches discarded because of an error
+	BatchesDropped uint64
+	// Number of points written
+	PointsWritten uint64
+	// Number of points lost in evicted, expired and dropped batches
+	PointsLost uint64
+	// Number of bytes sent in write requests, before compression
+	BytesSent uint64
+	// Duration of the last write request
+	LastLatency time.Duration
+	// Time of the last written batch, zero if no batch has been written yet
+	LastSuccess time.Time
+	// The last error of a write request, nil if there was no error
+	LastError error
+	// Time of LastError
+	LastErrorTime time.Time
+	// Number of batches waiting in retry queues
+	RetryQueueDepth int
+	// Number of write requests in progress
+	InFlightRequests int
+}
+
+// StatsCollector is Observer collecting write statistics.
+// Gauges RetryQueueDepth and InFlightRequests are not observed, they are filled by the owner of the collector, such as Client.
+type StatsCollector struct {
+	lock  sync.Mutex
+	stats Stats
+}
+
+// NewStatsCollector returns new StatsCollector
+func NewStatsCollector() *StatsCollector {
+	return &StatsCollector{}
+}
+
+// Stats returns a snapshot of the collected statistics
+func (c *StatsCollector) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stats
+}
+
+// BatchCreated counts created batches
+func (c *StatsCollector) BatchCreated(*Batch) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesCreated++
+}
+
+// BatchSent counts requests, sent bytes and records latency and errors of requests
+func (c *StatsCollector) BatchSent(_ *Batch, latency time.Duration, bytes int, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.Requests++
+	c.stats.BytesSent += uint64(bytes)
+	c.stats.LastLatency = latency
+	if err != nil {
+		c.stats.FailedRequests++
+		c.stats.LastError = err
+		c.stats.LastErrorTime = time.Now()
+	}
+}
+
+// BatchSucceeded counts written batches and points
+func (c *StatsCollector) BatchSucceeded(batch *Batch) {
+	points := batch.Points()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesWritten++
+	c.stats.PointsWritten += uint64(points)
+	c.stats.LastSuccess = time.Now()
+}
+
+// BatchRetried counts retried batches
+func (c *StatsCollector) BatchRetried(*Batch, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesRetried++
+}
+
+// BatchEvicted counts evicted batches and lost points
+func (c *StatsCollector) BatchEvicted(batch *Batch) {
+	points := batch.Points()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesEvicted++
+	c.stats.PointsLost += uint64(points)
+}
+
+// BatchExpired counts expired batches and lost points
+func (c *StatsCollector) BatchExpired(batch *Batch) {
+	points := batch.Points()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesExpired++
+	c.stats.PointsLost += uint64(points)
+}
+
+// BatchDropped counts dropped batches and lost points
+func (c *StatsCollector) BatchDropped(batch *Batch, _ error) {
+	points := batch.Points()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.stats.BatchesDropped++
+	c.stats.PointsLost += uint64(points)
+}
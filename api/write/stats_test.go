@@ -0,0 +1,45 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsCollector(t *testing.T) {
+	c := write.NewStatsCollector()
+	o := write.NewMultiObserver(nil, c, write.NoopObserver{})
+	b := write.NewBatch("a f=1\na f=2\n", 1_000)
+	o.BatchCreated(b)
+	o.BatchSent(b, time.Millisecond, len(b.Batch), errors.New("unavailable"))
+	o.BatchRetried(b, errors.New("unavailable"))
+	o.BatchSent(b, 2*time.Millisecond, len(b.Batch), nil)
+	o.BatchSucceeded(b)
+	o.BatchEvicted(b)
+	o.BatchExpired(b)
+	o.BatchDropped(b, errors.New("bad request"))
+
+	s := c.Stats()
+	assert.EqualValues(t, 1, s.BatchesCreated)
+	assert.EqualValues(t, 2, s.Requests)
+	assert.EqualValues(t, 1, s.FailedRequests)
+	assert.EqualValues(t, 1, s.BatchesRetried)
+	assert.EqualValues(t, 1, s.BatchesWritten)
+	assert.EqualValues(t, 1, s.BatchesEvicted)
+	assert.EqualValues(t, 1, s.BatchesExpired)
+	assert.EqualValues(t, 1, s.BatchesDropped)
+	assert.EqualValues(t, 2, s.PointsWritten)
+	assert.EqualValues(t, 6, s.PointsLost)
+	assert.EqualValues(t, 24, s.BytesSent)
+	assert.Equal(t, 2*time.Millisecond, s.LastLatency)
+	assert.EqualError(t, s.LastError, "unavailable")
+	assert.False(t, s.LastErrorTime.IsZero())
+	assert.False(t, s.LastSuccess.IsZero())
+}
@@ -19,12 +19,14 @@ import (
 // It doesn't implicitly create batches of points by default. Batches are created from array of points/records.
 //
 // Implicit batching is enabled with EnableBatching(). In this mode, each call to WritePoint or WriteRecord adds a line
-// to internal buffer. If length of the buffer is equal to the batch-size (set in write.Options), the buffer is sent to the server
-// and the result of the operation is returned.
+// to internal buffer. If length of the buffer is equal to the batch-size, or its size reaches the maximum batch bytes (set in write.Options),
+// the buffer is sent to the server and the result of the operation is returned.
 // When a point is written to the buffer, nil error is always returned.
 // Flush() can be used to trigger sending of batch when it doesn't have the batch-size.
 //
 // Synchronous writing is intended to use for writing less frequent data, such as a weather sensing, or if there is a need to have explicit control of failed batches.
+//
+// If the server rejects some lines, the returned error nests write.PartialWriteError with details of rejected lines.
 
 //
 // WriteAPIBlocking can be used concurrently.
@@ -34,6 +36,7 @@ type WriteAPIBlocking interface {
 	// WriteRecord writes lines without implicit batching by default, batch is created from given number of records.
 	// Automatic batching can be enabled by EnableBatching()
 	// Individual arguments can also be batches (multiple records separated by newline).
+	// If record processing is enabled by write.Options.SetProcessRecords, records are validated and no record is written if any is invalid.
 	// Non-blocking alternative is available in the WriteAPI interface
 	WriteRecord(ctx context.Context, line ...string) error
 	// WritePoint data point into bucket.
@@ -41,6 +44,14 @@ type WriteAPIBlocking interface {
 	// Automatic batching can be enabled by EnableBatching().
 	// Non-blocking alternative is available in the WriteAPI interface
 	WritePoint(ctx context.Context, point ...*write.Point) error
+	// WriteRecordWithResult writes line protocol record(s) into bucket, the same way as WriteRecord.
+	// It returns result of the write with number of lines, bytes, attempts and headers of the server response.
+	// Result is nil if nothing was sent, e.g. when records are only added to the buffer with batching enabled.
+	WriteRecordWithResult(ctx context.Context, line ...string) (*write.Result, error)
+	// WritePointWithResult writes data points into bucket, the same way as WritePoint.
+	// It returns result of the write with number of lines, bytes, attempts and headers of the server response.
+	// Result is nil if nothing was sent, e.g. when points are only added to the buffer with batching enabled.
+	WritePointWithResult(ctx context.Context, point ...*write.Point) (*write.Result, error)
 	// EnableBatching turns on implicit batching
 	// Batch size is controlled via write.Options
 	EnableBatching()
@@ -55,7 +66,9 @@ type writeAPIBlocking struct {
 	// more appropriate Bool type from sync/atomic cannot be used because it is available since go 1.19
 	batching int32
 	batch    []string
-	mu       sync.Mutex
+	// size of lines in batch in bytes, including separators
+	batchBytes int
+	mu         sync.Mutex
 }
 
 // NewWriteAPIBlocking creates new instance of blocking write client for writing data to bucket belonging to org
@@ -63,6 +76,13 @@ func NewWriteAPIBlocking(org string, bucket string, service http2.Service, write
 	return &writeAPIBlocking{service: iwrite.NewService(org, bucket, service, writeOptions), writeOptions: writeOptions}
 }
 
+// NewWriteAPIBlockingV1 returns new synchronous blocking write client for writing data to database db and retention policy rp of InfluxDB 1.x,
+// using the /write endpoint. Empty rp means the default retention policy.
+// If username is not empty, requests are authenticated by username and password instead of the authorization of service.
+func NewWriteAPIBlockingV1(db, rp, username, password string, service http2.Service, writeOptions *write.Options) WriteAPIBlocking {
+	return &writeAPIBlocking{service: iwrite.NewServiceV1(db, rp, username, password, service, writeOptions), writeOptions: writeOptions}
+}
+
 // NewWriteAPIBlockingWithBatching creates new instance of blocking write client for writing data to bucket belonging to org with batching enabled
 func NewWriteAPIBlockingWithBatching(org string, bucket string, service http2.Service, writeOptions *write.Options) WriteAPIBlocking {
 	api := &writeAPIBlocking{service: iwrite.NewService(org, bucket, service, writeOptions), writeOptions: writeOptions}
@@ -70,6 +90,12 @@ func NewWriteAPIBlockingWithBatching(org string, bucket string, service http2.Se
 	return api
 }
 
+// AddObserver adds observer notified about the lifecycle of batches, in addition to the observer set in write.Options.
+// It must be called before performing any writes.
+func (w *writeAPIBlocking) AddObserver(observer write.Observer) {
+	w.service.AddObserver(observer)
+}
+
 func (w *writeAPIBlocking) EnableBatching() {
 	if atomic.LoadInt32(&w.batching) == 0 {
 		w.mu.Lock()
@@ -79,57 +105,90 @@ func (w *writeAPIBlocking) EnableBatching() {
 	}
 }
 
-func (w *writeAPIBlocking) write(ctx context.Context, line string) error {
+func (w *writeAPIBlocking) write(ctx context.Context, line string) (*write.Result, error) {
 	if atomic.LoadInt32(&w.batching) > 0 {
 		w.mu.Lock()
 		defer w.mu.Unlock()
+		maxBytes := int(w.writeOptions.MaxBatchBytes())
+		if maxBytes > 0 && len(w.batch) > 0 && w.batchBytes+len(line)+1 > maxBytes {
+			// line doesn't fit into the current batch
+			if _, err := w.flush(ctx); err != nil {
+				return nil, err
+			}
+		}
 		w.batch = append(w.batch, line)
-		if len(w.batch) == int(w.writeOptions.BatchSize()) {
+		w.batchBytes += len(line) + 1
+		if len(w.batch) == int(w.writeOptions.BatchSize()) || (maxBytes > 0 && w.batchBytes >= maxBytes) {
 			return w.flush(ctx)
 		}
-		return nil
+		return nil, nil
 	}
-	err := w.service.WriteBatch(ctx, iwrite.NewBatch(line, w.writeOptions.MaxRetryTime()))
-	if err != nil {
-		return err
+	return w.writeBatch(ctx, line)
+}
+
+// writeBatch writes lines as a single batch and returns result of the write
+func (w *writeAPIBlocking) writeBatch(ctx context.Context, lines string) (*write.Result, error) {
+	b := iwrite.NewBatch(lines, w.writeOptions.MaxRetryTime())
+	if err := w.service.Write(ctx, b); err != nil {
+		return nil, err
 	}
-	return nil
+	result := b.Result()
+	return &result, nil
 }
 
 func (w *writeAPIBlocking) WriteRecord(ctx context.Context, line ...string) error {
+	_, err := w.WriteRecordWithResult(ctx, line...)
+	return err
+}
+
+func (w *writeAPIBlocking) WriteRecordWithResult(ctx context.Context, line ...string) (*write.Result, error) {
 	if len(line) == 0 {
-		return nil
+		return nil, nil
+	}
+	if w.writeOptions.ProcessRecords() {
+		encoded, err := w.service.EncodeRecords(line...)
+		if err != nil {
+			return nil, err
+		}
+		if encoded == "" {
+			return nil, nil
+		}
+		return w.write(ctx, encoded)
 	}
 	return w.write(ctx, strings.Join(line, "\n"))
 }
 
 func (w *writeAPIBlocking) WritePoint(ctx context.Context, point ...*write.Point) error {
+	_, err := w.WritePointWithResult(ctx, point...)
+	return err
+}
+
+func (w *writeAPIBlocking) WritePointWithResult(ctx context.Context, point ...*write.Point) (*write.Result, error) {
 	line, err := w.service.EncodePoints(point...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	return w.write(ctx, line)
 }
 
 // flush is unsychronized helper for creating and sending batch
 // Must be called from synchronized block
-func (w *writeAPIBlocking) flush(ctx context.Context) error {
+func (w *writeAPIBlocking) flush(ctx context.Context) (*write.Result, error) {
 	if len(w.batch) > 0 {
 		body := strings.Join(w.batch, "\n")
 		w.batch = w.batch[:0]
-		b := iwrite.NewBatch(body, w.writeOptions.MaxRetryTime())
-		if err:= w.service.WriteBatch(ctx, b); err != nil {
-			return err
-		}
+		w.batchBytes = 0
+		return w.writeBatch(ctx, body)
 	}
-	return nil
+	return nil, nil
 }
 
 func (w *writeAPIBlocking) Flush(ctx context.Context) error {
 	if atomic.LoadInt32(&w.batching) > 0 {
 		w.mu.Lock()
 		defer w.mu.Unlock()
-		return w.flush(ctx)
+		_, err := w.flush(ctx)
+		return err
 	}
 	return nil
 }
@@ -6,8 +6,11 @@ package api
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"sync"
 	"testing"
@@ -69,6 +72,22 @@ func TestWriteRecord(t *testing.T) {
 	require.Equal(t, "invalid: data", err.Error())
 }
 
+func TestWriteRecordProcessed(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	opts := write.DefaultOptions().SetProcessRecords(true).AddDefaultTag("env", "prod")
+	writeAPI := NewWriteAPIBlocking("my-org", "my-bucket", service, opts)
+	err := writeAPI.WriteRecord(context.Background(), "cpu,host=a usage=1.5 10", "cpu,env=dev,host=b usage=2 20")
+	require.NoError(t, err)
+	require.Len(t, service.Lines(), 2)
+	assert.Equal(t, "cpu,env=prod,host=a usage=1.5 10", service.Lines()[0])
+	assert.Equal(t, "cpu,env=dev,host=b usage=2 20", service.Lines()[1])
+	service.Close()
+
+	err = writeAPI.WriteRecord(context.Background(), "cpu,host=a usage=1.5 10", "cpu,host=b usage")
+	require.Error(t, err)
+	assert.Equal(t, 0, service.Requests())
+}
+
 func TestWriteRecordBatch(t *testing.T) {
 	service := test.NewTestService(t, "http://localhost:8888")
 	writeAPI := NewWriteAPIBlocking("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(5))
@@ -158,3 +177,69 @@ func TestWriteBatchIng(t *testing.T) {
 	assert.Equal(t, 1, service.Requests())
 	require.Len(t, service.Lines(), 4)
 }
+
+func TestWriteBlockingPartialWriteError(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	service.SetReplyError(&http2.Error{
+		StatusCode: 400,
+		Code:       "invalid",
+		Message:    "unable to parse 'cpu value': invalid field format",
+	})
+	writeAPI := NewWriteAPIBlocking("my-org", "my-bucket", service, write.DefaultOptions())
+	err := writeAPI.WriteRecord(context.Background(), "cpu value=1", "cpu value")
+	require.Error(t, err)
+	var pe *write.PartialWriteError
+	require.True(t, errors.As(err, &pe))
+	require.Len(t, pe.Rejected, 1)
+	assert.Equal(t, write.RejectedLine{Number: 2, Line: "cpu value", Reason: "invalid field format"}, pe.Rejected[0])
+}
+
+func TestWriteBatchingMaxBytes(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	// each record has 9 bytes plus separator, two records fit into a batch
+	writeAPI := NewWriteAPIBlockingWithBatching("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(100).SetMaxBatchBytes(25))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, writeAPI.WriteRecord(context.Background(), fmt.Sprintf("m f=%05d", i)))
+	}
+	assert.Equal(t, 2, service.Requests())
+	require.Len(t, service.Lines(), 4)
+	require.NoError(t, writeAPI.Flush(context.Background()))
+	assert.Equal(t, 3, service.Requests())
+	require.Len(t, service.Lines(), 5)
+}
+
+func TestWriteWithResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-1")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	service := http2.NewService(server.URL+"/", "my-token", http2.DefaultOptions())
+	writeAPI := NewWriteAPIBlocking("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(3))
+
+	result, err := writeAPI.WriteRecordWithResult(context.Background(), "a a=1i", "a a=2i")
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "a a=1i\na a=2i", result.Batch)
+	assert.Equal(t, 2, result.Lines)
+	assert.Equal(t, 13, result.Bytes)
+	assert.EqualValues(t, 1, result.Attempts)
+	assert.Equal(t, "req-1", result.Header.Get("X-Request-Id"))
+	assert.Greater(t, result.Latency, time.Duration(0))
+
+	writeAPI.EnableBatching()
+	points := test.GenPoints(3)
+	for _, p := range points[:2] {
+		result, err = writeAPI.WritePointWithResult(context.Background(), p)
+		require.NoError(t, err)
+		assert.Nil(t, result)
+	}
+	result, err = writeAPI.WritePointWithResult(context.Background(), points[2])
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, 3, result.Lines)
+
+	result, err = writeAPI.WriteRecordWithResult(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, result)
+}
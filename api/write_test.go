@@ -5,9 +5,12 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"math"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
@@ -17,6 +20,7 @@ import (
 	"github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/influxdata/influxdb-client-go/v2/internal/test"
+	iwrite "github.com/influxdata/influxdb-client-go/v2/internal/write"
 	"github.com/influxdata/influxdb-client-go/v2/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -265,3 +269,327 @@ func TestFlushWithRetries(t *testing.T) {
 	// two remained
 	assert.Equal(t, 2, len(service.Lines()))
 }
+
+func TestPersistentRetryQueue(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	log.Log.SetLogLevel(log.DebugLevel)
+	opts := write.DefaultOptions().SetBatchSize(5).SetRetryInterval(10000).SetRetryQueueDir(t.TempDir())
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, opts)
+	service.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	points := test.GenPoints(15)
+	for i := 0; i < 14; i++ {
+		writeAPI.WritePoint(points[i])
+	}
+	ack := writeAPI.WritePointWithAck(points[14], nil)
+	writeAPI.Flush()
+	select {
+	case <-ack.Done():
+		assert.Fail(t, "batch kept for retrying must not be acknowledged")
+	default:
+	}
+	report, err := writeAPI.CloseWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.PersistedBatches)
+	assert.ErrorIs(t, ack.Err(), write.ErrWriteAPIClosed)
+	assert.Len(t, service.Lines(), 0)
+
+	// batches are written by a new instance, observers passed to the constructor are notified about them
+	service.Close()
+	stats := write.NewStatsCollector()
+	writeAPI = NewWriteAPI("my-org", "my-bucket", service, opts, stats)
+	writeAPI.Flush()
+	writeAPI.Close()
+	assert.EqualValues(t, 3, stats.Stats().BatchesWritten)
+	require.Len(t, service.Lines(), 15)
+	assert.True(t, strings.HasPrefix(service.Lines()[0], "test,hostname=host_0"))
+	assert.True(t, strings.HasPrefix(service.Lines()[14], "test,hostname=host_14"))
+}
+
+func TestPersistentRetryQueueLowerConcurrency(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	dir := t.TempDir()
+	opts := write.DefaultOptions().SetBatchSize(5).SetRetryInterval(10000).SetRetryQueueDir(dir)
+	// batch persisted by the third worker of a previous instance
+	worker := iwrite.NewService("my-org", "my-bucket", service, opts)
+	require.NoError(t, worker.UsePersistentRetryQueue(filepath.Join(dir, "worker2")))
+	service.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	require.Error(t, worker.HandleWrite(context.Background(), iwrite.NewBatch("test,hostname=host_0 f=1i 1\n", opts.MaxRetryTime())))
+	require.NoError(t, worker.Close())
+
+	service.Close()
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, opts.SetConcurrency(2))
+	writeAPI.Flush()
+	report, err := writeAPI.CloseWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.PersistedBatches)
+	assert.Equal(t, []string{"test,hostname=host_0 f=1i 1"}, service.Lines())
+}
+
+func TestPersistentRetryQueueError(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	// a file cannot be used as directory
+	dir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(dir, nil, 0o644))
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetRetryQueueDir(dir))
+	select {
+	case err := <-writeAPI.Errors():
+		assert.ErrorContains(t, err, "cannot use persistent retry queue")
+	default:
+		assert.Fail(t, "error of the persistent retry queue not reported")
+	}
+	// data are written using in-memory retry queue
+	writeAPI.WriteRecord("a a=1i")
+	writeAPI.Flush()
+	assert.Equal(t, []string{"a a=1i"}, service.Lines())
+	writeAPI.Close()
+}
+
+func TestWriteWithAck(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	log.Log.SetLogLevel(log.DebugLevel)
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(2).SetMaxRetries(0))
+	points := test.GenPoints(4)
+	ack1 := writeAPI.WritePointWithAck(points[0], 1)
+	ack2 := writeAPI.WriteRecordWithAck(strings.TrimSuffix(write.PointToLineProtocol(points[1], time.Nanosecond), "\n"), "2")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, ack1.Wait(ctx))
+	require.NoError(t, ack2.Wait(ctx))
+	assert.Equal(t, 1, ack1.ID())
+	assert.Equal(t, "2", ack2.ID())
+	require.Len(t, service.Lines(), 2)
+
+	service.SetReplyError(&http.Error{
+		StatusCode: 400,
+		Code:       "invalid",
+		Message:    "data",
+	})
+	_ = writeAPI.Errors()
+	ack3 := writeAPI.WritePointWithAck(points[2], 3)
+	assert.Nil(t, ack3.Err())
+	writeAPI.Flush()
+	require.Error(t, ack3.Wait(ctx))
+	assert.Equal(t, ack3.Wait(ctx), ack3.Err())
+	writeAPI.Close()
+}
+
+func TestWriteWithAckClosed(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	log.Log.SetLogLevel(log.DebugLevel)
+	letters := make(chan *write.DeadLetter, 10)
+	opts := write.DefaultOptions().SetBatchSize(1).SetRetryInterval(10000).SetDeadLetterSink(write.NewChannelDeadLetterSink(letters))
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, opts)
+	service.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	_ = writeAPI.Errors()
+	points := test.GenPoints(3)
+	acks := make([]*write.Ack, 0, len(points))
+	for i, p := range points {
+		acks = append(acks, writeAPI.WritePointWithAck(p, i))
+	}
+	writeAPI.waitForFlushing()
+	for _, a := range acks {
+		select {
+		case <-a.Done():
+			assert.Fail(t, "ack resolved before close")
+		default:
+		}
+	}
+	writeAPI.Close()
+	for _, a := range acks {
+		<-a.Done()
+		assert.Error(t, a.Err())
+	}
+	for len(letters) > 0 {
+		<-letters
+	}
+
+	// writes after closing are discarded and passed to the dead letter sink
+	before := writeAPI.LastWriteTime()
+	ack := writeAPI.WritePointWithAck(points[0], 3)
+	assert.ErrorIs(t, ack.Err(), write.ErrWriteAPIClosed)
+	writeAPI.WriteRecord("a a=1i")
+	writeAPI.Flush()
+	assert.Equal(t, before, writeAPI.LastWriteTime())
+	require.Len(t, letters, 2)
+	letter := <-letters
+	assert.Equal(t, write.DeadLetterClosed, letter.Reason)
+	assert.ErrorIs(t, letter.Err, write.ErrWriteAPIClosed)
+	line, err := writeAPI.service.EncodePoints(points[0])
+	require.NoError(t, err)
+	assert.Equal(t, line, letter.Batch)
+	letter = <-letters
+	assert.Equal(t, write.DeadLetterClosed, letter.Reason)
+	assert.Equal(t, "a a=1i\n", letter.Batch)
+}
+
+func TestWriteConcurrency(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	log.Log.SetLogLevel(log.DebugLevel)
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(5).SetConcurrency(3))
+	release := make(chan struct{})
+	service.SetRequestHandler(func(url string, body io.Reader) error {
+		<-release
+		return service.DecodeLines(body)
+	})
+	points := test.GenPoints(15)
+	for _, p := range points {
+		writeAPI.WritePoint(p)
+	}
+	// all batches are being sent at the same time
+	require.Eventually(t, func() bool {
+		return writeAPI.InFlightRequests() == 3
+	}, time.Second, time.Millisecond)
+	close(release)
+	writeAPI.Flush()
+	assert.Equal(t, 0, writeAPI.InFlightRequests())
+	assert.Len(t, service.Lines(), 15)
+	writeAPI.Close()
+}
+
+func TestWriteProcessedRecords(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	opts := write.DefaultOptions().SetBatchSize(2).SetProcessRecords(true).AddDefaultTag("env", "prod")
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, opts)
+	errCh := writeAPI.Errors()
+	var recErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		recErr = <-errCh
+		wg.Done()
+	}()
+	writeAPI.WriteRecord("cpu,host=a usage=1.5 10")
+	writeAPI.WriteRecord("cpu,host=a usage=")
+	writeAPI.WriteRecord("cpu,host=b usage=2 20")
+	wg.Wait()
+	require.Error(t, recErr)
+	writeAPI.Close()
+	require.Len(t, service.Lines(), 2)
+	assert.Equal(t, "cpu,env=prod,host=a usage=1.5 10", service.Lines()[0])
+	assert.Equal(t, "cpu,env=prod,host=b usage=2 20", service.Lines()[1])
+
+	// invalid records don't block when errors are not read
+	writeAPI = NewWriteAPI("my-org", "my-bucket", service, opts)
+	ack := writeAPI.WriteRecordWithAck("cpu,host=a usage=", nil)
+	writeAPI.WriteRecord("cpu,host=b usage=")
+	writeAPI.Close()
+	assert.Error(t, ack.Err())
+}
+
+func TestWritePartialWriteError(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	service.SetReplyError(&http.Error{
+		StatusCode: 400,
+		Code:       "invalid",
+		Message:    "partial write: field type conflict: input field \"value\" on measurement \"cpu\" is type float, already exists as type integer dropped=1",
+	})
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(2))
+	var cbErr http.Error
+	writeAPI.SetWriteFailedCallback(func(batch string, error http.Error, retryAttempts uint) bool {
+		cbErr = error
+		return true
+	})
+	errCh := writeAPI.Errors()
+	var recErr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		recErr = <-errCh
+		wg.Done()
+	}()
+	writeAPI.WriteRecord("cpu value=1i")
+	writeAPI.WriteRecord("cpu value=1.5")
+	wg.Wait()
+	var pe *write.PartialWriteError
+	require.ErrorAs(t, recErr, &pe)
+	assert.Equal(t, 1, pe.Dropped)
+	assert.ErrorAs(t, &cbErr, &pe)
+	writeAPI.Close()
+	assert.Equal(t, 1, service.Requests())
+}
+
+func TestWriteMaxBatchBytes(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	// each record has 10 bytes with new line, two records fit into a batch
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(100).SetMaxBatchBytes(25))
+	for i := 0; i < 5; i++ {
+		writeAPI.WriteRecord(fmt.Sprintf("m f=%05d", i))
+	}
+	writeAPI.Flush()
+	// two full batches and the rest flushed
+	assert.Equal(t, 3, service.Requests())
+	assert.Len(t, service.Lines(), 5)
+	writeAPI.Close()
+}
+
+func TestCloseWithContext(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(5))
+	points := test.GenPoints(12)
+	for _, p := range points {
+		writeAPI.WritePoint(p)
+	}
+	report, err := writeAPI.CloseWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, service.Lines(), 12)
+	// the first two batches could be written before closing
+	assert.LessOrEqual(t, report.DeliveredBatches, 3)
+	assert.GreaterOrEqual(t, report.DeliveredBatches, 1)
+	assert.Equal(t, 0, report.AbandonedBatches)
+	assert.Equal(t, 0, report.PersistedBatches)
+
+	service.Close()
+	service.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	writeAPI = NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(5).SetRetryInterval(10000))
+	var undelivered []string
+	writeAPI.SetUndeliveredCallback(func(batch string) {
+		undelivered = append(undelivered, batch)
+	})
+	for _, p := range points {
+		writeAPI.WritePoint(p)
+	}
+	report, err = writeAPI.CloseWithContext(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, service.Lines(), 0)
+	assert.Equal(t, write.ShutdownReport{AbandonedBatches: 3, AbandonedPoints: 12}, report)
+	require.Len(t, undelivered, 3)
+	assert.Equal(t, 2, strings.Count(undelivered[2], "\n"))
+}
+
+func TestWriteSucceededCallback(t *testing.T) {
+	service := test.NewTestService(t, "http://localhost:8888")
+	writeAPI := NewWriteAPI("my-org", "my-bucket", service, write.DefaultOptions().SetBatchSize(5).SetRetryInterval(1))
+	var results []write.Result
+	writeAPI.SetWriteSucceededCallback(func(result write.Result) {
+		results = append(results, result)
+	})
+	service.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	points := test.GenPoints(10)
+	for _, p := range points[:5] {
+		writeAPI.WritePoint(p)
+	}
+	writeAPI.waitForFlushing()
+	assert.Len(t, results, 0)
+	service.SetReplyError(nil)
+	<-time.After(5 * time.Millisecond)
+	for _, p := range points[5:] {
+		writeAPI.WritePoint(p)
+	}
+	writeAPI.Close()
+	require.Len(t, service.Lines(), 10)
+	require.Len(t, results, 2)
+	assert.Equal(t, 5, results[0].Lines)
+	assert.Equal(t, len(results[0].Batch), results[0].Bytes)
+	assert.EqualValues(t, 2, results[0].Attempts)
+	assert.EqualValues(t, 1, results[1].Attempts)
+}
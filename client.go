@@ -16,6 +16,7 @@ import (
 
 	"github.com/influxdata/influxdb-client-go/v2/api"
 	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/influxdata/influxdb-client-go/v2/domain"
 	ilog "github.com/influxdata/influxdb-client-go/v2/internal/log"
 	"github.com/influxdata/influxdb-client-go/v2/log"
@@ -44,21 +45,56 @@ type Client interface {
 	// Close ensures all ongoing asynchronous write clients finish.
 	// Also closes all idle connections, in case of HTTP client was created internally.
 	Close()
+	// Shutdown ensures all ongoing asynchronous write clients finish, the same way as Close, but flushing of pending writes is interrupted when ctx is done.
+	// It returns report of batches delivered and abandoned during the shutdown, and ctx.Err() if flushing was interrupted.
+	// Batches abandoned by a write client are passed to its api.UndeliveredCallback.
+	Shutdown(ctx context.Context) (write.ShutdownReport, error)
 	// Options returns the options associated with client
 	Options() *Options
 	// ServerURL returns the url of the server url client talks to
 	ServerURL() string
 	// HTTPService returns underlying HTTP service object used by client
 	HTTPService() http.Service
+	// Endpoints returns pool of endpoints of client created by NewClientWithEndpoints, with their health.
+	// It returns nil for client with a single server URL.
+	Endpoints() *http.EndpointPool
 	// WriteAPI returns the asynchronous, non-blocking, Write client.
 	// Ensures using a single WriteAPI instance for each org/bucket pair.
+	// When the write client is released from the cache, because of Options.SetMaxWriteAPIs or Options.SetWriteAPIIdleTimeout,
+	// its data are flushed and the next write to the returned WriteAPI creates a new one, with the same callbacks.
+	// Errors of all of them are reported by the same Errors channel. Data written after closing the client are discarded.
 	WriteAPI(org, bucket string) api.WriteAPI
 	// WriteAPIBlocking returns the synchronous, blocking, Write client.
 	// Ensures using a single WriteAPIBlocking instance for each org/bucket pair.
 	WriteAPIBlocking(org, bucket string) api.WriteAPIBlocking
+	// WriteAPIV1 returns the asynchronous, non-blocking, Write client for database and retention policy of InfluxDB 1.x, using the /write endpoint.
+	// Empty retentionPolicy means the default one. If username is not empty, it is used with password for authentication instead of the client token.
+	// Ensures using a single WriteAPI instance for each database/retention policy/username, released the same way as in WriteAPI.
+	WriteAPIV1(database, retentionPolicy, username, password string) api.WriteAPI
+	// WriteAPIBlockingV1 returns the synchronous, blocking, Write client for database and retention policy of InfluxDB 1.x, using the /write endpoint.
+	// Empty retentionPolicy means the default one. If username is not empty, it is used with password for authentication instead of the client token.
+	// Ensures using a single WriteAPIBlocking instance for each database/retention policy/username.
+	WriteAPIBlockingV1(database, retentionPolicy, username, password string) api.WriteAPIBlocking
+	// WriteAPIs returns descriptions of cached write clients, non-blocking ones followed by blocking ones, from the most recently used.
+	// Number of cached write clients is limited by Options.SetMaxWriteAPIs, unused ones are released after Options.SetWriteAPIIdleTimeout.
+	WriteAPIs() []WriteAPIInfo
+	// ReleaseWriteAPI removes write clients for org and bucket from the cache. The non-blocking one is flushed and closed,
+	// data written to it afterwards create a new one. Subsequent WriteAPIBlocking calls create a new blocking write client.
+	ReleaseWriteAPI(org, bucket string)
+	// ReleaseWriteAPIV1 removes write clients for database, retention policy and username from the cache, the same way as ReleaseWriteAPI.
+	ReleaseWriteAPIV1(database, retentionPolicy, username string)
+	// RouterWriteAPI returns new asynchronous, non-blocking, Write client writing data to the org and bucket selected by route.
+	// Write clients for the targets are created on demand and closed when not used for idleTimeout, zero value means never.
+	// The router is closed when the client is closed.
+	RouterWriteAPI(route api.RouteFunc, idleTimeout time.Duration) *api.RouterWriteAPI
 	// QueryAPI returns Query client.
 	// Ensures using a single QueryAPI instance each org.
 	QueryAPI(org string) api.QueryAPI
+	// InfluxQLQueryAPI returns InfluxQL query client using the v1 compatible /query endpoint, which requests responses in the JSON format.
+	InfluxQLQueryAPI() api.InfluxQLQueryAPI
+	// InfluxQLQueryAPIV1 returns InfluxQL query client the same way as InfluxQLQueryAPI,
+	// which authenticates requests by username and password of InfluxDB 1.x instead of the token.
+	InfluxQLQueryAPIV1(username, password string) api.InfluxQLQueryAPI
 	// AuthorizationsAPI returns Authorizations API client.
 	AuthorizationsAPI() api.AuthorizationsAPI
 	// OrganizationsAPI returns Organizations API client
@@ -73,6 +109,9 @@ type Client interface {
 	LabelsAPI() api.LabelsAPI
 	// TasksAPI returns Tasks API client
 	TasksAPI() api.TasksAPI
+	// Stats returns statistics of writes of all write clients created by this client.
+	// RetryQueueDepth and InFlightRequests are summed over the asynchronous write clients.
+	Stats() write.Stats
 
 	APIClient() *domain.Client
 }
@@ -81,8 +120,9 @@ type Client interface {
 type clientImpl struct {
 	serverURL     string
 	options       *Options
-	writeAPIs     map[string]api.WriteAPI
-	syncWriteAPIs map[string]api.WriteAPIBlocking
+	writeAPIs     *writerCache
+	syncWriteAPIs *writerCache
+	routers       []*api.RouterWriteAPI
 	lock          sync.Mutex
 	httpService   http.Service
 	apiClient     *domain.Client
@@ -93,6 +133,21 @@ type clientImpl struct {
 	bucketsAPI    api.BucketsAPI
 	labelsAPI     api.LabelsAPI
 	tasksAPI      api.TasksAPI
+	stats         *write.StatsCollector
+	endpoints     *http.EndpointPool
+	// closed to stop releasing of idle write clients, nil if it is not running
+	idleStop chan struct{}
+	// waits for release of idle and evicted write clients
+	releaseWg sync.WaitGroup
+	// channels closed when write clients being released are closed, by cache keys
+	releasing map[string]chan struct{}
+	// handles of non-blocking write clients by cache keys, they are kept until Close
+	handles map[string]*writeAPIHandle
+}
+
+// observable is implemented by write clients accepting additional observers
+type observable interface {
+	AddObserver(observer write.Observer)
 }
 
 type clientDoer struct {
@@ -118,11 +173,37 @@ func NewClientWithOptions(serverURL string, authToken string, options *Options)
 		// For subsequent path parts concatenation, url has to end with '/'
 		normServerURL = serverURL + "/"
 	}
-	authorization := ""
+	service := http.NewService(normServerURL, authorization(authToken), options.httpOptions)
+	return newClient(serverURL, authToken, service, options)
+}
+
+// NewClientWithEndpoints creates Client for connecting to several InfluxDB servers, such as data nodes of a cluster,
+// with provided authentication token and configured with custom Options.
+// Writes, queries and management calls are sent to the endpoint selected by http.Options.EndpointStrategy
+// and re-routed to other endpoints when it becomes unhealthy, see http.EndpointPool.
+// Health of endpoints is returned and checked by Client.Endpoints.
+// It returns error if serverURLs is empty or contains an invalid URL.
+func NewClientWithEndpoints(serverURLs []string, authToken string, options *Options) (Client, error) {
+	pool, err := http.NewEndpointPool(serverURLs, options.httpOptions)
+	if err != nil {
+		return nil, err
+	}
+	service := http.NewEndpointService(pool, authorization(authToken), options.httpOptions)
+	client := newClient(serverURLs[0], authToken, service, options)
+	client.endpoints = pool
+	return client, nil
+}
+
+// authorization returns value of the authorization header for authToken
+func authorization(authToken string) string {
 	if len(authToken) > 0 {
-		authorization = "Token " + authToken
+		return "Token " + authToken
 	}
-	service := http.NewService(normServerURL, authorization, options.httpOptions)
+	return ""
+}
+
+// newClient creates client sending requests by service, serverURL is returned by ServerURL
+func newClient(serverURL string, authToken string, service http.Service, options *Options) *clientImpl {
 	doer := &clientDoer{service}
 
 	apiClient, _ := domain.NewClient(service.ServerURL(), doer)
@@ -130,10 +211,13 @@ func NewClientWithOptions(serverURL string, authToken string, options *Options)
 	client := &clientImpl{
 		serverURL:     serverURL,
 		options:       options,
-		writeAPIs:     make(map[string]api.WriteAPI, 5),
-		syncWriteAPIs: make(map[string]api.WriteAPIBlocking, 5),
+		writeAPIs:     newWriterCache(int(options.MaxWriteAPIs())),
+		syncWriteAPIs: newWriterCache(int(options.MaxWriteAPIs())),
+		releasing:     make(map[string]chan struct{}),
+		handles:       make(map[string]*writeAPIHandle),
 		httpService:   service,
 		apiClient:     apiClient,
+		stats:         write.NewStatsCollector(),
 	}
 	if log.Log != nil {
 		log.Log.SetLogLevel(options.LogLevel())
@@ -167,6 +251,10 @@ func (c *clientImpl) HTTPService() http.Service {
 	return c.httpService
 }
 
+func (c *clientImpl) Endpoints() *http.EndpointPool {
+	return c.endpoints
+}
+
 func (c *clientDoer) Do(req *httpnet.Request) (*httpnet.Response, error) {
 	return c.service.DoHTTPRequestWithResponse(req, nil)
 }
@@ -221,45 +309,274 @@ func createKey(org, bucket string) string {
 }
 
 func (c *clientImpl) WriteAPI(org, bucket string) api.WriteAPI {
+	return c.writeAPI(createKey(org, bucket), WriteAPIInfo{Org: org, Bucket: bucket}, func() *api.WriteAPIImpl {
+		return api.NewWriteAPI(org, bucket, c.httpService, c.options.writeOptions, c.stats)
+	})
+}
+
+func (c *clientImpl) WriteAPIBlocking(org, bucket string) api.WriteAPIBlocking {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	key := createKey(org, bucket)
-	if _, ok := c.writeAPIs[key]; !ok {
-		w := api.NewWriteAPI(org, bucket, c.httpService, c.options.writeOptions)
-		c.writeAPIs[key] = w
+	if w, ok := c.syncWriteAPIs.get(key); ok {
+		return w.(api.WriteAPIBlocking)
 	}
-	return c.writeAPIs[key]
+	w := api.NewWriteAPIBlocking(org, bucket, c.httpService, c.options.writeOptions)
+	w.(observable).AddObserver(c.stats)
+	c.cacheWriteAPI(c.syncWriteAPIs, key, WriteAPIInfo{Org: org, Bucket: bucket, Blocking: true}, w)
+	return w
 }
 
-func (c *clientImpl) WriteAPIBlocking(org, bucket string) api.WriteAPIBlocking {
+func createKeyV1(database, retentionPolicy, username string) string {
+	return "v1\t" + database + "\t" + retentionPolicy + "\t" + username
+}
+
+func (c *clientImpl) WriteAPIV1(database, retentionPolicy, username, password string) api.WriteAPI {
+	info := WriteAPIInfo{Database: database, RetentionPolicy: retentionPolicy, Username: username}
+	return c.writeAPI(createKeyV1(database, retentionPolicy, username), info, func() *api.WriteAPIImpl {
+		return api.NewWriteAPIV1(database, retentionPolicy, username, password, c.httpService, c.options.writeOptions, c.stats)
+	})
+}
+
+func (c *clientImpl) WriteAPIBlockingV1(database, retentionPolicy, username, password string) api.WriteAPIBlocking {
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	key := createKey(org, bucket)
-	if _, ok := c.syncWriteAPIs[key]; !ok {
-		w := api.NewWriteAPIBlocking(org, bucket, c.httpService, c.options.writeOptions)
-		c.syncWriteAPIs[key] = w
+	key := createKeyV1(database, retentionPolicy, username)
+	if w, ok := c.syncWriteAPIs.get(key); ok {
+		return w.(api.WriteAPIBlocking)
+	}
+	w := api.NewWriteAPIBlockingV1(database, retentionPolicy, username, password, c.httpService, c.options.writeOptions)
+	w.(observable).AddObserver(c.stats)
+	c.cacheWriteAPI(c.syncWriteAPIs, key, WriteAPIInfo{Database: database, RetentionPolicy: retentionPolicy, Username: username, Blocking: true}, w)
+	return w
+}
+
+// writeAPI returns handle of non-blocking write client with key, whose write client is created by create, if it is not cached
+func (c *clientImpl) writeAPI(key string, info WriteAPIInfo, create func() *api.WriteAPIImpl) api.WriteAPI {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	h, ok := c.handles[key]
+	if !ok {
+		h = newWriteAPIHandle(c, key, info, create)
+		c.handles[key] = h
+	}
+	c.cacheHandle(h)
+	return h
+}
+
+// attachWriteAPI caches the write client of h, a new one is created if the previous one was released
+func (c *clientImpl) attachWriteAPI(h *writeAPIHandle) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cacheHandle(h)
+}
+
+// cacheHandle caches the write client of h, a new one is created if the previous one was released.
+// If the previous write client is being released, it waits until it is closed, so that a new one doesn't share its persistent retry queue.
+// It must be called with the lock held, which is released while waiting.
+func (c *clientImpl) cacheHandle(h *writeAPIHandle) {
+	for {
+		if _, ok := c.writeAPIs.get(h.key); ok {
+			return
+		}
+		if c.handles[h.key] != h {
+			// h was closed meanwhile
+			return
+		}
+		done, ok := c.releasing[h.key]
+		if !ok {
+			break
+		}
+		c.lock.Unlock()
+		<-done
+		c.lock.Lock()
+	}
+	h.reopen()
+	c.cacheWriteAPI(c.writeAPIs, h.key, h.info, h)
+}
+
+// cacheWriteAPI adds write client w to cache, releases write clients evicted from the cache
+// and starts releasing of idle write clients, if enabled. It must be called with the lock held.
+func (c *clientImpl) cacheWriteAPI(cache *writerCache, key string, info WriteAPIInfo, w interface{}) {
+	c.releaseWriteAPIs(cache.add(key, info, w))
+	if c.options.WriteAPIIdleTimeout() > 0 && c.idleStop == nil {
+		c.idleStop = make(chan struct{})
+		c.releaseWg.Add(1)
+		go c.releaseIdleProc(c.idleStop)
+	}
+}
+
+// releaseIdleProc periodically releases write clients not used for the idle timeout, until stop is closed
+func (c *clientImpl) releaseIdleProc(stop <-chan struct{}) {
+	defer c.releaseWg.Done()
+	timeout := time.Duration(c.options.WriteAPIIdleTimeout()) * time.Millisecond
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			before := time.Now().Add(-timeout)
+			c.lock.Lock()
+			c.releaseWriteAPIs(c.writeAPIs.removeIdle(before))
+			c.syncWriteAPIs.removeIdle(before)
+			c.lock.Unlock()
+		case <-stop:
+			return
+		}
 	}
-	return c.syncWriteAPIs[key]
+}
+
+// releaseWriteAPIs flushes and closes non-blocking write clients removed from the cache on the background.
+// It must be called with the lock held.
+func (c *clientImpl) releaseWriteAPIs(entries []*cachedWriter) {
+	for _, e := range entries {
+		if h, ok := e.writer.(*writeAPIHandle); ok {
+			c.startRelease(e.key, h)
+		}
+	}
+}
+
+// startRelease flushes and closes write client of h with key on the background and returns channel closed when it is closed.
+// The next write to h creates a new write client. It must be called with the lock held.
+func (c *clientImpl) startRelease(key string, h *writeAPIHandle) <-chan struct{} {
+	ilog.Debug("Releasing write client")
+	done := make(chan struct{})
+	c.releasing[key] = done
+	// following writes to h wait for a new write client
+	w := h.detach()
+	c.releaseWg.Add(1)
+	go func() {
+		defer c.releaseWg.Done()
+		w.Close()
+		c.lock.Lock()
+		if c.releasing[key] == done {
+			delete(c.releasing, key)
+		}
+		c.lock.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (c *clientImpl) WriteAPIs() []WriteAPIInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append(c.writeAPIs.infos(), c.syncWriteAPIs.infos()...)
+}
+
+func (c *clientImpl) ReleaseWriteAPI(org, bucket string) {
+	c.releaseWriteAPI(createKey(org, bucket))
+}
+
+func (c *clientImpl) ReleaseWriteAPIV1(database, retentionPolicy, username string) {
+	c.releaseWriteAPI(createKeyV1(database, retentionPolicy, username))
+}
+
+// releaseWriteAPI removes write clients with key from the cache, the non-blocking one is flushed and closed
+func (c *clientImpl) releaseWriteAPI(key string) {
+	c.lock.Lock()
+	w, ok := c.writeAPIs.remove(key)
+	c.syncWriteAPIs.remove(key)
+	var done <-chan struct{}
+	if ok {
+		done = c.startRelease(key, w.(*writeAPIHandle))
+	}
+	c.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (c *clientImpl) RouterWriteAPI(route api.RouteFunc, idleTimeout time.Duration) *api.RouterWriteAPI {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	r := api.NewRouterWriteAPI(c.httpService, c.options.writeOptions, route, idleTimeout)
+	r.AddObserver(c.stats)
+	c.routers = append(c.routers, r)
+	return r
+}
+
+func (c *clientImpl) Stats() write.Stats {
+	stats := c.stats.Stats()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, w := range c.writeAPIs.writers() {
+		wa := w.(*writeAPIHandle).current()
+		stats.RetryQueueDepth += wa.RetryQueueDepth()
+		stats.InFlightRequests += wa.InFlightRequests()
+	}
+	for _, r := range c.routers {
+		stats.RetryQueueDepth += r.RetryQueueDepth()
+		stats.InFlightRequests += r.InFlightRequests()
+	}
+	return stats
 }
 
 func (c *clientImpl) Close() {
-	for key, w := range c.writeAPIs {
-		wa := w.(*api.WriteAPIImpl)
-		wa.Close()
-		delete(c.writeAPIs, key)
+	_, _ = c.Shutdown(context.Background())
+}
+
+func (c *clientImpl) Shutdown(ctx context.Context) (write.ShutdownReport, error) {
+	var report write.ShutdownReport
+	var err error
+	c.lock.Lock()
+	if c.idleStop != nil {
+		close(c.idleStop)
+		c.idleStop = nil
 	}
-	for key := range c.syncWriteAPIs {
-		delete(c.syncWriteAPIs, key)
+	handles := c.handles
+	c.handles = make(map[string]*writeAPIHandle)
+	writers := make([]*api.WriteAPIImpl, 0, len(handles))
+	for key, h := range handles {
+		w := h.close()
+		// write clients being released are closed by the release
+		if _, ok := c.releasing[key]; w != nil && !ok {
+			writers = append(writers, w)
+		}
+	}
+	c.writeAPIs.clear()
+	c.syncWriteAPIs.clear()
+	routers := c.routers
+	c.routers = nil
+	c.lock.Unlock()
+	// wait for release of evicted and idle write clients
+	c.releaseWg.Wait()
+	for _, w := range writers {
+		// write clients are closed with the same ctx, so those closed after the deadline only abandon their batches
+		r, cerr := w.CloseWithContext(ctx)
+		report.Add(r)
+		if cerr != nil {
+			err = cerr
+		}
+	}
+	for _, h := range handles {
+		h.closeErrors()
+	}
+	for _, router := range routers {
+		r, cerr := router.CloseWithContext(ctx)
+		report.Add(r)
+		if cerr != nil {
+			err = cerr
+		}
 	}
 	if c.options.HTTPOptions().OwnHTTPClient() {
 		c.options.HTTPOptions().HTTPClient().CloseIdleConnections()
 	}
+	return report, err
 }
 
 func (c *clientImpl) QueryAPI(org string) api.QueryAPI {
 	return api.NewQueryAPI(org, c.httpService)
 }
 
+func (c *clientImpl) InfluxQLQueryAPI() api.InfluxQLQueryAPI {
+	return api.NewInfluxQLQueryAPI(c.httpService, api.InfluxQLFormatJSON)
+}
+
+func (c *clientImpl) InfluxQLQueryAPIV1(username, password string) api.InfluxQLQueryAPI {
+	return api.NewInfluxQLQueryAPIV1(username, password, c.httpService, api.InfluxQLFormatJSON)
+}
+
 func (c *clientImpl) AuthorizationsAPI() api.AuthorizationsAPI {
 	c.lock.Lock()
 	defer c.lock.Unlock()
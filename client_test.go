@@ -7,21 +7,28 @@ package influxdb2
 import (
 	"context"
 	"fmt"
+	"io"
 	ilog "github.com/influxdata/influxdb-client-go/v2/log"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"runtime"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/influxdata/influxdb-client-go/v2/api"
 	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/influxdata/influxdb-client-go/v2/domain"
 	http2 "github.com/influxdata/influxdb-client-go/v2/internal/http"
 	iwrite "github.com/influxdata/influxdb-client-go/v2/internal/write"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestUrls(t *testing.T) {
@@ -70,15 +77,15 @@ func TestWriteAPIManagement(t *testing.T) {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
 			w := c.WriteAPI(d.org, d.bucket)
 			assert.NotNil(t, w)
-			assert.Len(t, c.writeAPIs, d.expectedCout)
+			assert.Len(t, c.writeAPIs.entries, d.expectedCout)
 			wb := c.WriteAPIBlocking(d.org, d.bucket)
 			assert.NotNil(t, wb)
-			assert.Len(t, c.syncWriteAPIs, d.expectedCout)
+			assert.Len(t, c.syncWriteAPIs.entries, d.expectedCout)
 		})
 	}
 	c.Close()
-	assert.Len(t, c.writeAPIs, 0)
-	assert.Len(t, c.syncWriteAPIs, 0)
+	assert.Len(t, c.writeAPIs.entries, 0)
+	assert.Len(t, c.syncWriteAPIs.entries, 0)
 }
 
 func TestUserAgentBase(t *testing.T) {
@@ -185,6 +192,44 @@ func TestServerOnPath(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestWriteV1(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := NewClientWithOptions(server.URL+"/influx", "my-token", DefaultOptions().SetPrecision(time.Microsecond))
+	c.Options().WriteOptions().SetConsistency(write.ConsistencyOne)
+	err := c.WriteAPIBlockingV1("telegraf", "autogen", "my-user", "my-password").WriteRecord(context.Background(), "a,a=a a=1i")
+	require.NoError(t, err)
+	w := c.WriteAPIV1("telegraf", "", "", "")
+	assert.Same(t, w, c.WriteAPIV1("telegraf", "", "", ""))
+	w.WriteRecord("b,a=a a=2i")
+	c.Close()
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/influx/write", requests[0].URL.Path)
+	assert.Equal(t, "consistency=one&db=telegraf&precision=u&rp=autogen", requests[0].URL.RawQuery)
+	user, password, ok := requests[0].BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "my-user", user)
+	assert.Equal(t, "my-password", password)
+	assert.Equal(t, "a,a=a a=1i", bodies[0])
+
+	assert.Equal(t, "/influx/write", requests[1].URL.Path)
+	assert.Equal(t, "consistency=one&db=telegraf&precision=u", requests[1].URL.RawQuery)
+	assert.Equal(t, "Token my-token", requests[1].Header.Get("Authorization"))
+	assert.Equal(t, "b,a=a a=2i\n", bodies[1])
+}
+
 func TestServerErrorNonJSON(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		<-time.After(100 * time.Millisecond)
@@ -260,3 +305,308 @@ func TestHealthFail(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, h)
 }
+
+func TestStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "invalid") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetBatchSize(2))
+	err := c.WriteAPIBlocking("my-org", "my-bucket").WriteRecord(context.Background(), "a a=1i", "a a=2i")
+	require.NoError(t, err)
+	err = c.WriteAPIBlocking("my-org", "my-bucket").WriteRecord(context.Background(), "a invalid=1i")
+	require.Error(t, err)
+	w := c.WriteAPI("my-org", "my-bucket")
+	for i := 0; i < 5; i++ {
+		w.WriteRecord(fmt.Sprintf("b a=%di", i))
+	}
+	w.Flush()
+
+	stats := c.Stats()
+	assert.EqualValues(t, 5, stats.BatchesCreated)
+	assert.EqualValues(t, 5, stats.Requests)
+	assert.EqualValues(t, 1, stats.FailedRequests)
+	assert.EqualValues(t, 4, stats.BatchesWritten)
+	assert.EqualValues(t, 1, stats.BatchesDropped)
+	assert.EqualValues(t, 7, stats.PointsWritten)
+	assert.EqualValues(t, 1, stats.PointsLost)
+	assert.Error(t, stats.LastError)
+	assert.False(t, stats.LastSuccess.IsZero())
+	assert.Equal(t, 0, stats.RetryQueueDepth)
+	assert.Equal(t, 0, stats.InFlightRequests)
+	c.Close()
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// don't finish writes until the end of the test
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetBatchSize(2))
+	w := c.WriteAPI("my-org", "my-bucket")
+	var undelivered []string
+	w.SetUndeliveredCallback(func(batch string) {
+		undelivered = append(undelivered, batch)
+	})
+	w.WriteRecord("a a=1i")
+	w.WriteRecord("a a=2i")
+	w.WriteRecord("a a=3i")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	report, err := c.Shutdown(ctx)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, write.ShutdownReport{AbandonedBatches: 2, AbandonedPoints: 3}, report)
+	assert.ElementsMatch(t, []string{"a a=1i\na a=2i\n", "a a=3i\n"}, undelivered)
+}
+
+func TestRouterWriteAPI(t *testing.T) {
+	var lock sync.Mutex
+	var buckets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		buckets = append(buckets, r.URL.Query().Get("bucket"))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions())
+	router := c.RouterWriteAPI(api.RouteByRules(api.RoutingRule{Tag: "tenant", Org: "my-org"}), time.Minute)
+	router.WriteRecord("a,tenant=t1 a=1i")
+	router.WriteRecord("a,tenant=t2 a=2i")
+	router.WriteRecord("a,tenant=t1 a=3i")
+	report, err := c.Shutdown(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, write.ShutdownReport{DeliveredBatches: 2, DeliveredPoints: 3}, report)
+	assert.ElementsMatch(t, []string{"t1", "t2"}, buckets)
+	assert.EqualValues(t, 3, c.Stats().PointsWritten)
+}
+
+func TestWriteAPICache(t *testing.T) {
+	var lock sync.Mutex
+	var buckets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		buckets = append(buckets, r.URL.Query().Get("bucket"))
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	written := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]string(nil), buckets...)
+	}
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetMaxWriteAPIs(2))
+	w1 := c.WriteAPI("my-org", "b1")
+	w1.WriteRecord("a a=1i")
+	c.WriteAPI("my-org", "b2").WriteRecord("a a=2i")
+	c.WriteAPIBlocking("my-org", "b1")
+	c.WriteAPIV1("db", "", "", "")
+	// the least recently used write client is flushed and closed
+	require.Eventually(t, func() bool {
+		return len(written()) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"b1"}, written())
+	infos := c.WriteAPIs()
+	require.Len(t, infos, 3)
+	assert.Equal(t, WriteAPIInfo{Database: "db", LastUsed: infos[0].LastUsed}, infos[0])
+	assert.Equal(t, WriteAPIInfo{Org: "my-org", Bucket: "b2", LastUsed: infos[1].LastUsed}, infos[1])
+	assert.Equal(t, WriteAPIInfo{Org: "my-org", Bucket: "b1", Blocking: true, LastUsed: infos[2].LastUsed}, infos[2])
+	// the released write client is created again by the next write, b2 is the least recently used one now
+	ack := w1.WriteRecordWithAck("a a=3i", 1)
+	require.Eventually(t, func() bool {
+		return len(written()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"b1", "b2"}, written())
+	assert.Equal(t, w1, c.WriteAPI("my-org", "b1"))
+
+	c.ReleaseWriteAPIV1("db", "", "")
+	require.Len(t, c.WriteAPIs(), 2)
+	c.ReleaseWriteAPI("my-org", "b1")
+	require.NoError(t, ack.Wait(context.Background()))
+	assert.Equal(t, []string{"b1", "b2", "b1"}, written())
+	assert.Len(t, c.WriteAPIs(), 0)
+	c.Close()
+	assert.Len(t, c.WriteAPIs(), 0)
+}
+
+func TestWriteAPIRecreatedAfterRelease(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("bucket") == "b1" {
+			<-unblock
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetMaxWriteAPIs(1))
+	w1 := c.WriteAPI("my-org", "b1")
+	w1.WriteRecord("a a=1i")
+	// b1 is evicted, its close waits for the server
+	c.WriteAPI("my-org", "b2")
+	written := make(chan struct{})
+	go func() {
+		w1.WriteRecord("a a=2i")
+		close(written)
+	}()
+	select {
+	case <-written:
+		assert.Fail(t, "write client created before the released one is closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(unblock)
+	select {
+	case <-written:
+	case <-time.After(time.Second):
+		assert.Fail(t, "write client not created after the released one is closed")
+	}
+	// the handle is kept
+	assert.Equal(t, w1, c.WriteAPI("my-org", "b1"))
+	c.Close()
+	assert.EqualValues(t, 2, c.Stats().PointsWritten)
+}
+
+func TestWriteAPIIdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetWriteAPIIdleTimeout(100))
+	w := c.WriteAPI("my-org", "b1")
+	c.WriteAPIBlocking("my-org", "b1")
+	c.WriteAPI("my-org", "b2")
+	// writes keep the write client used
+	for i := 0; i < 6; i++ {
+		w.WriteRecord(fmt.Sprintf("a a=%di", i))
+		time.Sleep(30 * time.Millisecond)
+	}
+	require.Len(t, c.WriteAPIs(), 1)
+	assert.Equal(t, "b1", c.WriteAPIs()[0].Bucket)
+	assert.False(t, c.WriteAPIs()[0].Blocking)
+	require.Eventually(t, func() bool {
+		return len(c.WriteAPIs()) == 0
+	}, time.Second, 10*time.Millisecond)
+	// a write client kept by the caller writes again after it was released
+	w.WriteRecord("a a=6i")
+	require.Len(t, c.WriteAPIs(), 1)
+	// Close waits for the release of idle write clients
+	c.Close()
+	assert.EqualValues(t, 7, c.Stats().PointsWritten)
+	// data written after closing the client are discarded
+	w.WriteRecord("a a=7i")
+	_, ok := <-w.Errors()
+	assert.False(t, ok)
+}
+
+func TestClientWithEndpoints(t *testing.T) {
+	var lock sync.Mutex
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	_, err := NewClientWithEndpoints(nil, "my-token", DefaultOptions())
+	require.Error(t, err)
+	c, err := NewClientWithEndpoints([]string{down.URL, server.URL + "/node2"}, "my-token", DefaultOptions())
+	require.NoError(t, err)
+	assert.Equal(t, down.URL, c.ServerURL())
+	ok, err := c.Ping(context.Background())
+	require.NoError(t, err)
+	assert.True(t, ok)
+	err = c.WriteAPIBlocking("my-org", "my-bucket").WriteRecord(context.Background(), "a a=1i")
+	require.NoError(t, err)
+	status := c.Endpoints().Status()
+	require.Len(t, status, 2)
+	assert.False(t, status[0].Healthy)
+	assert.Error(t, status[0].LastError)
+	assert.True(t, status[1].Healthy)
+	assert.Equal(t, []string{"/node2/ping", "/node2/api/v2/write"}, paths)
+	c.Close()
+
+	assert.Nil(t, NewClient(server.URL, "my-token").Endpoints())
+}
+
+func TestTracing(t *testing.T) {
+	var lock sync.Mutex
+	var traceParents []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		traceParents = append(traceParents, r.Header.Get("Traceparent"))
+		lock.Unlock()
+		if r.URL.Path == "/api/v2/query" {
+			w.Header().Set("Content-Type", "text/csv")
+			_, _ = w.Write([]byte("\r\n"))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := tp.Tracer("test")
+
+	c := NewClientWithOptions(server.URL, "my-token", DefaultOptions().SetTracerProvider(tp))
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	w := c.WriteAPI("my-org", "my-bucket")
+	w.WriteRecordWithContext(ctx, "a a=1i")
+	w.WritePointWithContext(ctx, write.NewPointWithMeasurement("a").AddField("a", 2))
+	w.Flush()
+	require.NoError(t, c.WriteAPIBlocking("my-org", "my-bucket").WriteRecord(ctx, "a a=3i"))
+	res, err := c.QueryAPI("my-org").Query(ctx, `from(bucket:"my-bucket")`)
+	require.NoError(t, err)
+	for res.Next() {
+	}
+	require.NoError(t, res.Close())
+	parent.End()
+	c.Close()
+
+	spans := recorder.Ended()
+	names := make([]string, len(spans))
+	for i, s := range spans {
+		names[i] = s.Name()
+	}
+	require.Equal(t, []string{
+		"influxdb /api/v2/write", "influxdb write batch",
+		"influxdb /api/v2/write", "influxdb write batch",
+		"influxdb /api/v2/query", "parent"}, names)
+	// async batch is linked to the writes
+	assert.False(t, spans[1].Parent().IsValid())
+	require.Len(t, spans[1].Links(), 2)
+	assert.Equal(t, parent.SpanContext(), spans[1].Links()[0].SpanContext)
+	assert.Equal(t, spans[1].SpanContext(), spans[0].Parent())
+	assert.Contains(t, spans[1].Attributes(), attribute.Int("influxdb.points", 2))
+	// blocking write is a child of the caller span
+	assert.Equal(t, parent.SpanContext(), spans[3].Parent())
+	assert.Equal(t, spans[3].SpanContext(), spans[2].Parent())
+	assert.Equal(t, parent.SpanContext(), spans[4].Parent())
+	assert.Contains(t, spans[4].Attributes(), attribute.Int("http.status_code", 200))
+
+	require.Len(t, traceParents, 3)
+	for i, traceParent := range traceParents {
+		span := spans[[]int{0, 2, 4}[i]]
+		assert.Equal(t, fmt.Sprintf("00-%s-%s-01", span.SpanContext().TraceID(), span.SpanContext().SpanID()), traceParent)
+	}
+}
@@ -3,16 +3,32 @@ module github.com/influxdata/influxdb-client-go/v2
 go 1.17
 
 require (
+	github.com/apache/arrow/go/v10 v10.0.1
 	github.com/influxdata/line-protocol v0.0.0-20200327222509-2487e7298839
 	github.com/oapi-codegen/runtime v1.0.0
 	github.com/stretchr/testify v1.8.4 // test dependency
+	go.opentelemetry.io/otel v1.10.0
+	go.opentelemetry.io/otel/sdk v1.10.0 // test dependency
+	go.opentelemetry.io/otel/trace v1.10.0
 	golang.org/x/net v0.23.0
 )
 
 require (
+	github.com/andybalholm/brotli v1.0.5 // indirect
+	github.com/apache/thrift v0.16.0 // indirect
 	github.com/apapsch/go-jsonmerge/v2 v2.0.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/goccy/go-json v0.10.2 // indirect
+	github.com/golang/snappy v0.0.4 // indirect
+	github.com/google/flatbuffers v2.0.8+incompatible // indirect
 	github.com/google/uuid v1.3.1 // indirect
+	github.com/klauspost/compress v1.16.7 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.5 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/zeebo/xxh3 v1.0.2 // indirect
+	golang.org/x/sys v0.18.0 // indirect
+	golang.org/x/xerrors v0.0.0-20220609144429-65e65417b02f // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
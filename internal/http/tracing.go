@@ -0,0 +1,24 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of tracers creating spans of the client
+const TracerName = "github.com/influxdata/influxdb-client-go/v2"
+
+// DBSystem is the db.system attribute of all spans of the client
+var DBSystem = attribute.String("db.system", "influxdb")
+
+// Tracer returns tracer of the client from provider, or nil if provider is nil
+func Tracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		return nil
+	}
+	return provider.Tracer(TracerName)
+}
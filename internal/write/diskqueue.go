@@ -0,0 +1,460 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"bufio"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+)
+
+const (
+	// segmentExt is extension of segment files
+	segmentExt = ".seg"
+	// headFileName is name of file holding position and retry attempts of the oldest batch
+	headFileName = "head"
+	// headSize is size of the head file, position (16 bytes) and retry attempts (4 bytes)
+	headSize = 20
+	// maxSegmentSize is size after which a new segment file is started
+	maxSegmentSize = 16 * 1024 * 1024
+	// recordHeaderSize is size of record length and checksum
+	recordHeaderSize = 8
+	// recordMetaSize is size of retry attempts and expiration in a record
+	recordMetaSize = 12
+)
+
+// position identifies a place in segment files
+type position struct {
+	segment uint64
+	offset  int64
+}
+
+// diskEntry is batch stored in a segment
+type diskEntry struct {
+	batch *write.Batch
+	// position right after the record of batch
+	end position
+}
+
+// diskQueue is write.RetryQueue which persists batches into segment files in a directory,
+// so they survive restart or crash of the application.
+// Batches are appended to the last segment file. The position of the oldest batch is kept in the head file,
+// along with its retry attempts, which are updated by storeAttempts. Segment files containing only removed batches are deleted.
+// Each record in a segment file consists of:
+//   - length of record data, 4 bytes
+//   - CRC32 checksum of record data, 4 bytes
+//   - record data: retry attempts (4 bytes), expiration in Unix ns (8 bytes) and batch payload
+//
+// All batches are held also in memory. Records, which are not complete, e.g. due to crash during write, are dropped when queue is opened.
+// Batches loaded over the limits are kept, exceeded reports them, so that they are evicted by the owner of the queue.
+type diskQueue struct {
+	dir        string
+	list       *list.List
+	maxBatches int
+	maxBytes   int
+	bytes      int
+	// current segment for appending
+	segment *os.File
+	// actual write position
+	tail position
+	// position of the oldest batch
+	head position
+}
+
+// newDiskQueue opens a queue in dir, creates dir if it doesn't exist and loads stored batches.
+// Queue is limited to maxBatches batches and maxBytes total size of batches, zero value means no limit.
+// Loaded batches are not limited, see exceeded.
+func newDiskQueue(dir string, maxBatches, maxBytes int) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	q := &diskQueue{dir: dir, list: list.New(), maxBatches: maxBatches, maxBytes: maxBytes}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *diskQueue) segmentPath(seq uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+// segments returns sorted sequence numbers of existing segment files
+func (q *diskQueue) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// load reads batches from segment files starting at the head position
+func (q *diskQueue) load() error {
+	head, attempts, err := q.readHead()
+	if err != nil {
+		return err
+	}
+	q.head = head
+	seqs, err := q.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq < head.segment {
+			q.removeSegment(seq)
+			continue
+		}
+		var offset int64
+		if seq == head.segment {
+			offset = head.offset
+		}
+		if err := q.loadSegment(seq, offset); err != nil {
+			return err
+		}
+	}
+	if first := q.First(); first != nil {
+		log.Infof("Retry queue: loaded %d batches from %s", q.list.Len(), q.dir)
+		if attempts > first.RetryAttempts {
+			first.RetryAttempts = attempts
+		}
+	}
+	last := head.segment
+	if len(seqs) > 0 && seqs[len(seqs)-1] > last {
+		last = seqs[len(seqs)-1]
+	}
+	if err := q.openSegment(last); err != nil {
+		return err
+	}
+	if q.list.Len() == 0 {
+		return q.writeHead(q.tail)
+	}
+	return nil
+}
+
+// loadSegment reads records from segment seq starting at offset.
+// Segment is truncated at the first incomplete or corrupted record.
+func (q *diskQueue) loadSegment(seq uint64, offset int64) error {
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	for {
+		batch, n, err := readRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			log.Warnf("Retry queue: %s in %s at %d, truncating", err.Error(), q.segmentPath(seq), offset)
+			return f.Truncate(offset)
+		}
+		offset += n
+		q.list.PushBack(&diskEntry{batch: batch, end: position{segment: seq, offset: offset}})
+		q.bytes += len(batch.Batch)
+	}
+}
+
+// readRecord reads single record, which must fit into remaining bytes, and returns batch and number of read bytes
+func readRecord(r io.Reader, remaining int64) (*write.Batch, int64, error) {
+	var header [recordHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, errors.New("incomplete record header")
+	}
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size < recordMetaSize {
+		return nil, 0, fmt.Errorf("invalid record size %d", size)
+	}
+	if recordHeaderSize+int64(size) > remaining {
+		return nil, 0, errors.New("incomplete record")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, errors.New("incomplete record")
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+	batch := &write.Batch{
+		RetryAttempts: uint(binary.BigEndian.Uint32(data[0:4])),
+		Expires:       time.Unix(0, int64(binary.BigEndian.Uint64(data[4:12]))),
+		Batch:         string(data[recordMetaSize:]),
+	}
+	return batch, int64(recordHeaderSize + size), nil
+}
+
+// encodeRecord creates record for batch
+func encodeRecord(batch *write.Batch) []byte {
+	size := recordMetaSize + len(batch.Batch)
+	rec := make([]byte, recordHeaderSize+size)
+	data := rec[recordHeaderSize:]
+	binary.BigEndian.PutUint32(data[0:4], uint32(batch.RetryAttempts))
+	binary.BigEndian.PutUint64(data[4:12], uint64(batch.Expires.UnixNano()))
+	copy(data[recordMetaSize:], batch.Batch)
+	binary.BigEndian.PutUint32(rec[0:4], uint32(size))
+	binary.BigEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(data))
+	return rec
+}
+
+// openSegment opens segment seq for appending
+func (q *diskQueue) openSegment(seq uint64) error {
+	f, err := os.OpenFile(q.segmentPath(seq), os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if offset == 0 {
+		// the new file must survive a crash
+		if err := syncDir(q.dir); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	q.segment = f
+	q.tail = position{segment: seq, offset: offset}
+	return nil
+}
+
+// syncDir flushes changes of entries of dir to the storage. It does nothing on Windows, which doesn't support it.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (q *diskQueue) removeSegment(seq uint64) {
+	if err := os.Remove(q.segmentPath(seq)); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Retry queue: cannot remove segment: %s", err.Error())
+	}
+}
+
+// readHead returns position and retry attempts of the oldest batch
+func (q *diskQueue) readHead() (position, uint, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, headFileName))
+	if os.IsNotExist(err) {
+		return position{}, 0, nil
+	}
+	if err != nil {
+		return position{}, 0, err
+	}
+	// head file of older versions has no retry attempts
+	if len(data) != headSize && len(data) != 16 {
+		log.Warn("Retry queue: invalid head file, reading all segments")
+		return position{}, 0, nil
+	}
+	var attempts uint
+	if len(data) == headSize {
+		attempts = uint(binary.BigEndian.Uint32(data[16:20]))
+	}
+	return position{
+		segment: binary.BigEndian.Uint64(data[0:8]),
+		offset:  int64(binary.BigEndian.Uint64(data[8:16])),
+	}, attempts, nil
+}
+
+// writeHead atomically stores head position with retry attempts of the first batch and removes segments before it
+func (q *diskQueue) writeHead(head position) error {
+	var data [headSize]byte
+	binary.BigEndian.PutUint64(data[0:8], head.segment)
+	binary.BigEndian.PutUint64(data[8:16], uint64(head.offset))
+	if first := q.First(); first != nil {
+		binary.BigEndian.PutUint32(data[16:20], uint32(first.RetryAttempts))
+	}
+	path := filepath.Join(q.dir, headFileName)
+	if err := writeFileSync(path+".tmp", data[:]); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if err := syncDir(q.dir); err != nil {
+		return err
+	}
+	q.head = head
+	seqs, err := q.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq < head.segment {
+			q.removeSegment(seq)
+		}
+	}
+	return nil
+}
+
+// writeFileSync writes data to file at path and flushes it to the storage
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// storeAttempts persists retry attempts of the first batch
+func (q *diskQueue) storeAttempts() error {
+	if q.list.Len() == 0 {
+		return nil
+	}
+	return q.writeHead(q.head)
+}
+
+// exceeded returns true if the queue holds more than allowed by limits
+func (q *diskQueue) exceeded() bool {
+	return (q.maxBatches > 0 && q.list.Len() > q.maxBatches) || (q.maxBytes > 0 && q.bytes > q.maxBytes)
+}
+
+func (q *diskQueue) Push(batch *write.Batch) error {
+	if q.maxBatches > 0 && q.list.Len() >= q.maxBatches {
+		return write.ErrRetryQueueFull
+	}
+	if q.maxBytes > 0 && len(batch.Batch) > q.maxBytes {
+		return write.ErrBatchTooLarge
+	}
+	if q.maxBytes > 0 && q.bytes+len(batch.Batch) > q.maxBytes {
+		return write.ErrRetryQueueFull
+	}
+	if q.tail.offset >= maxSegmentSize {
+		prev := q.segment
+		if err := q.openSegment(q.tail.segment + 1); err != nil {
+			return fmt.Errorf("cannot create segment: %w", err)
+		}
+		if err := prev.Close(); err != nil {
+			log.Warnf("Retry queue: cannot close segment: %s", err.Error())
+		}
+	}
+	rec := encodeRecord(batch)
+	_, err := q.segment.Write(rec)
+	if err == nil {
+		err = q.segment.Sync()
+	}
+	if err != nil {
+		q.rollback()
+		return fmt.Errorf("cannot persist batch: %w", err)
+	}
+	q.tail.offset += int64(len(rec))
+	q.list.PushBack(&diskEntry{batch: batch, end: q.tail})
+	q.bytes += len(batch.Batch)
+	return nil
+}
+
+// rollback removes a partially written record from the end of the current segment
+func (q *diskQueue) rollback() {
+	if err := q.segment.Truncate(q.tail.offset); err != nil {
+		log.Warnf("Retry queue: cannot truncate segment: %s", err.Error())
+	}
+	if _, err := q.segment.Seek(q.tail.offset, io.SeekStart); err != nil {
+		log.Warnf("Retry queue: cannot seek segment: %s", err.Error())
+	}
+}
+
+func (q *diskQueue) Pop() *write.Batch {
+	el := q.list.Front()
+	if el == nil {
+		return nil
+	}
+	q.list.Remove(el)
+	entry := el.Value.(*diskEntry)
+	q.bytes -= len(entry.batch.Batch)
+	head := q.tail
+	if q.list.Len() > 0 {
+		head = entry.end
+	}
+	if err := q.writeHead(head); err != nil {
+		log.Errorf("Retry queue: cannot store head: %s", err.Error())
+	}
+	return entry.batch
+}
+
+// resolve resolves acknowledgements of all batches in the queue with err, batches are kept
+func (q *diskQueue) resolve(err error) {
+	for el := q.list.Front(); el != nil; el = el.Next() {
+		el.Value.(*diskEntry).batch.Resolve(err)
+	}
+}
+
+func (q *diskQueue) First() *write.Batch {
+	el := q.list.Front()
+	if el != nil {
+		return el.Value.(*diskEntry).batch
+	}
+	return nil
+}
+
+func (q *diskQueue) Len() int {
+	return q.list.Len()
+}
+
+func (q *diskQueue) Bytes() int {
+	return q.bytes
+}
+
+// Close closes the segment file opened for writing
+func (q *diskQueue) Close() error {
+	if q.segment == nil {
+		return nil
+	}
+	err := q.segment.Close()
+	q.segment = nil
+	return err
+}
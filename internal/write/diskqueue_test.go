@@ -0,0 +1,193 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, que.Len())
+	assert.Nil(t, que.First())
+	assert.Nil(t, que.Pop())
+	b := &Batch{Batch: "batch", RetryAttempts: 3, Expires: time.Now().Add(time.Minute)}
+	require.NoError(t, que.Push(b))
+	assert.Equal(t, 1, que.Len())
+	assert.Equal(t, 5, que.Bytes())
+	b2 := que.Pop()
+	assert.Equal(t, b, b2)
+	assert.Equal(t, 0, que.Len())
+	assert.Equal(t, 0, que.Bytes())
+
+	require.NoError(t, que.Push(&Batch{Batch: "1"}))
+	require.NoError(t, que.Push(&Batch{Batch: "2"}))
+	assert.Equal(t, write.ErrRetryQueueFull, que.Push(&Batch{Batch: "3"}))
+	assert.Equal(t, 2, que.Len())
+	assert.Equal(t, "1", que.Pop().Batch)
+	assert.Equal(t, "2", que.Pop().Batch)
+	assert.Equal(t, 0, que.Len())
+	assert.Nil(t, que.Pop())
+	require.NoError(t, que.Close())
+}
+
+func TestDiskQueueBytesLimit(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, que.Push(&Batch{Batch: "12345"}))
+	require.NoError(t, que.Push(&Batch{Batch: "6789"}))
+	assert.Equal(t, write.ErrRetryQueueFull, que.Push(&Batch{Batch: "ab"}))
+	assert.Equal(t, 9, que.Bytes())
+	require.NoError(t, que.Close())
+
+	// batches over a smaller limit on reload are kept for eviction by the service
+	que2, err := newDiskQueue(dir, 0, 5)
+	require.NoError(t, err)
+	require.Equal(t, 2, que2.Len())
+	assert.True(t, que2.exceeded())
+	assert.Equal(t, write.ErrRetryQueueFull, que2.Push(&Batch{Batch: "a"}))
+	assert.Equal(t, "12345", que2.Pop().Batch)
+	assert.False(t, que2.exceeded())
+	require.NoError(t, que2.Close())
+}
+
+func TestDiskQueueReload(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	expires := time.Now().Add(time.Minute)
+	for _, s := range []string{"1\n", "2\n", "3\n"} {
+		que.Push(&Batch{Batch: s, RetryAttempts: 1, Expires: expires})
+	}
+	assert.Equal(t, "1\n", que.Pop().Batch)
+	// simulate crash, queue is not closed
+
+	que2, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, que2.Len())
+	b := que2.First()
+	assert.Equal(t, "2\n", b.Batch)
+	assert.EqualValues(t, 1, b.RetryAttempts)
+	assert.Equal(t, expires.UnixNano(), b.Expires.UnixNano())
+	que2.Push(&Batch{Batch: "4\n"})
+	require.NoError(t, que2.Close())
+
+	que3, err := newDiskQueue(dir, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, que3.Len())
+	assert.True(t, que3.exceeded())
+	// retry attempts of the first batch survive restart
+	que3.First().RetryAttempts = 4
+	require.NoError(t, que3.storeAttempts())
+	require.NoError(t, que3.Close())
+
+	que3, err = newDiskQueue(dir, 2, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, 4, que3.First().RetryAttempts)
+	assert.Equal(t, "2\n", que3.Pop().Batch)
+	assert.EqualValues(t, 1, que3.First().RetryAttempts)
+	assert.Equal(t, "3\n", que3.Pop().Batch)
+	assert.Equal(t, "4\n", que3.Pop().Batch)
+	assert.Equal(t, 0, que3.Len())
+	require.NoError(t, que3.Close())
+
+	que4, err := newDiskQueue(dir, 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 0, que4.Len())
+	require.NoError(t, que4.Close())
+}
+
+func TestDiskQueueCorruptedRecord(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	que.Push(&Batch{Batch: "1\n"})
+	que.Push(&Batch{Batch: "2\n"})
+	require.NoError(t, que.Close())
+
+	// simulate torn write of the last record
+	path := que.segmentPath(0)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-1))
+
+	que2, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, que2.Len())
+	assert.Equal(t, "1\n", que2.First().Batch)
+	que2.Push(&Batch{Batch: "3\n"})
+	require.NoError(t, que2.Close())
+
+	que3, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, que3.Len())
+	assert.Equal(t, "1\n", que3.Pop().Batch)
+	assert.Equal(t, "3\n", que3.Pop().Batch)
+	require.NoError(t, que3.Close())
+}
+
+func TestDiskQueueSegments(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	// force new segment for each batch
+	que.tail.offset = maxSegmentSize
+	que.Push(&Batch{Batch: "1\n"})
+	que.tail.offset = maxSegmentSize
+	que.Push(&Batch{Batch: "2\n"})
+	segs, err := que.segments()
+	require.NoError(t, err)
+	assert.Len(t, segs, 3)
+
+	que.Pop()
+	que.Pop()
+	segs, err = que.segments()
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2}, segs)
+	_, err = os.Stat(filepath.Join(dir, headFileName))
+	assert.NoError(t, err)
+	require.NoError(t, que.Close())
+}
+
+func TestDiskQueuePushError(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	require.NoError(t, que.Push(&Batch{Batch: "1\n"}))
+	tail := que.tail
+	// make writes fail
+	require.NoError(t, que.segment.Close())
+	assert.Error(t, que.Push(&Batch{Batch: "2\n"}))
+	assert.Equal(t, 1, que.Len())
+	assert.Equal(t, 2, que.Bytes())
+	assert.Equal(t, tail, que.tail)
+}
+
+func TestDiskQueueLargeRecord(t *testing.T) {
+	dir := t.TempDir()
+	que, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	large := string(make([]byte, maxSegmentSize+1))
+	require.NoError(t, que.Push(&Batch{Batch: large}))
+	require.NoError(t, que.Push(&Batch{Batch: "2\n"}))
+	require.NoError(t, que.Close())
+
+	que2, err := newDiskQueue(dir, 10, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, que2.Len())
+	assert.Equal(t, large, que2.Pop().Batch)
+	assert.Equal(t, "2\n", que2.Pop().Batch)
+	require.NoError(t, que2.Close())
+}
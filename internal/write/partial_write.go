@@ -0,0 +1,81 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+)
+
+// Messages of errors caused by written data
+const (
+	errStringPartialWrite  = "partial write"
+	errStringUnableToParse = "unable to parse"
+)
+
+var (
+	// InfluxDB 1.x and 2.x: "... dropped=2"
+	droppedRegexp = regexp.MustCompile(`dropped=(\d+)`)
+	// InfluxDB 2.x: "partial write error (5 accepted): 2 out of 7 points rejected"
+	rejectedRegexp = regexp.MustCompile(`(\d+) out of \d+ points rejected`)
+	// InfluxDB 2.x: "errors encountered on line(s):\nline 2: missing field value"
+	lineErrorRegexp = regexp.MustCompile(`(?m)^\s*line (\d+): (.+)$`)
+	// InfluxDB 1.x and 2.x: "unable to parse 'cpu value': invalid field format"
+	unableToParseRegexp = regexp.MustCompile(`(?m)unable to parse '(.*)': (.+)$`)
+)
+
+// newPartialWriteError returns details of a partial write parsed from perror, or nil if perror is not a partial write error.
+// batch is the written data, used to find rejected lines.
+func newPartialWriteError(batch string, perror *http2.Error) *write.PartialWriteError {
+	msg := perror.Message
+	if !strings.Contains(msg, errStringPartialWrite) && !strings.Contains(msg, errStringUnableToParse) && !lineErrorRegexp.MatchString(msg) {
+		return nil
+	}
+	pe := &write.PartialWriteError{
+		StatusCode: perror.StatusCode,
+		Code:       perror.Code,
+		Message:    msg,
+	}
+	lines := strings.Split(batch, "\n")
+	for _, m := range lineErrorRegexp.FindAllStringSubmatch(msg, -1) {
+		n, _ := strconv.Atoi(m[1])
+		r := write.RejectedLine{Number: n, Reason: strings.TrimSpace(m[2])}
+		if n > 0 && n <= len(lines) {
+			r.Line = lines[n-1]
+		}
+		pe.Rejected = append(pe.Rejected, r)
+	}
+	if len(pe.Rejected) == 0 {
+		for _, m := range unableToParseRegexp.FindAllStringSubmatch(msg, -1) {
+			r := write.RejectedLine{Line: m[1], Reason: strings.TrimSpace(m[2])}
+			for i, l := range lines {
+				if l == m[1] {
+					r.Number = i + 1
+					break
+				}
+			}
+			pe.Rejected = append(pe.Rejected, r)
+		}
+	}
+	if m := droppedRegexp.FindStringSubmatch(msg); m != nil {
+		pe.Dropped, _ = strconv.Atoi(m[1])
+	} else if m := rejectedRegexp.FindStringSubmatch(msg); m != nil {
+		pe.Dropped, _ = strconv.Atoi(m[1])
+	}
+	if len(pe.Rejected) == 0 {
+		// the server reported only the reason, e.g. field type conflict
+		reason := msg
+		if i := strings.LastIndex(reason, errStringPartialWrite+": "); i >= 0 {
+			reason = reason[i+len(errStringPartialWrite)+2:]
+		}
+		reason = strings.TrimSpace(droppedRegexp.ReplaceAllString(reason, ""))
+		pe.Rejected = append(pe.Rejected, write.RejectedLine{Reason: reason})
+	}
+	return pe
+}
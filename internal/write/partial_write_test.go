@@ -0,0 +1,76 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package write
+
+import (
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPartialWriteError(t *testing.T) {
+	batch := "cpu,host=a value=1i\ncpu,host=b value=\ncpu,host=c value=1.5\nmem free\n"
+	testCases := []struct {
+		name     string
+		message  string
+		dropped  int
+		rejected []write.RejectedLine
+	}{
+		{
+			name:    "v1 field type conflict",
+			message: `partial write: field type conflict: input field "value" on measurement "cpu" is type float, already exists as type integer dropped=1`,
+			dropped: 1,
+			rejected: []write.RejectedLine{
+				{Reason: `field type conflict: input field "value" on measurement "cpu" is type float, already exists as type integer`},
+			},
+		},
+		{
+			name:    "v2 field type conflict",
+			message: `failure writing points to database: partial write: field type conflict: input field "value" on measurement "cpu" is type float, already exists as type integer dropped=1`,
+			dropped: 1,
+			rejected: []write.RejectedLine{
+				{Reason: `field type conflict: input field "value" on measurement "cpu" is type float, already exists as type integer`},
+			},
+		},
+		{
+			name:    "v1 unable to parse",
+			message: "unable to parse 'cpu,host=b value=': missing field value\nunable to parse 'mem free': invalid field format",
+			rejected: []write.RejectedLine{
+				{Number: 2, Line: "cpu,host=b value=", Reason: "missing field value"},
+				{Number: 4, Line: "mem free", Reason: "invalid field format"},
+			},
+		},
+		{
+			name:    "v2 errors on lines",
+			message: "failed to parse line protocol:\nerrors encountered on line(s):\nline 2: missing field value\nline 4: invalid field format",
+			rejected: []write.RejectedLine{
+				{Number: 2, Line: "cpu,host=b value=", Reason: "missing field value"},
+				{Number: 4, Line: "mem free", Reason: "invalid field format"},
+			},
+		},
+		{
+			name:    "v2 partial write",
+			message: "partial write error (2 accepted): 2 out of 4 points rejected (check rejected_points in your _monitoring bucket for further information)",
+			dropped: 2,
+			rejected: []write.RejectedLine{
+				{Reason: "partial write error (2 accepted): 2 out of 4 points rejected (check rejected_points in your _monitoring bucket for further information)"},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			pe := newPartialWriteError(batch, &http.Error{StatusCode: 400, Code: "invalid", Message: tc.message})
+			require.NotNil(t, pe)
+			assert.Equal(t, 400, pe.StatusCode)
+			assert.Equal(t, "invalid: "+tc.message, pe.Error())
+			assert.Equal(t, tc.dropped, pe.Dropped)
+			assert.Equal(t, tc.rejected, pe.Rejected)
+		})
+	}
+	assert.Nil(t, newPartialWriteError(batch, &http.Error{StatusCode: 500, Code: "internal error", Message: "gateway error"}))
+}
@@ -8,71 +8,80 @@ package write
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	http2 "github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
 	"github.com/influxdata/influxdb-client-go/v2/internal/gzip"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/internal/http"
 	"github.com/influxdata/influxdb-client-go/v2/internal/log"
 	ilog "github.com/influxdata/influxdb-client-go/v2/log"
 	lp "github.com/influxdata/line-protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Batch holds information for sending points batch
-type Batch struct {
-	// lines to send
-	Batch string
-	// retry attempts so far
-	RetryAttempts uint
-	// true if it was removed from queue
-	Evicted bool
-	// time when this batch expires
-	Expires time.Time
-}
+type Batch = write.Batch
 
 // NewBatch creates new batch
 func NewBatch(data string, expireDelayMs uint) *Batch {
-	return &Batch{
-		Batch:   data,
-		Expires: time.Now().Add(time.Duration(expireDelayMs) * time.Millisecond),
-	}
+	return write.NewBatch(data, expireDelayMs)
 }
 
 // BatchErrorCallback is synchronously notified in case non-blocking write fails.
 // It returns  true if WriteAPI should continue with retrying, false will discard the batch.
+// In case of a partial write, the callback is notified, but the batch is never retried.
 type BatchErrorCallback func(batch *Batch, error2 http2.Error) bool
 
 // Service is responsible for reliable writing of batches
 type Service struct {
-	org                  string
-	bucket               string
-	httpService          http2.Service
-	url                  string
-	lastWriteAttempt     time.Time
-	retryQueue           *queue
-	lock                 sync.Mutex
-	writeOptions         *write.Options
-	retryExponentialBase uint
-	errorCb              BatchErrorCallback
-	retryDelay           uint
-	retryAttempts        uint
+	org              string
+	bucket           string
+	httpService      http2.Service
+	url              string
+	username         string
+	password         string
+	lastWriteAttempt time.Time
+	retryQueue       write.RetryQueue
+	persistentQueue  bool
+	// parts of split batches, which are written before batches in retryQueue
+	splitBatches []*Batch
+	// batch in the persistent retry queue, whose parts are in splitBatches, it is removed when all parts are handled
+	splitParent *Batch
+	// queueLock serializes HandleWrite, Flush and Close, which use the retry queue
+	queueLock     sync.Mutex
+	lock          sync.Mutex
+	writeOptions  *write.Options
+	retryPolicy   write.RetryPolicy
+	errorCb       BatchErrorCallback
+	observer      write.Observer
+	deadLetters   write.DeadLetterSink
+	rateLimiter   *write.RateLimiter
+	tracer        trace.Tracer
+	retryDelay    uint
+	retryAttempts uint
+	// number of write requests in progress
+	inFlight int32
+	// number of batches waiting for retry, updated after writes
+	queueDepth int32
 }
 
 // NewService creates new write service
 func NewService(org string, bucket string, httpService http2.Service, options *write.Options) *Service {
 
-	retryBufferLimit := options.RetryBufferLimit() / options.BatchSize()
-	if retryBufferLimit == 0 {
-		retryBufferLimit = 1
-	}
 	u, _ := url.Parse(httpService.ServerAPIURL())
 	u, _ = u.Parse("write")
 	params := u.Query()
@@ -83,18 +92,268 @@ func NewService(org string, bucket string, httpService http2.Service, options *w
 		params.Set("consistency", string(options.Consistency()))
 	}
 	u.RawQuery = params.Encode()
-	writeURL := u.String()
+	return newService(org, bucket, httpService, u.String(), options)
+}
+
+// NewServiceV1 creates new write service writing to database db and retention policy rp of InfluxDB 1.x
+// using the /write endpoint. Empty rp means the default retention policy.
+// If username is not empty, requests are authenticated using basic authentication instead of the authorization of httpService.
+func NewServiceV1(db, rp, username, password string, httpService http2.Service, options *write.Options) *Service {
+	u, _ := url.Parse(httpService.ServerURL())
+	u, _ = u.Parse("write")
+	params := u.Query()
+	params.Set("db", db)
+	if rp != "" {
+		params.Set("rp", rp)
+	}
+	params.Set("precision", precisionToStringV1(options.Precision()))
+	if options.Consistency() != "" {
+		params.Set("consistency", string(options.Consistency()))
+	}
+	u.RawQuery = params.Encode()
+	bucket := db
+	if rp != "" {
+		bucket = db + "/" + rp
+	}
+	w := newService("", bucket, httpService, u.String(), options)
+	w.username = username
+	w.password = password
+	return w
+}
+
+func newService(org string, bucket string, httpService http2.Service, writeURL string, options *write.Options) *Service {
+	maxBatches, maxBytes := retryBufferLimits(options)
 	return &Service{
-		org:                  org,
-		bucket:               bucket,
-		httpService:          httpService,
-		url:                  writeURL,
-		writeOptions:         options,
-		retryQueue:           newQueue(int(retryBufferLimit)),
-		retryExponentialBase: 2,
-		retryDelay:           options.RetryInterval(),
-		retryAttempts:        0,
+		org:           org,
+		bucket:        bucket,
+		httpService:   httpService,
+		url:           writeURL,
+		writeOptions:  options,
+		retryQueue:    write.NewRetryQueue(maxBatches, maxBytes),
+		retryDelay:    options.RetryInterval(),
+		retryAttempts: 0,
+		observer:      options.Observer(),
+		deadLetters:   options.DeadLetterSink(),
+		rateLimiter:   options.RateLimiter(),
+		tracer:        ihttp.Tracer(options.TracerProvider()),
+	}
+}
+
+// retryBufferLimits returns maximum number of batches and maximum bytes in the retry queue
+func retryBufferLimits(options *write.Options) (int, int) {
+	if options.RetryBufferLimitBytes() > 0 {
+		return 0, int(options.RetryBufferLimitBytes())
+	}
+	limit := options.RetryBufferLimit() / options.BatchSize()
+	if limit == 0 {
+		limit = 1
+	}
+	return int(limit), 0
+}
+
+// SetRetryQueue replaces default in-memory retry queue.
+// It must be called before any write.
+func (w *Service) SetRetryQueue(queue write.RetryQueue) {
+	w.retryQueue = queue
+	w.persistentQueue = false
+}
+
+// UsePersistentRetryQueue replaces in-memory retry queue with the queue persisted in a subdirectory of dir
+// unique for org and bucket. Batches stored there by a previous instance are loaded and will be retried.
+// The oldest loaded batches exceeding the retry buffer limit are evicted the same way as when the retry queue is full.
+// It must be called before any write.
+func (w *Service) UsePersistentRetryQueue(dir string) error {
+	maxBatches, maxBytes := retryBufferLimits(w.writeOptions)
+	q, err := newDiskQueue(w.queueDir(dir), maxBatches, maxBytes)
+	if err != nil {
+		return err
+	}
+	w.retryQueue = q
+	w.persistentQueue = true
+	for q.exceeded() {
+		log.Error("Retry queue: Retry buffer full, discarding oldest batch")
+		w.evictOldest(write.ErrRetryQueueFull)
+	}
+	w.updateQueueDepth()
+	return nil
+}
+
+// MergePersistentRetryQueue moves batches persisted in dir by another service for the same org and bucket
+// to the persistent retry queue, which must be already set by UsePersistentRetryQueue.
+// Batches, which don't fit into the retry queue, are left in dir.
+// It must be called before any write.
+func (w *Service) MergePersistentRetryQueue(dir string) error {
+	if !w.persistentQueue {
+		return errors.New("retry queue is not persistent")
+	}
+	path := w.queueDir(dir)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	q, err := newDiskQueue(path, 0, 0)
+	if err != nil {
+		return err
+	}
+	defer q.Close()
+	n := 0
+	for ; q.Len() > 0; n++ {
+		// a batch is removed only after it is stored, so a crash meanwhile can duplicate it, but not lose it
+		if err := w.retryQueue.Push(q.First()); err != nil {
+			return fmt.Errorf("%d of %d batches merged: %w", n, n+q.Len(), err)
+		}
+		q.Pop()
+	}
+	if n > 0 {
+		log.Infof("Retry queue: merged %d batches from %s", n, path)
+	}
+	w.updateQueueDepth()
+	return nil
+}
+
+// queueDir returns subdirectory of dir for the persistent retry queue of org and bucket
+func (w *Service) queueDir(dir string) string {
+	return filepath.Join(dir, url.PathEscape(w.org)+"_"+url.PathEscape(w.bucket))
+}
+
+// SetRetryPolicy replaces the retry policy set in write.Options
+func (w *Service) SetRetryPolicy(policy write.RetryPolicy) {
+	w.retryPolicy = policy
+}
+
+// policy returns the retry policy in use
+func (w *Service) policy() write.RetryPolicy {
+	if w.retryPolicy != nil {
+		return w.retryPolicy
+	}
+	return w.writeOptions.RetryPolicy()
+}
+
+// AddObserver adds observer notified about the lifecycle of batches, in addition to the observer set in write.Options.
+// It must be called before any write.
+func (w *Service) AddObserver(observer write.Observer) {
+	if w.observer == nil {
+		w.observer = observer
+	} else {
+		w.observer = write.NewMultiObserver(w.observer, observer)
+	}
+}
+
+// notify calls f with the observer, if it is set
+func (w *Service) notify(f func(o write.Observer)) {
+	if w.observer != nil {
+		f(w.observer)
+	}
+}
+
+// RetryQueueLen returns number of batches waiting in the retry queue
+func (w *Service) RetryQueueLen() int {
+	return w.queueLen()
+}
+
+// PersistedBatches returns number of batches in the persistent retry queue, which survive closing of the service.
+// It returns 0 if the retry queue is not persistent.
+func (w *Service) PersistedBatches() int {
+	if !w.persistentQueue {
+		return 0
+	}
+	return w.retryQueue.Len()
+}
+
+// RetryQueueDepth returns number of batches waiting for retry after the last write.
+// Unlike RetryQueueLen, it can be called concurrently with writes.
+func (w *Service) RetryQueueDepth() int {
+	return int(atomic.LoadInt32(&w.queueDepth))
+}
+
+// updateQueueDepth stores the current number of batches waiting for retry
+func (w *Service) updateQueueDepth() {
+	atomic.StoreInt32(&w.queueDepth, int32(w.queueLen()))
+}
+
+// queueLen returns number of batches waiting for retry, including parts of split batches
+func (w *Service) queueLen() int {
+	n := len(w.splitBatches) + w.retryQueue.Len()
+	if w.splitParent != nil {
+		n--
+	}
+	return n
+}
+
+// queueFirst returns the oldest batch waiting for retry, parts of split batches go first
+func (w *Service) queueFirst() *Batch {
+	if len(w.splitBatches) > 0 {
+		return w.splitBatches[0]
+	}
+	return w.retryQueue.First()
+}
+
+// queuePop removes the oldest batch waiting for retry
+func (w *Service) queuePop() *Batch {
+	if len(w.splitBatches) > 0 {
+		b := w.splitBatches[0]
+		w.splitBatches[0] = nil
+		w.splitBatches = w.splitBatches[1:]
+		if len(w.splitBatches) == 0 && w.splitParent != nil {
+			// all parts are handled, acknowledgements of the split batch are resolved by its parts
+			w.retryQueue.Pop()
+			w.splitParent = nil
+		}
+		return b
+	}
+	return w.retryQueue.Pop()
+}
+
+// clearSplit discards parts of split batches without resolving their acknowledgements
+func (w *Service) clearSplit() {
+	for _, b := range w.splitBatches {
+		b.Evicted = true
+	}
+	w.splitBatches = nil
+	w.splitParent = nil
+}
+
+// InFlightRequests returns number of write requests in progress
+func (w *Service) InFlightRequests() int {
+	return int(atomic.LoadInt32(&w.inFlight))
+}
+
+// Close releases resources held by the retry queue.
+// Acknowledgements of batches remaining in the retry queue are resolved with write.ErrWriteAPIClosed.
+// Batches in the persistent retry queue, including parts of split batches, are kept to be written by the next instance.
+func (w *Service) Close() error {
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	defer w.updateQueueDepth()
+	if w.persistentQueue {
+		if w.splitParent != nil {
+			// the split batch remains persisted instead of its parts
+			for _, b := range w.splitBatches {
+				b.Resolve(write.ErrWriteAPIClosed)
+			}
+			w.clearSplit()
+		}
+		// parts of a split new batch are persisted
+		for len(w.splitBatches) > 0 {
+			b := w.queuePop()
+			if err := w.retryQueue.Push(b); err != nil {
+				log.Errorf("Cannot store part of split batch to retry queue, discarding: %s", err.Error())
+				w.drop(b, err)
+			}
+		}
+	}
+	for len(w.splitBatches) > 0 {
+		w.dropFirst(write.ErrWriteAPIClosed)
+	}
+	if q, ok := w.retryQueue.(*diskQueue); ok {
+		q.resolve(write.ErrWriteAPIClosed)
 	}
+	if c, ok := w.retryQueue.(io.Closer); ok {
+		return c.Close()
+	}
+	for w.retryQueue.Len() > 0 {
+		w.dropFirst(write.ErrWriteAPIClosed)
+	}
+	return nil
 }
 
 // SetBatchErrorCallback sets callback allowing custom handling of failed writes.
@@ -103,37 +362,210 @@ func (w *Service) SetBatchErrorCallback(cb BatchErrorCallback) {
 	w.errorCb = cb
 }
 
+// popRetryQueue removes the oldest batch from retry queue, marks it as evicted and resolves its acknowledgements with err
+func (w *Service) popRetryQueue(err error) *Batch {
+	b := w.queuePop()
+	if b != nil {
+		b.Evicted = true
+		b.Resolve(err)
+	}
+	return b
+}
+
+// dropFirst discards the oldest batch waiting for retry because of err
+func (w *Service) dropFirst(err error) {
+	if b := w.popRetryQueue(err); b != nil {
+		w.notify(func(o write.Observer) { o.BatchDropped(b, err) })
+		w.deadLetter(b, deadLetterReason(err), err)
+	}
+}
+
+// expireFirst discards the oldest batch waiting for retry, whose maximum retry time elapsed
+func (w *Service) expireFirst() {
+	if b := w.popRetryQueue(write.ErrBatchExpired); b != nil {
+		w.notify(func(o write.Observer) { o.BatchExpired(b) })
+		w.deadLetter(b, write.DeadLetterExpired, nil)
+	}
+}
+
+// drop resolves acknowledgements of batch, which is not stored, with err
+func (w *Service) drop(batch *Batch, err error) {
+	batch.Resolve(err)
+	w.notify(func(o write.Observer) { o.BatchDropped(batch, err) })
+	w.deadLetter(batch, deadLetterReason(err), err)
+}
+
+// deadLetter passes discarded batch to the dead letter sink, if it is set.
+// err is used if the batch has not been written yet.
+func (w *Service) deadLetter(batch *Batch, reason write.DeadLetterReason, err error) {
+	if w.deadLetters == nil {
+		return
+	}
+	letter := &write.DeadLetter{
+		Batch:         batch.Batch,
+		Reason:        reason,
+		Err:           err,
+		RetryAttempts: batch.RetryAttempts,
+		Time:          time.Now(),
+	}
+	if batch.LastError != nil {
+		letter.Err = batch.LastError
+	}
+	if err := w.deadLetters.WriteDeadLetter(letter); err != nil {
+		log.Errorf("Cannot write dead letter: %s", err.Error())
+	}
+}
+
+// deadLetterReason classifies err, because of which a batch is discarded
+func deadLetterReason(err error) write.DeadLetterReason {
+	var perror *http2.Error
+	switch {
+	case errors.Is(err, write.ErrWriteAPIClosed), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return write.DeadLetterClosed
+	case errors.Is(err, write.ErrRetryQueueFull), errors.Is(err, write.ErrBatchTooLarge):
+		return write.DeadLetterOverflow
+	case errors.As(err, &perror):
+		if write.IsRetryableError(perror) {
+			return write.DeadLetterRetriesExhausted
+		}
+		return write.DeadLetterNotRetryable
+	default:
+		return write.DeadLetterError
+	}
+}
+
+// storeBatch stores batch to retry queue. If the queue is full, the batch or the oldest batches are discarded, according to the overflow policy.
+// In case of the OverflowBlock policy, it returns false without storing the batch, if the queue is full.
+func (w *Service) storeBatch(batch *Batch) bool {
+	for {
+		err := w.retryQueue.Push(batch)
+		if err == nil {
+			return true
+		}
+		if err != write.ErrRetryQueueFull {
+			log.Errorf("Write proc: cannot store batch to retry queue, discarding: %s", err.Error())
+			w.drop(batch, err)
+			return true
+		}
+		if w.retryQueue.Len() == 0 {
+			log.Error("Write proc: batch exceeds retry buffer limit, discarding")
+			w.drop(batch, write.ErrBatchTooLarge)
+			return true
+		}
+		switch w.writeOptions.OverflowPolicy() {
+		case write.OverflowBlock:
+			return false
+		case write.OverflowDropNewest:
+			log.Error("Write proc: Retry buffer full, discarding newest batch")
+			w.drop(batch, err)
+			return true
+		default:
+			log.Error("Write proc: Retry buffer full, discarding oldest batch")
+			w.evictOldest(err)
+		}
+	}
+}
+
+// evictOldest discards the oldest batch in the retry queue to make space for newer batches
+func (w *Service) evictOldest(err error) {
+	if b := w.retryQueue.Pop(); b != nil {
+		if b == w.splitParent {
+			// parts of the split batch are discarded with it
+			w.clearSplit()
+		}
+		b.Evicted = true
+		b.Resolve(err)
+		w.notify(func(o write.Observer) { o.BatchEvicted(b) })
+		w.deadLetter(b, write.DeadLetterEvicted, nil)
+	}
+}
+
+// storeRetryAttempts persists retry attempts of batch, if it is the oldest batch in the persistent retry queue,
+// so that they are not reset by restart
+func (w *Service) storeRetryAttempts(batch *Batch) {
+	if q, ok := w.retryQueue.(*diskQueue); ok && q.First() == batch {
+		if err := q.storeAttempts(); err != nil {
+			log.Errorf("Retry queue: cannot store retry attempts: %s", err.Error())
+		}
+	}
+}
+
+// waitForRetry waits until retry delay since the last write attempt passes
+func (w *Service) waitForRetry(ctx context.Context) error {
+	w.lock.Lock()
+	next := w.lastWriteAttempt.Add(time.Millisecond * time.Duration(w.retryDelay))
+	w.lock.Unlock()
+	log.Debugf("Write proc: retry buffer full, waiting %s", time.Until(next))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(time.Until(next)):
+		return nil
+	}
+}
+
 // HandleWrite handles writes of batches and handles retrying.
 // Retrying is triggered by new writes, there is no scheduler.
 // It first checks retry queue, because it has the highest priority.
 // If there are some batches in retry queue, those are written and incoming batch is added to end of retry queue.
+// If the retry queue is full, the overflow policy decides whether the incoming batch or the oldest batch is discarded,
+// or whether HandleWrite blocks until there is space in the retry queue.
 // Immediate write is allowed only in case there was success or not retryable error.
 // Otherwise, delay is checked based on recent batch.
-// If write of batch fails with retryable error (connection errors and HTTP code >= 429),
-// Batch retry time is calculated based on #of attempts.
-// If writes continues failing and # of attempts reaches maximum or total retry time reaches maxRetryTime,
-// batch is discarded.
+// What happens with a failed batch is decided by the retry policy (write.DefaultRetryPolicy by default).
+// Batch can be kept for retrying, discarded, or split into halves, which are written before other batches waiting for retry.
+// The delay before the next write is also computed by the retry policy, based on the number of consecutive failed writes.
+// Batch can be nil, in such case only batches from retry queue are written.
+// The error of the last discarded or retried batch is returned.
 func (w *Service) HandleWrite(ctx context.Context, batch *Batch) error {
 	log.Debug("Write proc: received write request")
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	defer w.updateQueueDepth()
 	batchToWrite := batch
 	retrying := false
+	// error of the last discarded batch
+	var dropErr error
+	// error of the last batch kept for retrying, cleared by a successful write
+	var retryErr error
+	// batch waiting for space in the full retry queue
+	var pending *Batch
+	// abandon resolves acknowledgements of batches, which are not stored, when returning because of ctx
+	abandon := func(err error) error {
+		if batch != nil {
+			w.drop(batch, err)
+		}
+		if pending != nil {
+			w.drop(pending, err)
+		}
+		return err
+	}
+	if batch != nil {
+		w.notify(func(o write.Observer) { o.BatchCreated(batch) })
+		if w.rateLimiter != nil {
+			// hold new batches while writes are paused after throttling, which blocks writing to the buffer
+			if err := w.rateLimiter.WaitResumed(ctx); err != nil {
+				return abandon(err)
+			}
+		}
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			log.Debug("Write proc: ctx cancelled req")
-			return ctx.Err()
+			return abandon(ctx.Err())
 		default:
 		}
-		if !w.retryQueue.isEmpty() {
+		if w.queueLen() > 0 {
 			log.Debug("Write proc: taking batch from retry queue")
 			if !retrying {
-				b := w.retryQueue.first()
+				b := w.queueFirst()
 
 				// Discard batches at beginning of retryQueue that have already expired
 				if time.Now().After(b.Expires) {
 					log.Error("Write proc: oldest batch in retry queue expired, discarding")
 					if !b.Evicted {
-						w.retryQueue.pop()
+						w.expireFirst()
 					}
 
 					continue
@@ -143,143 +575,199 @@ func (w *Service) HandleWrite(ctx context.Context, batch *Batch) error {
 				if w.lastWriteAttempt.IsZero() || time.Now().After(w.lastWriteAttempt.Add(time.Millisecond*time.Duration(w.retryDelay))) {
 					retrying = true
 				} else {
-					log.Warn("Write proc: cannot write yet, storing batch to queue")
-					if w.retryQueue.push(batch) {
-						log.Error("Write proc: Retry buffer full, discarding oldest batch")
+					if batch != nil {
+						log.Warn("Write proc: cannot write yet, storing batch to queue")
+						if !w.storeBatch(batch) {
+							if err := w.waitForRetry(ctx); err != nil {
+								return abandon(err)
+							}
+							continue
+						}
+						batch = nil
 					}
 					batchToWrite = nil
 				}
 			}
 			if retrying {
-				batchToWrite = w.retryQueue.first()
+				batchToWrite = w.queueFirst()
 				if batch != nil { //store actual batch to retry queue
-					if w.retryQueue.push(batch) {
-						log.Error("Write proc: Retry buffer full, discarding oldest batch")
+					if !w.storeBatch(batch) {
+						pending = batch
 					}
 					batch = nil
+				} else if pending != nil && w.storeBatch(pending) {
+					pending = nil
 				}
 			}
 		}
+		if batchToWrite == nil {
+			break
+		}
 		// write batch
-		if batchToWrite != nil {
-			perror := w.WriteBatch(ctx, batchToWrite)
+		perror := w.WriteBatch(ctx, batchToWrite)
+		action := write.RetryActionAccept
+		if perror != nil {
+			action = w.policy().Decide(perror, batchToWrite.RetryAttempts)
+			if action != write.RetryActionAccept {
+				if w.errorCb != nil && !w.errorCb(batchToWrite, *perror) && action == write.RetryActionRetry {
+					log.Error("Callback rejected batch, discarding")
+					action = write.RetryActionDrop
+				}
+			}
+		}
+		// whether the batch is the first one waiting for retry
+		queued := !batchToWrite.Evicted && batchToWrite == w.queueFirst()
+		switch action {
+		case write.RetryActionAccept:
 			if perror != nil {
-				if isIgnorableError(perror) {
-					log.Warnf("Write error: %s", perror.Error())
-				} else {
-					if w.writeOptions.MaxRetries() != 0 && (perror.StatusCode == 0 || perror.StatusCode >= http.StatusTooManyRequests) {
-						log.Errorf("Write error: %s, batch kept for retrying\n", perror.Error())
-						if perror.RetryAfter > 0 {
-							w.retryDelay = perror.RetryAfter * 1000
-						} else {
-							w.retryDelay = w.computeRetryDelay(w.retryAttempts)
-						}
-						if w.errorCb != nil && !w.errorCb(batchToWrite, *perror) {
-							log.Error("Callback rejected batch, discarding")
-							if !batchToWrite.Evicted {
-								w.retryQueue.pop()
-							}
-							return perror
-						}
-						// store new batch (not taken from queue)
-						if !batchToWrite.Evicted && batchToWrite != w.retryQueue.first() {
-							if w.retryQueue.push(batch) {
-								log.Error("Retry buffer full, discarding oldest batch")
-							}
-						} else if batchToWrite.RetryAttempts == w.writeOptions.MaxRetries() {
-							log.Error("Reached maximum number of retries, discarding batch")
-							if !batchToWrite.Evicted {
-								w.retryQueue.pop()
-							}
-						}
-						batchToWrite.RetryAttempts++
-						w.retryAttempts++
-						log.Debugf("Write proc: next wait for write is %dms\n", w.retryDelay)
-					} else {
-						log.Errorf("Write error: %s\n", perror.Error())
+				log.Warnf("Write error: %s", perror.Error())
+			}
+			w.retryDelay = w.writeOptions.RetryInterval()
+			w.retryAttempts = 0
+			retryErr = nil
+			if queued {
+				w.popRetryQueue(nil)
+			}
+			batchToWrite.Resolve(nil)
+			b := batchToWrite
+			w.notify(func(o write.Observer) { o.BatchSucceeded(b) })
+			batchToWrite = nil
+			if pending != nil && w.queueLen() == 0 {
+				// retry queue was drained, pending batch can be written directly
+				batchToWrite = pending
+				pending = nil
+				retrying = false
+			}
+			continue
+		case write.RetryActionSplit:
+			if halves := batchToWrite.Split(); halves != nil {
+				log.Warnf("Write error: %s, splitting batch", perror.Error())
+				if queued {
+					switch {
+					case len(w.splitBatches) > 0:
+						// part of a split batch is replaced by its halves
+						w.splitBatches[0] = nil
+						w.splitBatches = w.splitBatches[1:]
+						batchToWrite.Evicted = true
+					case w.persistentQueue:
+						// batch remains persisted until its halves are written or discarded
+						w.splitParent = batchToWrite
+					default:
+						w.queuePop()
+						batchToWrite.Evicted = true
 					}
-					return fmt.Errorf("write failed (attempts %d): %w", batchToWrite.RetryAttempts, perror)
 				}
+				w.splitBatches = append(halves, w.splitBatches...)
+				if batch == batchToWrite {
+					batch = nil
+				}
+				// halves are written immediately
+				batchToWrite = nil
+				retrying = true
+				continue
 			}
-
+			log.Errorf("Write error: %s, batch cannot be split, discarding", perror.Error())
+			action = write.RetryActionDrop
+		}
+		delay := w.policy().RetryDelay(perror, w.retryAttempts)
+		if delay > 0 {
+			w.retryDelay = delay
+			w.retryAttempts++
+			log.Debugf("Write proc: next wait for write is %dms\n", w.retryDelay)
+		} else {
+			// server is able to process writes
 			w.retryDelay = w.writeOptions.RetryInterval()
 			w.retryAttempts = 0
-			if retrying && !batchToWrite.Evicted {
-				w.retryQueue.pop()
+		}
+		if action == write.RetryActionDrop {
+			log.Errorf("Write error: %s, discarding batch\n", perror.Error())
+			if delay > 0 {
+				batchToWrite.RetryAttempts++
+			}
+			dropErr = fmt.Errorf("write failed (attempts %d): %w", batchToWrite.RetryAttempts, perror)
+			if queued {
+				w.popRetryQueue(perror)
+			}
+			w.drop(batchToWrite, perror)
+			if batch == batchToWrite {
+				batch = nil
 			}
 			batchToWrite = nil
+			if pending != nil && w.storeBatch(pending) {
+				// there is space in the retry queue now
+				pending = nil
+			}
+			if delay == 0 && w.queueLen() > 0 {
+				// continue with the next batch
+				continue
+			}
 		} else {
-			break
+			log.Errorf("Write error: %s, batch kept for retrying\n", perror.Error())
+			if !queued && !batchToWrite.Evicted {
+				// store new batch (not taken from queue)
+				if !w.storeBatch(batchToWrite) {
+					pending = batchToWrite
+				}
+				if batch == batchToWrite {
+					batch = nil
+				}
+			}
+			batchToWrite.RetryAttempts++
+			w.storeRetryAttempts(batchToWrite)
+			retryErr = fmt.Errorf("write failed (attempts %d): %w", batchToWrite.RetryAttempts, perror)
+			b := batchToWrite
+			w.notify(func(o write.Observer) { o.BatchRetried(b, perror) })
 		}
+		if pending != nil {
+			// keep retrying until there is space for the pending batch
+			if err := w.waitForRetry(ctx); err != nil {
+				return abandon(err)
+			}
+			retrying = false
+			batchToWrite = nil
+			continue
+		}
+		break
 	}
-	return nil
-}
-
-// Non-retryable errors
-const (
-	errStringHintedHandoffNotEmpty = "hinted handoff queue not empty"
-	errStringPartialWrite          = "partial write"
-	errStringPointsBeyondRP        = "points beyond retention policy"
-	errStringUnableToParse         = "unable to parse"
-)
-
-func isIgnorableError(error *http2.Error) bool {
-	// This "error" is an informational message about the state of the
-	// InfluxDB cluster.
-	if strings.Contains(error.Message, errStringHintedHandoffNotEmpty) {
-		return true
-	}
-	// Points beyond retention policy is returned when points are immediately
-	// discarded for being older than the retention policy.  Usually this not
-	// a cause for concern, and we don't want to retry.
-	if strings.Contains(error.Message, errStringPointsBeyondRP) {
-		return true
-	}
-	// Other partial write errors, such as "field type conflict", are not
-	// correctable at this point and so the point is dropped instead of
-	// retrying.
-	if strings.Contains(error.Message, errStringPartialWrite) {
-		return true
-	}
-	// This error indicates an error in line protocol
-	// serialization, retries would not be successful.
-	if strings.Contains(error.Message, errStringUnableToParse) {
-		return true
+	if retryErr != nil {
+		return retryErr
 	}
-	return false
+	return dropErr
 }
 
-// computeRetryDelay calculates retry delay.
-// Retry delay is calculated as random value within the interval
-// [retry_interval * exponential_base^(attempts) and retry_interval * exponential_base^(attempts+1)]
-func (w *Service) computeRetryDelay(attempts uint) uint {
-	minDelay := int(w.writeOptions.RetryInterval() * pow(w.writeOptions.ExponentialBase(), attempts))
-	maxDelay := int(w.writeOptions.RetryInterval() * pow(w.writeOptions.ExponentialBase(), attempts+1))
-	diff := maxDelay - minDelay
-	if diff <= 0 { //check overflows
-		return w.writeOptions.MaxRetryInterval()
-	}
-	retryDelay := uint(rand.Intn(diff) + minDelay)
-	if retryDelay > w.writeOptions.MaxRetryInterval() {
-		retryDelay = w.writeOptions.MaxRetryInterval()
+// WriteBatch performs actual writing via HTTP service.
+// If tracing is enabled, the write is traced by a span linked to the span contexts of the batch.
+func (w *Service) WriteBatch(ctx context.Context, batch *Batch) *http2.Error {
+	if w.tracer != nil {
+		links := make([]trace.Link, len(batch.SpanContexts))
+		for i, sc := range batch.SpanContexts {
+			links[i] = trace.Link{SpanContext: sc}
+		}
+		var span trace.Span
+		ctx, span = w.tracer.Start(ctx, "influxdb write batch", trace.WithLinks(links...), trace.WithAttributes(ihttp.DBSystem,
+			attribute.String("influxdb.org", w.org),
+			attribute.String("influxdb.bucket", w.bucket),
+			attribute.Int("influxdb.points", batch.Points()),
+			attribute.Int("influxdb.bytes", len(batch.Batch)),
+			attribute.Int("influxdb.retry_attempts", int(batch.RetryAttempts))))
+		defer span.End()
+		perror := w.writeBatch(ctx, batch)
+		if perror != nil {
+			span.RecordError(perror)
+			span.SetStatus(codes.Error, perror.Error())
+		}
+		return perror
 	}
-	return retryDelay
+	return w.writeBatch(ctx, batch)
 }
 
-// pow computes x**y
-func pow(x, y uint) uint {
-	p := uint(1)
-	if y == 0 {
-		return 1
-	}
-	for i := uint(1); i <= y; i++ {
-		p = p * x
+// writeBatch sends batch to the server
+func (w *Service) writeBatch(ctx context.Context, batch *Batch) *http2.Error {
+	if w.rateLimiter != nil {
+		if err := w.rateLimiter.Wait(ctx, batch.Points(), len(batch.Batch)); err != nil {
+			return http2.NewError(err)
+		}
 	}
-	return p
-}
-
-// WriteBatch performs actual writing via HTTP service
-func (w *Service) WriteBatch(ctx context.Context, batch *Batch) *http2.Error {
 	var body io.Reader
 	var err error
 	body = strings.NewReader(batch.Batch)
@@ -293,36 +781,117 @@ func (w *Service) WriteBatch(ctx context.Context, batch *Batch) *http2.Error {
 			return http2.NewError(err)
 		}
 	}
+	start := time.Now()
 	w.lock.Lock()
-	w.lastWriteAttempt = time.Now()
+	w.lastWriteAttempt = start
 	w.lock.Unlock()
+	atomic.AddInt32(&w.inFlight, 1)
+	defer atomic.AddInt32(&w.inFlight, -1)
 	perror := w.httpService.DoPostRequest(ctx, w.url, body, func(req *http.Request) {
 		if w.writeOptions.UseGZip() {
 			req.Header.Set("Content-Encoding", "gzip")
 		}
+		if w.username != "" {
+			req.SetBasicAuth(w.username, w.password)
+		}
 	}, func(r *http.Response) error {
+		batch.ResponseHeader = r.Header
 		return r.Body.Close()
 	})
+	latency := time.Since(start)
+	batch.Latency = latency
+	if w.rateLimiter != nil {
+		switch {
+		case perror == nil:
+			w.rateLimiter.Succeeded()
+		case perror.StatusCode == http.StatusTooManyRequests:
+			log.Warnf("Write throttled by server, lowering write rate and pausing writes for %ds", perror.RetryAfter)
+			w.rateLimiter.Throttled(time.Duration(perror.RetryAfter) * time.Second)
+		}
+	}
+	if perror != nil {
+		batch.LastError = perror
+	}
+	if perror != nil && perror.Err == nil {
+		if pe := newPartialWriteError(batch.Batch, perror); pe != nil {
+			perror.Err = pe
+		}
+	}
+	w.notify(func(o write.Observer) {
+		var err error
+		if perror != nil {
+			err = perror
+		}
+		o.BatchSent(batch, latency, len(batch.Batch), err)
+	})
+	return perror
+}
+
+// Write writes a new batch once, without retrying, and notifies the observer about the result.
+// Batch rejected as too large is split, according to the retry policy, and its halves are written separately.
+// It is used by blocking writes.
+func (w *Service) Write(ctx context.Context, batch *Batch) *http2.Error {
+	w.notify(func(o write.Observer) { o.BatchCreated(batch) })
+	perror := w.writeSplit(ctx, batch)
+	if perror != nil {
+		w.notify(func(o write.Observer) { o.BatchDropped(batch, perror) })
+	} else {
+		w.notify(func(o write.Observer) { o.BatchSucceeded(batch) })
+	}
+	return perror
+}
+
+// writeSplit writes batch, if the retry policy decides to split it after a failure, halves are written separately.
+// It returns the first error of writing the halves.
+func (w *Service) writeSplit(ctx context.Context, batch *Batch) *http2.Error {
+	perror := w.WriteBatch(ctx, batch)
+	if perror == nil || w.policy().Decide(perror, 0) != write.RetryActionSplit {
+		return perror
+	}
+	halves := batch.Split()
+	if halves == nil {
+		return perror
+	}
+	log.Warnf("Write error: %s, splitting batch", perror.Error())
+	perror = nil
+	for _, h := range halves {
+		if err := w.writeSplit(ctx, h); err != nil && perror == nil {
+			perror = err
+		}
+	}
 	return perror
 }
 
-// Flush sends batches from retry queue immediately, without retrying
-func (w *Service) Flush() {
-	for !w.retryQueue.isEmpty() {
-		b := w.retryQueue.pop()
+// Flush sends batches from retry queue immediately, without retrying.
+// In case of persistent retry queue, flushing stops at the first failed batch, which remains in the queue along with the following ones.
+// Flushing also stops when ctx is done, remaining batches are left in the retry queue.
+func (w *Service) Flush(ctx context.Context) {
+	w.queueLock.Lock()
+	defer w.queueLock.Unlock()
+	defer w.updateQueueDepth()
+	for w.queueLen() > 0 && ctx.Err() == nil {
+		b := w.queueFirst()
 		if time.Now().After(b.Expires) {
 			log.Error("Oldest batch in retry queue expired, discarding")
+			w.expireFirst()
 			continue
 		}
-		if err := w.WriteBatch(context.Background(), b); err != nil {
+		if err := w.WriteBatch(ctx, b); err != nil {
 			log.Errorf("Error flushing batch from retry queue: %w", err.Unwrap())
+			if w.persistentQueue || ctx.Err() != nil {
+				return
+			}
+			w.dropFirst(err)
+			continue
 		}
+		w.popRetryQueue(nil)
+		w.notify(func(o write.Observer) { o.BatchSucceeded(b) })
 	}
 }
 
 // pointWithDefaultTags encapsulates Point with default tags
 type pointWithDefaultTags struct {
-	point       *write.Point
+	point       lp.Metric
 	defaultTags map[string]string
 }
 
@@ -383,9 +952,42 @@ func (w *Service) EncodePoints(points ...*write.Point) (string, error) {
 	return buffer.String(), nil
 }
 
+// EncodeRecords parses line protocol records and encodes them again with default tags
+// and timestamps converted from write.Options.RecordPrecision to write.Options.Precision.
+// Records without timestamp are left without timestamp. Empty lines and comments are skipped.
+// It returns error if any record is not valid line protocol.
+func (w *Service) EncodeRecords(lines ...string) (string, error) {
+	handler := lp.NewMetricHandler()
+	if w.writeOptions.RecordPrecision() > 0 {
+		handler.SetTimePrecision(w.writeOptions.RecordPrecision())
+	} else {
+		handler.SetTimePrecision(w.writeOptions.Precision())
+	}
+	// keep records without timestamp, server assigns it
+	handler.SetTimeFunc(func() time.Time { return time.Time{} })
+	parser := lp.NewParser(handler)
+	var buffer bytes.Buffer
+	e := lp.NewEncoder(&buffer)
+	e.SetFieldTypeSupport(lp.UintSupport)
+	e.FailOnFieldErr(true)
+	e.SetPrecision(w.writeOptions.Precision())
+	for _, line := range lines {
+		metrics, err := parser.Parse([]byte(line))
+		if err != nil {
+			return "", err
+		}
+		for _, m := range metrics {
+			if _, err := e.Encode(w.pointToEncode(m)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return buffer.String(), nil
+}
+
 // pointToEncode determines whether default tags should be applied
 // and returns point with default tags instead of point
-func (w *Service) pointToEncode(point *write.Point) lp.Metric {
+func (w *Service) pointToEncode(point lp.Metric) lp.Metric {
 	var m lp.Metric
 	if len(w.writeOptions.DefaultTags()) > 0 {
 		m = &pointWithDefaultTags{
@@ -415,3 +1017,11 @@ func precisionToString(precision time.Duration) string {
 	}
 	return prec
 }
+
+// precisionToStringV1 returns precision in the form accepted by InfluxDB 1.x
+func precisionToStringV1(precision time.Duration) string {
+	if precision == time.Microsecond {
+		return "u"
+	}
+	return precisionToString(precision)
+}
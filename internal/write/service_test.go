@@ -8,6 +8,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	ilog "log"
 	ihttp "net/http"
 	"net/http/httptest"
@@ -34,6 +35,13 @@ func TestPrecisionToString(t *testing.T) {
 	assert.Equal(t, "ns", precisionToString(time.Microsecond*20))
 }
 
+func TestPrecisionToStringV1(t *testing.T) {
+	assert.Equal(t, "ns", precisionToStringV1(time.Nanosecond))
+	assert.Equal(t, "u", precisionToStringV1(time.Microsecond))
+	assert.Equal(t, "ms", precisionToStringV1(time.Millisecond))
+	assert.Equal(t, "s", precisionToStringV1(time.Second))
+}
+
 func TestAddDefaultTags(t *testing.T) {
 	hs := test.NewTestService(t, "http://localhost:8888")
 	opts := write.DefaultOptions()
@@ -75,6 +83,29 @@ func TestAddDefaultTags(t *testing.T) {
 	assert.Len(t, p.TagList(), 2)
 }
 
+func TestEncodeRecords(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8888")
+	opts := write.DefaultOptions().SetPrecision(time.Second).SetRecordPrecision(time.Millisecond)
+	opts.AddDefaultTag("env", "prod")
+	opts.AddDefaultTag("region", "eu")
+	srv := NewService("org", "buc", hs, opts)
+
+	s, err := srv.EncodeRecords("cpu,host=a,region=us usage=1.5,count=2i 1700000000123", "mem free=10u")
+	require.NoError(t, err)
+	assert.Equal(t, "cpu,env=prod,host=a,region=us usage=1.5,count=2i 1700000000\nmem,env=prod,region=eu free=10u\n", s)
+
+	s, err = srv.EncodeRecords("# comment\n\ndisk,path=/ used=true 1700000000000\n")
+	require.NoError(t, err)
+	assert.Equal(t, "disk,env=prod,path=/,region=eu used=true 1700000000\n", s)
+
+	s, err = srv.EncodeRecords("")
+	require.NoError(t, err)
+	assert.Equal(t, "", s)
+
+	_, err = srv.EncodeRecords("cpu,host=a usage=1.5", "cpu usage=")
+	assert.Error(t, err)
+}
+
 func TestRetryStrategy(t *testing.T) {
 	log.Log.SetLogLevel(log.DebugLevel)
 	hs := test.NewTestService(t, "http://localhost:8086")
@@ -90,7 +121,7 @@ func TestRetryStrategy(t *testing.T) {
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, 1, srv.retryDelay)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	//wait retry delay + little more
 	<-time.After(time.Millisecond*time.Duration(srv.retryDelay) + time.Microsecond*5)
@@ -99,7 +130,7 @@ func TestRetryStrategy(t *testing.T) {
 	err = srv.HandleWrite(ctx, b2)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 2, 4)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 	//wait retry delay + little more
 	<-time.After(time.Millisecond*time.Duration(srv.retryDelay) + time.Microsecond*5)
@@ -108,7 +139,7 @@ func TestRetryStrategy(t *testing.T) {
 	err = srv.HandleWrite(ctx, b3)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 4, 8)
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	//wait retry delay + little more
 	<-time.After(time.Millisecond*time.Duration(srv.retryDelay) + time.Microsecond*5)
@@ -117,7 +148,7 @@ func TestRetryStrategy(t *testing.T) {
 	err = srv.HandleWrite(ctx, b4)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 8, 16)
-	assert.Equal(t, 4, srv.retryQueue.list.Len())
+	assert.Equal(t, 4, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond*time.Duration(srv.retryDelay) + time.Microsecond*5)
 	// Clear error and let write pass
@@ -125,7 +156,7 @@ func TestRetryStrategy(t *testing.T) {
 	// Batches from retry queue will be sent first
 	err = srv.HandleWrite(ctx, NewBatch("5\n", opts.MaxRetryTime()))
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	require.Len(t, hs.Lines(), 5)
 	assert.Equal(t, "1", hs.Lines()[0])
 	assert.Equal(t, "2", hs.Lines()[1])
@@ -157,7 +188,7 @@ func TestBufferOverwrite(t *testing.T) {
 	assert.NotNil(t, err)
 	//assert.Equal(t, uint(baseRetryInterval), srv.retryDelay)
 	assertBetween(t, srv.retryDelay, baseRetryInterval, baseRetryInterval*2)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b2 := NewBatch("2\n", opts.MaxRetryTime())
@@ -165,7 +196,7 @@ func TestBufferOverwrite(t *testing.T) {
 	err = srv.HandleWrite(ctx, b2)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, baseRetryInterval*2, baseRetryInterval*4)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b3 := NewBatch("3\n", opts.MaxRetryTime())
@@ -173,7 +204,7 @@ func TestBufferOverwrite(t *testing.T) {
 	err = srv.HandleWrite(ctx, b3)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, baseRetryInterval*4, baseRetryInterval*8)
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	// Write early and overwrite
 	b4 := NewBatch("4\n", opts.MaxRetryTime())
@@ -184,7 +215,7 @@ func TestBufferOverwrite(t *testing.T) {
 	err = srv.HandleWrite(ctx, b4)
 	assert.NoError(t, err)
 	assert.Equal(t, priorRetryDelay, srv.retryDelay) // Accumulated retry delay should be retained despite batch discard
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	// Overwrite
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay) / 2)
@@ -194,7 +225,7 @@ func TestBufferOverwrite(t *testing.T) {
 	// the second batch will be discarded
 	err = srv.HandleWrite(ctx, b5)
 	assert.Nil(t, err) // No error should be returned, because no write was attempted (still waiting for retryDelay to expire)
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	// Clear error and let write pass
@@ -202,7 +233,7 @@ func TestBufferOverwrite(t *testing.T) {
 	// Batches from retry queue will be sent first
 	err = srv.HandleWrite(ctx, NewBatch("6\n", opts.MaxRetryTime()))
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	require.Len(t, hs.Lines(), 4)
 	assert.Equal(t, "3", hs.Lines()[0])
 	assert.Equal(t, "4", hs.Lines()[1])
@@ -210,6 +241,95 @@ func TestBufferOverwrite(t *testing.T) {
 	assert.Equal(t, "6", hs.Lines()[3])
 }
 
+func TestBufferOverflowDropNewest(t *testing.T) {
+	log.Log.SetLogLevel(log.DebugLevel)
+	hs := test.NewTestService(t, "http://localhost:8086")
+	// Buffer for 2 batches
+	opts := write.DefaultOptions().SetRetryInterval(10_000).SetRetryBufferLimit(10_000).SetOverflowPolicy(write.OverflowDropNewest)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	err := srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime()))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, srv.retryQueue.Len())
+	// retry delay has not passed yet, batches are stored
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("2\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime())))
+	assert.Equal(t, 2, srv.retryQueue.Len())
+	assert.Equal(t, "1\n", srv.retryQueue.First().Batch)
+
+	hs.SetReplyError(nil)
+	srv.lastWriteAttempt = time.Time{}
+	require.NoError(t, srv.HandleWrite(ctx, nil))
+	assert.Equal(t, 0, srv.retryQueue.Len())
+	assert.Equal(t, []string{"1", "2"}, hs.Lines())
+}
+
+func TestBufferOverflowBlock(t *testing.T) {
+	log.Log.SetLogLevel(log.DebugLevel)
+	hs := test.NewTestService(t, "http://localhost:8086")
+	// Buffer for 1 batch
+	opts := write.DefaultOptions().SetRetryInterval(20).SetRetryBufferLimit(5_000).SetOverflowPolicy(write.OverflowBlock)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	err := srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime()))
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, srv.retryQueue.Len())
+
+	go func() {
+		<-time.After(30 * time.Millisecond)
+		hs.SetReplyError(nil)
+	}()
+	// blocks until the first batch is written
+	start := time.Now()
+	err = srv.HandleWrite(ctx, NewBatch("2\n", opts.MaxRetryTime()))
+	require.NoError(t, err)
+	assert.True(t, time.Since(start) >= 30*time.Millisecond)
+	assert.Equal(t, 0, srv.retryQueue.Len())
+	assert.Equal(t, []string{"1", "2"}, hs.Lines())
+
+	// cancelled context stops waiting
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	err = srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime()))
+	assert.NotNil(t, err)
+	ctx2, cancel := context.WithTimeout(ctx, 5*time.Millisecond)
+	defer cancel()
+	err = srv.HandleWrite(ctx2, NewBatch("4\n", opts.MaxRetryTime()))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, 1, srv.retryQueue.Len())
+}
+
+func TestBufferLimitBytes(t *testing.T) {
+	log.Log.SetLogLevel(log.DebugLevel)
+	hs := test.NewTestService(t, "http://localhost:8086")
+	opts := write.DefaultOptions().SetRetryInterval(10_000).SetRetryBufferLimitBytes(7)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	err := srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime()))
+	assert.NotNil(t, err)
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("2\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime())))
+	assert.Equal(t, 3, srv.retryQueue.Len())
+	// oldest two batches are discarded
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("4444\n", opts.MaxRetryTime())))
+	assert.Equal(t, 2, srv.retryQueue.Len())
+	assert.Equal(t, 7, srv.retryQueue.Bytes())
+	// too big batch is discarded
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("5555555\n", opts.MaxRetryTime())))
+	assert.Equal(t, 2, srv.retryQueue.Len())
+	assert.Equal(t, "3\n", srv.retryQueue.First().Batch)
+}
+
 func TestMaxRetryInterval(t *testing.T) {
 	log.Log.SetLogLevel(log.DebugLevel)
 	hs := test.NewTestService(t, "http://localhost:8086")
@@ -226,7 +346,7 @@ func TestMaxRetryInterval(t *testing.T) {
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
 	assert.Equal(t, uint(1), srv.retryDelay)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b2 := NewBatch("2\n", opts.MaxRetryTime())
@@ -234,7 +354,7 @@ func TestMaxRetryInterval(t *testing.T) {
 	err = srv.HandleWrite(ctx, b2)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 2, 4)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b3 := NewBatch("3\n", opts.MaxRetryTime())
@@ -243,7 +363,7 @@ func TestMaxRetryInterval(t *testing.T) {
 	assert.NotNil(t, err)
 	// New computed delay of first batch should be 4-8, is limited to 4
 	assert.EqualValues(t, 4, srv.retryDelay)
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b4 := NewBatch("4\n", opts.MaxRetryTime())
@@ -252,7 +372,7 @@ func TestMaxRetryInterval(t *testing.T) {
 	assert.NotNil(t, err)
 	// New computed delay of first batch should be 8-116, is limited to 4
 	assert.EqualValues(t, 4, srv.retryDelay)
-	assert.Equal(t, 4, srv.retryQueue.list.Len())
+	assert.Equal(t, 4, srv.retryQueue.Len())
 }
 
 func min(a, b uint) uint {
@@ -277,7 +397,7 @@ func TestMaxRetries(t *testing.T) {
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, 1, srv.retryDelay)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 	// Write so many batches as it is maxRetries (5)
 	// First batch will be written and it will reach max retry limit
 	for i, e := uint(1), uint(2); i <= opts.MaxRetries(); i++ {
@@ -288,7 +408,7 @@ func TestMaxRetries(t *testing.T) {
 		assert.NotNil(t, err)
 		assertBetween(t, srv.retryDelay, e, e*2)
 		exp := min(i+1, opts.MaxRetries())
-		assert.EqualValues(t, exp, srv.retryQueue.list.Len())
+		assert.EqualValues(t, exp, srv.retryQueue.Len())
 		e *= 2
 	}
 	//Test if was removed from retry queue
@@ -300,7 +420,7 @@ func TestMaxRetries(t *testing.T) {
 	// Batches from retry queue will be sent first
 	err = srv.HandleWrite(ctx, NewBatch(fmt.Sprintf("%d\n", opts.MaxRetries()+2), opts.MaxRetryTime()))
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	require.Len(t, hs.Lines(), int(opts.MaxRetries()+1))
 	for i := uint(2); i <= opts.MaxRetries()+2; i++ {
 		assert.Equal(t, fmt.Sprintf("%d", i), hs.Lines()[i-2])
@@ -323,7 +443,7 @@ func TestMaxRetryTime(t *testing.T) {
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, 1, srv.retryDelay)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	// Wait for batch expiration
 	<-time.After(5 * time.Millisecond)
@@ -340,7 +460,7 @@ func TestMaxRetryTime(t *testing.T) {
 	require.NotNil(t, err)
 	// 1st Batch expires and writing 2nd trows error
 	assert.Equal(t, "write failed (attempts 1): Unexpected status code 429", err.Error())
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	//wait until remaining accumulated retryDelay has passed, because there hasn't been a successful write yet
 	<-time.After(time.Until(srv.lastWriteAttempt.Add(time.Millisecond * time.Duration(srv.retryDelay))))
@@ -349,7 +469,7 @@ func TestMaxRetryTime(t *testing.T) {
 	// A batch from retry queue will be sent first
 	err = srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime()))
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	require.Len(t, hs.Lines(), 2)
 	assert.Equal(t, "2", hs.Lines()[0])
 	assert.Equal(t, "3", hs.Lines()[1])
@@ -373,7 +493,7 @@ func TestRetryOnConnectionError(t *testing.T) {
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
 	assert.EqualValues(t, 1, srv.retryDelay)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 
@@ -382,7 +502,7 @@ func TestRetryOnConnectionError(t *testing.T) {
 	err = srv.HandleWrite(ctx, b2)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 2, 4)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 
@@ -391,7 +511,7 @@ func TestRetryOnConnectionError(t *testing.T) {
 	err = srv.HandleWrite(ctx, b3)
 	assert.NotNil(t, err)
 	assertBetween(t, srv.retryDelay, 4, 8)
-	assert.Equal(t, 3, srv.retryQueue.list.Len())
+	assert.Equal(t, 3, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	// Clear error and let write pass
@@ -399,7 +519,7 @@ func TestRetryOnConnectionError(t *testing.T) {
 	// Batches from retry queue will be sent first
 	err = srv.HandleWrite(ctx, NewBatch("4\n", opts.MaxRetryTime()))
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	require.Len(t, hs.Lines(), 4)
 	assert.Equal(t, "1", hs.Lines()[0])
 	assert.Equal(t, "2", hs.Lines()[1])
@@ -422,7 +542,7 @@ func TestNoRetryIfMaxRetriesIsZero(t *testing.T) {
 	b1 := NewBatch("1\n", opts.MaxRetryTime())
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 }
 
 func TestWriteContextCancel(t *testing.T) {
@@ -445,34 +565,11 @@ func TestWriteContextCancel(t *testing.T) {
 	assert.Len(t, hs.Lines(), 0)
 }
 
-func TestPow(t *testing.T) {
-	assert.EqualValues(t, 1, pow(10, 0))
-	assert.EqualValues(t, 10, pow(10, 1))
-	assert.EqualValues(t, 4, pow(2, 2))
-	assert.EqualValues(t, 1, pow(1, 2))
-	assert.EqualValues(t, 125, pow(5, 3))
-}
-
 func assertBetween(t *testing.T, val, min, max uint) {
 	t.Helper()
 	assert.True(t, val >= min && val <= max, fmt.Sprintf("%d is outside <%d;%d>", val, min, max))
 }
 
-func TestComputeRetryDelay(t *testing.T) {
-	hs := test.NewTestService(t, "http://localhost:8888")
-	opts := write.DefaultOptions()
-	srv := NewService("my-org", "my-bucket", hs, opts)
-	assertBetween(t, srv.computeRetryDelay(0), 5_000, 10_000)
-	assertBetween(t, srv.computeRetryDelay(1), 10_000, 20_000)
-	assertBetween(t, srv.computeRetryDelay(2), 20_000, 40_000)
-	assertBetween(t, srv.computeRetryDelay(3), 40_000, 80_000)
-	assertBetween(t, srv.computeRetryDelay(4), 80_000, 125_000)
-
-	for i := uint(5); i < 200; i++ { //test also limiting higher values
-		assert.EqualValues(t, 125_000, srv.computeRetryDelay(i))
-	}
-}
-
 func TestErrorCallback(t *testing.T) {
 	log.Log.SetLogLevel(log.DebugLevel)
 	hs := test.NewTestService(t, "http://localhost:8086")
@@ -491,19 +588,19 @@ func TestErrorCallback(t *testing.T) {
 	b1 := NewBatch("1\n", opts.MaxRetryTime())
 	err := srv.HandleWrite(ctx, b1)
 	assert.NotNil(t, err)
-	assert.Equal(t, 1, srv.retryQueue.list.Len())
+	assert.Equal(t, 1, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b := NewBatch("2\n", opts.MaxRetryTime())
 	err = srv.HandleWrite(ctx, b)
 	assert.NotNil(t, err)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 	<-time.After(time.Millisecond * time.Duration(srv.retryDelay))
 	b = NewBatch("3\n", opts.MaxRetryTime())
 	err = srv.HandleWrite(ctx, b)
 	assert.NotNil(t, err)
-	assert.Equal(t, 2, srv.retryQueue.list.Len())
+	assert.Equal(t, 2, srv.retryQueue.Len())
 
 }
 
@@ -541,7 +638,7 @@ func TestRetryIntervalAccumulation(t *testing.T) {
 	for ; i <= 45; i++ {
 		b := NewBatch(fmt.Sprintf("%d\n", i), opts.MaxRetryTime())
 		err := srv.HandleWrite(ctx, b)
-		assert.Equal(t, minInt(i, 5), srv.retryQueue.list.Len())
+		assert.Equal(t, minInt(i, 5), srv.retryQueue.Len())
 		assert.GreaterOrEqual(t, srv.retryDelay, lastInterval)         // Should not decrease while writes failing
 		assert.LessOrEqual(t, srv.retryDelay, opts.MaxRetryInterval()) // Should not grow larger than max
 		if err != nil {
@@ -574,7 +671,7 @@ func TestRetryIntervalAccumulation(t *testing.T) {
 		b := NewBatch(fmt.Sprintf("%d\n", i), opts.MaxRetryTime())
 		err := srv.HandleWrite(ctx, b)
 		assert.Nil(t, err) // There should be no write attempt
-		assert.Equal(t, minInt(i, 5), srv.retryQueue.list.Len())
+		assert.Equal(t, minInt(i, 5), srv.retryQueue.Len())
 		assert.Equal(t, srv.retryDelay, opts.MaxRetryInterval()) // Should remain the same
 		log.Log.Infof("Retry interval still at %d ms", srv.retryDelay)
 		<-time.After(writeInterval)
@@ -584,7 +681,7 @@ func TestRetryIntervalAccumulation(t *testing.T) {
 	b := NewBatch(fmt.Sprintf("%d\n", i), opts.MaxRetryTime())
 	err := srv.HandleWrite(ctx, b)
 	assert.Nil(t, err)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	assert.Equal(t, srv.retryAttempts, uint(0)) // Should reset to zero
 
 	// Ensure proper batches got written to server
@@ -617,8 +714,8 @@ func TestFlush(t *testing.T) {
 		b := NewBatch(line, 20)
 		_ = srv.HandleWrite(ctx, b)
 	}
-	assert.Equal(t, 5, srv.retryQueue.list.Len())
-	srv.Flush()
+	assert.Equal(t, 5, srv.retryQueue.Len())
+	srv.Flush(context.Background())
 	assert.Len(t, hs.Lines(), 0)
 
 	// Test flush will find all batches expired
@@ -627,14 +724,14 @@ func TestFlush(t *testing.T) {
 		_ = srv.HandleWrite(ctx, b)
 	}
 
-	assert.Equal(t, 5, srv.retryQueue.list.Len())
+	assert.Equal(t, 5, srv.retryQueue.Len())
 	<-time.After(5 * time.Millisecond)
 
 	hs.SetReplyError(nil)
 	// all batches should expire
-	srv.Flush()
+	srv.Flush(context.Background())
 	assert.Len(t, hs.Lines(), 0)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 
 	// Test flush will succeed
 	hs.SetReplyError(&http.Error{
@@ -645,12 +742,12 @@ func TestFlush(t *testing.T) {
 		_ = srv.HandleWrite(ctx, b)
 	}
 
-	assert.Equal(t, 5, srv.retryQueue.list.Len())
+	assert.Equal(t, 5, srv.retryQueue.Len())
 	hs.SetReplyError(nil)
 	// all batches should expire
-	srv.Flush()
+	srv.Flush(context.Background())
 	assert.Len(t, hs.Lines(), 5)
-	assert.Equal(t, 0, srv.retryQueue.list.Len())
+	assert.Equal(t, 0, srv.retryQueue.Len())
 }
 
 func TestConsistencyParam(t *testing.T) {
@@ -693,12 +790,444 @@ func TestIgnoreErrors(t *testing.T) {
 	b := NewBatch("1", 20)
 	err := srv.HandleWrite(ctx, b)
 	assert.NoError(t, err)
+	// partial writes are not retried, but reported
+	var pe *write.PartialWriteError
 	err = srv.HandleWrite(ctx, b)
-	assert.NoError(t, err)
+	require.ErrorAs(t, err, &pe)
+	assert.Contains(t, pe.Rejected[0].Reason, "field type conflict")
 	err = srv.HandleWrite(ctx, b)
-	assert.NoError(t, err)
+	require.ErrorAs(t, err, &pe)
+	assert.Contains(t, pe.Rejected[0].Reason, "points beyond retention policy")
 	err = srv.HandleWrite(ctx, b)
-	assert.NoError(t, err)
+	require.ErrorAs(t, err, &pe)
+	assert.Equal(t, "cpu value", pe.Rejected[0].Line)
+	assert.Equal(t, 0, srv.retryQueue.Len())
 	err = srv.HandleWrite(ctx, b)
 	assert.Error(t, err)
+	assert.False(t, errors.As(err, &pe))
+}
+
+func TestBatchAcks(t *testing.T) {
+	log.Log.SetLogLevel(log.DebugLevel)
+	hs := test.NewTestService(t, "http://localhost:8086")
+	// Buffer for 2 batches
+	opts := write.DefaultOptions().SetRetryInterval(10_000).SetRetryBufferLimit(10_000)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	batches := make([]*Batch, 4)
+	for i := range batches {
+		batches[i] = NewBatch(fmt.Sprintf("%d\n", i+1), opts.MaxRetryTime())
+		batches[i].Acks = []*write.Ack{write.NewAck(i)}
+	}
+	assert.Error(t, srv.HandleWrite(ctx, batches[0]))
+	require.NoError(t, srv.HandleWrite(ctx, batches[1]))
+	// oldest batch is discarded
+	require.NoError(t, srv.HandleWrite(ctx, batches[2]))
+	<-batches[0].Acks[0].Done()
+	assert.Equal(t, write.ErrRetryQueueFull, batches[0].Acks[0].Err())
+
+	hs.SetReplyError(nil)
+	srv.lastWriteAttempt = time.Time{}
+	require.NoError(t, srv.HandleWrite(ctx, nil))
+	for _, b := range batches[1:3] {
+		<-b.Acks[0].Done()
+		assert.NoError(t, b.Acks[0].Err())
+	}
+
+	hs.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	assert.Error(t, srv.HandleWrite(ctx, batches[3]))
+	assert.Equal(t, 1, srv.retryQueue.Len())
+	require.NoError(t, srv.Close())
+	<-batches[3].Acks[0].Done()
+	assert.Equal(t, write.ErrWriteAPIClosed, batches[3].Acks[0].Err())
+}
+
+func TestSplitTooLargeBatch(t *testing.T) {
+	log.Log.SetLogLevel(log.DebugLevel)
+	var lines []string
+	var lock sync.Mutex
+	accepted := 0
+	server := httptest.NewServer(ihttp.HandlerFunc(func(w ihttp.ResponseWriter, r *ihttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		l := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		if len(l) > 2 {
+			w.WriteHeader(ihttp.StatusRequestEntityTooLarge)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		accepted++
+		if accepted == 2 {
+			// the second part fails once
+			w.WriteHeader(ihttp.StatusServiceUnavailable)
+			return
+		}
+		lines = append(lines, l...)
+		w.WriteHeader(ihttp.StatusNoContent)
+	}))
+	defer server.Close()
+	opts := write.DefaultOptions().SetRetryInterval(1)
+	srv := NewService("my-org", "my-bucket", http.NewService(server.URL, "", http.DefaultOptions()), opts)
+
+	b := NewBatch("1\n2\n3\n4\n5\n6\n7\n", opts.MaxRetryTime())
+	ack := write.NewAck(nil)
+	b.Acks = []*write.Ack{ack}
+	// halves of the batch are written until the second part fails
+	require.Error(t, srv.HandleWrite(context.Background(), b))
+	assert.Equal(t, []string{"1"}, lines)
+	assert.Equal(t, 2, srv.RetryQueueLen())
+	assert.Equal(t, 0, srv.retryQueue.Len())
+
+	// remaining parts are retried before a new batch
+	<-time.After(10 * time.Millisecond)
+	require.NoError(t, srv.HandleWrite(context.Background(), NewBatch("8\n", opts.MaxRetryTime())))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "8"}, lines)
+	assert.Equal(t, 0, srv.RetryQueueLen())
+	<-ack.Done()
+	assert.NoError(t, ack.Err())
+}
+
+func TestSplitPersistentBatch(t *testing.T) {
+	var lines []string
+	var lock sync.Mutex
+	accepted := 0
+	unavailable := true
+	server := httptest.NewServer(ihttp.HandlerFunc(func(w ihttp.ResponseWriter, r *ihttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		l := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		lock.Lock()
+		defer lock.Unlock()
+		if unavailable {
+			w.WriteHeader(ihttp.StatusServiceUnavailable)
+			return
+		}
+		if len(l) > 2 {
+			w.WriteHeader(ihttp.StatusRequestEntityTooLarge)
+			return
+		}
+		accepted++
+		if accepted%2 == 0 {
+			// every second part fails
+			w.WriteHeader(ihttp.StatusServiceUnavailable)
+			return
+		}
+		lines = append(lines, l...)
+		w.WriteHeader(ihttp.StatusNoContent)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	opts := write.DefaultOptions().SetRetryInterval(1)
+	newService := func() *Service {
+		srv := NewService("my-org", "my-bucket", http.NewService(server.URL, "", http.DefaultOptions()), opts)
+		require.NoError(t, srv.UsePersistentRetryQueue(dir))
+		return srv
+	}
+
+	// batch from the persistent retry queue remains persisted until its parts are written
+	srv := newService()
+	require.Error(t, srv.HandleWrite(context.Background(), NewBatch("1\n2\n3\n4\n5\n6\n7\n", opts.MaxRetryTime())))
+	lock.Lock()
+	unavailable = false
+	lock.Unlock()
+	<-time.After(10 * time.Millisecond)
+	require.Error(t, srv.HandleWrite(context.Background(), nil))
+	assert.Equal(t, []string{"1"}, lines)
+	assert.Equal(t, 2, srv.RetryQueueLen())
+	assert.Equal(t, 1, srv.PersistedBatches())
+	require.NoError(t, srv.Close())
+
+	srv = newService()
+	require.Equal(t, 1, srv.RetryQueueLen())
+	assert.Equal(t, "1\n2\n3\n4\n5\n6\n7\n", srv.retryQueue.First().Batch)
+	require.NoError(t, srv.Close())
+
+	// parts of a new batch are persisted when closing
+	srv = newService()
+	srv.retryQueue.Pop()
+	lines = nil
+	accepted = 0
+	require.Error(t, srv.HandleWrite(context.Background(), NewBatch("1\n2\n3\n4\n5\n6\n7\n", opts.MaxRetryTime())))
+	assert.Equal(t, []string{"1"}, lines)
+	require.NoError(t, srv.Close())
+
+	srv = newService()
+	require.Equal(t, 2, srv.RetryQueueLen())
+	assert.Equal(t, "2\n3\n", srv.retryQueue.Pop().Batch)
+	assert.Equal(t, "4\n5\n6\n7\n", srv.retryQueue.Pop().Batch)
+	require.NoError(t, srv.Close())
+}
+
+func TestPersistentQueueLowerLimit(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8086")
+	hs.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	dir := t.TempDir()
+	ctx := context.Background()
+	opts := write.DefaultOptions().SetBatchSize(1).SetRetryBufferLimit(3).SetRetryInterval(10_000)
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	require.NoError(t, srv.UsePersistentRetryQueue(dir))
+	for i := 1; i <= 3; i++ {
+		_ = srv.HandleWrite(ctx, NewBatch(fmt.Sprintf("%d\n", i), opts.MaxRetryTime()))
+	}
+	require.Equal(t, 3, srv.PersistedBatches())
+	require.NoError(t, srv.Close())
+
+	// the oldest batches over the lower limit are evicted when reloading
+	ch := make(chan *write.DeadLetter, 10)
+	stats := write.NewStatsCollector()
+	opts = write.DefaultOptions().SetBatchSize(1).SetRetryBufferLimit(1).SetRetryInterval(10_000).
+		SetDeadLetterSink(write.NewChannelDeadLetterSink(ch))
+	srv = NewService("my-org", "my-bucket", hs, opts)
+	srv.AddObserver(stats)
+	require.NoError(t, srv.UsePersistentRetryQueue(dir))
+	assert.Equal(t, 1, srv.PersistedBatches())
+	assert.Equal(t, 1, srv.RetryQueueDepth())
+	assert.Equal(t, "3\n", srv.retryQueue.First().Batch)
+	assert.EqualValues(t, 2, stats.Stats().BatchesEvicted)
+	require.Len(t, ch, 2)
+	for _, batch := range []string{"1\n", "2\n"} {
+		letter := <-ch
+		assert.Equal(t, batch, letter.Batch)
+		assert.Equal(t, write.DeadLetterEvicted, letter.Reason)
+	}
+	require.NoError(t, srv.Close())
+}
+
+func TestPersistentQueueLongOutage(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8086")
+	hs.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	dir := t.TempDir()
+	ctx := context.Background()
+	// limits raised to cover a day long outage
+	opts := write.DefaultOptions().SetRetryInterval(1).SetMaxRetryInterval(1).
+		SetMaxRetries(100).SetMaxRetryTime(24 * 60 * 60 * 1000)
+	newService := func() *Service {
+		srv := NewService("my-org", "my-bucket", hs, opts)
+		require.NoError(t, srv.UsePersistentRetryQueue(dir))
+		return srv
+	}
+	srv := newService()
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime())))
+	for i := 0; i < 9; i++ {
+		srv.lastWriteAttempt = time.Time{}
+		require.Error(t, srv.HandleWrite(ctx, nil))
+	}
+	require.NoError(t, srv.Close())
+
+	// more retries than the default limit are allowed, retry attempts continue after restart
+	srv = newService()
+	require.Equal(t, 1, srv.RetryQueueLen())
+	assert.EqualValues(t, 10, srv.retryQueue.First().RetryAttempts)
+	srv.lastWriteAttempt = time.Time{}
+	require.Error(t, srv.HandleWrite(ctx, nil))
+	assert.Equal(t, 1, srv.RetryQueueLen())
+	require.NoError(t, srv.Close())
+
+	srv = newService()
+	assert.EqualValues(t, 11, srv.retryQueue.First().RetryAttempts)
+	hs.SetReplyError(nil)
+	require.NoError(t, srv.HandleWrite(ctx, nil))
+	assert.Equal(t, 0, srv.RetryQueueLen())
+	assert.Equal(t, []string{"1"}, hs.Lines())
+	require.NoError(t, srv.Close())
+}
+
+func TestSplitBlockingWrite(t *testing.T) {
+	var lines []string
+	server := httptest.NewServer(ihttp.HandlerFunc(func(w ihttp.ResponseWriter, r *ihttp.Request) {
+		body, _ := io.ReadAll(r.Body)
+		l := strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")
+		if len(l) > 2 {
+			w.WriteHeader(ihttp.StatusRequestEntityTooLarge)
+			return
+		}
+		lines = append(lines, l...)
+		w.WriteHeader(ihttp.StatusNoContent)
+	}))
+	defer server.Close()
+	opts := write.DefaultOptions()
+	srv := NewService("my-org", "my-bucket", http.NewService(server.URL, "", http.DefaultOptions()), opts)
+	require.Nil(t, srv.Write(context.Background(), NewBatch("1\n2\n3\n4\n5\n", opts.MaxRetryTime())))
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, lines)
+}
+
+// eventRecorder is an observer recording batch events
+type eventRecorder struct {
+	events []string
+}
+
+func (r *eventRecorder) add(event string, batch *Batch) {
+	r.events = append(r.events, event+" "+strings.TrimSpace(batch.Batch))
+}
+
+func (r *eventRecorder) BatchCreated(batch *Batch) { r.add("created", batch) }
+func (r *eventRecorder) BatchSent(batch *Batch, _ time.Duration, _ int, err error) {
+	if err != nil {
+		r.add("failed", batch)
+	} else {
+		r.add("sent", batch)
+	}
+}
+func (r *eventRecorder) BatchSucceeded(batch *Batch)        { r.add("succeeded", batch) }
+func (r *eventRecorder) BatchRetried(batch *Batch, _ error) { r.add("retried", batch) }
+func (r *eventRecorder) BatchEvicted(batch *Batch)          { r.add("evicted", batch) }
+func (r *eventRecorder) BatchExpired(batch *Batch)          { r.add("expired", batch) }
+func (r *eventRecorder) BatchDropped(batch *Batch, _ error) { r.add("dropped", batch) }
+
+func TestObserver(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8086")
+	// Buffer for 2 batches
+	opts := write.DefaultOptions().SetRetryInterval(10_000).SetRetryBufferLimit(10_000)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	r := &eventRecorder{}
+	srv.AddObserver(r)
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("2\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime())))
+	assert.Equal(t, 2, srv.RetryQueueDepth())
+
+	hs.SetReplyError(nil)
+	srv.lastWriteAttempt = time.Time{}
+	require.NoError(t, srv.HandleWrite(ctx, nil))
+	assert.Equal(t, 0, srv.RetryQueueDepth())
+
+	hs.SetReplyError(&http.Error{
+		StatusCode: 400,
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("4\n", opts.MaxRetryTime())))
+
+	hs.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("5\n", 0)))
+	require.NoError(t, srv.HandleWrite(ctx, nil))
+	assert.Equal(t, []string{
+		"created 1", "failed 1", "retried 1",
+		"created 2",
+		"created 3", "evicted 1",
+		"sent 2", "succeeded 2", "sent 3", "succeeded 3",
+		"created 4", "failed 4", "dropped 4",
+		"created 5", "failed 5", "retried 5", "expired 5",
+	}, r.events)
+
+	hs.SetReplyError(nil)
+	require.Nil(t, srv.Write(ctx, NewBatch("6\n", 0)))
+	assert.Equal(t, []string{"created 6", "sent 6", "succeeded 6"}, r.events[17:])
+}
+
+func TestDeadLetters(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8086")
+	ch := make(chan *write.DeadLetter, 10)
+	// Buffer for 1 batch
+	opts := write.DefaultOptions().SetRetryInterval(10_000).SetRetryBufferLimit(5_000).SetMaxRetries(1).
+		SetDeadLetterSink(write.NewChannelDeadLetterSink(ch))
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+	nextLetter := func() *write.DeadLetter {
+		select {
+		case letter := <-ch:
+			return letter
+		case <-time.After(time.Second):
+			require.FailNow(t, "dead letter not received")
+			return nil
+		}
+	}
+	hs.SetReplyError(&http.Error{
+		StatusCode: 400,
+		Message:    "unable to parse",
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("1\n", opts.MaxRetryTime())))
+	letter := nextLetter()
+	assert.Equal(t, "1\n", letter.Batch)
+	assert.Equal(t, write.DeadLetterNotRetryable, letter.Reason)
+	assert.EqualError(t, letter.Err, "unable to parse")
+	assert.EqualValues(t, 0, letter.RetryAttempts)
+
+	hs.SetReplyError(&http.Error{
+		StatusCode: 503,
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("2\n", opts.MaxRetryTime())))
+	// evicts 2
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("3\n", opts.MaxRetryTime())))
+	letter = nextLetter()
+	assert.Equal(t, "2\n", letter.Batch)
+	assert.Equal(t, write.DeadLetterEvicted, letter.Reason)
+	assert.EqualValues(t, 1, letter.RetryAttempts)
+	require.Error(t, letter.Err)
+
+	// the first retry of 3 fails, the second one is not allowed
+	for i := 0; i < 2; i++ {
+		srv.lastWriteAttempt = time.Time{}
+		require.Error(t, srv.HandleWrite(ctx, nil))
+	}
+	letter = nextLetter()
+	assert.Equal(t, "3\n", letter.Batch)
+	assert.Equal(t, write.DeadLetterRetriesExhausted, letter.Reason)
+	assert.EqualValues(t, 2, letter.RetryAttempts)
+
+	srv.lastWriteAttempt = time.Time{}
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("4\n", 0)))
+	<-time.After(time.Millisecond)
+	_ = srv.HandleWrite(ctx, nil)
+	letter = nextLetter()
+	assert.Equal(t, "4\n", letter.Batch)
+	assert.Equal(t, write.DeadLetterExpired, letter.Reason)
+
+	srv.lastWriteAttempt = time.Time{}
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("5\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.Close())
+	letter = nextLetter()
+	assert.Equal(t, "5\n", letter.Batch)
+	assert.Equal(t, write.DeadLetterClosed, letter.Reason)
+
+	// blocking writes return errors instead
+	require.NotNil(t, srv.Write(ctx, NewBatch("6\n", 0)))
+	assert.Len(t, ch, 0)
+}
+
+func TestRateLimiting(t *testing.T) {
+	hs := test.NewTestService(t, "http://localhost:8086")
+	limiter := write.NewRateLimiter(10, 0)
+	opts := write.DefaultOptions().SetRetryInterval(1).SetRateLimiter(limiter)
+	ctx := context.Background()
+	srv := NewService("my-org", "my-bucket", hs, opts)
+
+	// batches are paced by the limiter
+	start := time.Now()
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("a\nb\nc\nd\ne\nf\ng\nh\ni\nj\n", opts.MaxRetryTime())))
+	require.NoError(t, srv.HandleWrite(ctx, NewBatch("k\nl\n", opts.MaxRetryTime())))
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+	assert.Len(t, hs.Lines(), 12)
+
+	// throttled write lowers rates and pauses writes
+	hs.SetReplyError(&http.Error{
+		StatusCode: 429,
+		RetryAfter: 1,
+	})
+	require.Error(t, srv.HandleWrite(ctx, NewBatch("m\n", opts.MaxRetryTime())))
+	points, _ := limiter.Rates()
+	assert.EqualValues(t, 5, points)
+	hs.SetReplyError(nil)
+	ctxTimeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, srv.HandleWrite(ctxTimeout, NewBatch("n\n", opts.MaxRetryTime())), context.DeadlineExceeded)
+	assert.Len(t, hs.Lines(), 12)
+
+	// blocking writes are paced too
+	require.Nil(t, srv.Write(ctx, NewBatch("o\n", opts.MaxRetryTime())))
+	assert.Len(t, hs.Lines(), 13)
+	points, _ = limiter.Rates()
+	assert.InDelta(t, 5.5, points, 0.001)
 }
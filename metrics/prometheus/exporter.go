@@ -0,0 +1,225 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+// Package prometheus provides Prometheus collector of metrics of InfluxDB client.
+// It is a separate module, so that only its users depend on the Prometheus client library:
+//
+//	go get github.com/influxdata/influxdb-client-go/v2/metrics/prometheus
+//
+// Exporter observes writes, HTTP requests and queries of a client created with instrumented options.
+// It must be registered to a Prometheus registry:
+//
+//	opts := influxdb2.DefaultOptions()
+//	exporter := prometheus.NewExporter(opts)
+//	client := influxdb2.NewClientWithOptions("http://localhost:8086", "my-token", opts)
+//	exporter.SetClient(client)
+//	prom.MustRegister(exporter)
+package prometheus
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	ihttp "github.com/influxdata/influxdb-client-go/v2/api/http"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is the prefix of names of all exported metrics
+const Namespace = "influxdb_client"
+
+// Exporter is a Prometheus collector of client metrics:
+//   - influxdb_client_write_batches_total - counter of batches by result: created, written, retried, evicted, expired and dropped
+//   - influxdb_client_write_points_total - counter of written points
+//   - influxdb_client_write_points_lost_total - counter of points in evicted, expired and dropped batches
+//   - influxdb_client_write_bytes_total - counter of bytes sent in write requests, before compression
+//   - influxdb_client_write_duration_seconds - histogram of durations of write requests
+//   - influxdb_client_write_retry_queue_batches - gauge of batches waiting for retry, if the client is set
+//   - influxdb_client_write_in_flight_requests - gauge of write requests in progress, if the client is set
+//   - influxdb_client_http_requests_total - counter of HTTP requests by endpoint, method and status code, which is "error" for failed requests
+//   - influxdb_client_query_duration_seconds - histogram of durations of queries, including reading of results, by endpoint
+//
+// Exporter is write.Observer.
+type Exporter struct {
+	batches       *prom.CounterVec
+	points        prom.Counter
+	pointsLost    prom.Counter
+	bytes         prom.Counter
+	writeDuration prom.Histogram
+	requests      *prom.CounterVec
+	queryDuration *prom.HistogramVec
+	retryQueue    *prom.Desc
+	inFlight      *prom.Desc
+	lock          sync.Mutex
+	client        influxdb2.Client
+}
+
+// NewExporter creates Exporter and instruments options to notify it.
+// The client must be created with the options after calling NewExporter.
+// Observers already set in options are kept.
+func NewExporter(options *influxdb2.Options) *Exporter {
+	e := &Exporter{
+		batches: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "write",
+			Name:      "batches_total",
+			Help:      "Number of batches by result.",
+		}, []string{"result"}),
+		points: prom.NewCounter(prom.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "write",
+			Name:      "points_total",
+			Help:      "Number of written points.",
+		}),
+		pointsLost: prom.NewCounter(prom.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "write",
+			Name:      "points_lost_total",
+			Help:      "Number of points in evicted, expired and dropped batches.",
+		}),
+		bytes: prom.NewCounter(prom.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "write",
+			Name:      "bytes_total",
+			Help:      "Number of bytes sent in write requests, before compression.",
+		}),
+		writeDuration: prom.NewHistogram(prom.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "write",
+			Name:      "duration_seconds",
+			Help:      "Duration of write requests.",
+			Buckets:   prom.DefBuckets,
+		}),
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: Namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by endpoint, method and status code.",
+		}, []string{"endpoint", "method", "code"}),
+		queryDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: Namespace,
+			Subsystem: "query",
+			Name:      "duration_seconds",
+			Help:      "Duration of queries, including reading of results.",
+			Buckets:   prom.DefBuckets,
+		}, []string{"endpoint"}),
+		retryQueue: prom.NewDesc(prom.BuildFQName(Namespace, "write", "retry_queue_batches"),
+			"Number of batches waiting for retry.", nil, nil),
+		inFlight: prom.NewDesc(prom.BuildFQName(Namespace, "write", "in_flight_requests"),
+			"Number of write requests in progress.", nil, nil),
+	}
+	options.WriteOptions().SetObserver(write.NewMultiObserver(options.WriteOptions().Observer(), e))
+	if prev := options.HTTPOptions().RequestObserver(); prev != nil {
+		options.HTTPOptions().SetRequestObserver(func(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+			prev(req, resp, err, duration)
+			e.ObserveRequest(req, resp, err, duration)
+		})
+	} else {
+		options.HTTPOptions().SetRequestObserver(e.ObserveRequest)
+	}
+	return e
+}
+
+// SetClient sets client, whose retry queue and in-flight requests are exported
+func (e *Exporter) SetClient(client influxdb2.Client) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.client = client
+}
+
+// Describe fulfils prometheus.Collector interface
+func (e *Exporter) Describe(ch chan<- *prom.Desc) {
+	e.batches.Describe(ch)
+	e.points.Describe(ch)
+	e.pointsLost.Describe(ch)
+	e.bytes.Describe(ch)
+	e.writeDuration.Describe(ch)
+	e.requests.Describe(ch)
+	e.queryDuration.Describe(ch)
+	ch <- e.retryQueue
+	ch <- e.inFlight
+}
+
+// Collect fulfils prometheus.Collector interface
+func (e *Exporter) Collect(ch chan<- prom.Metric) {
+	e.batches.Collect(ch)
+	e.points.Collect(ch)
+	e.pointsLost.Collect(ch)
+	e.bytes.Collect(ch)
+	e.writeDuration.Collect(ch)
+	e.requests.Collect(ch)
+	e.queryDuration.Collect(ch)
+	e.lock.Lock()
+	client := e.client
+	e.lock.Unlock()
+	if client != nil {
+		stats := client.Stats()
+		ch <- prom.MustNewConstMetric(e.retryQueue, prom.GaugeValue, float64(stats.RetryQueueDepth))
+		ch <- prom.MustNewConstMetric(e.inFlight, prom.GaugeValue, float64(stats.InFlightRequests))
+	}
+}
+
+// ObserveRequest counts finished HTTP requests and measures durations of queries. It has the signature of http.RequestObserver.
+func (e *Exporter) ObserveRequest(req *http.Request, resp *http.Response, err error, duration time.Duration) {
+	endpoint := ihttp.Endpoint(req.URL)
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	e.requests.WithLabelValues(endpoint, req.Method, code).Inc()
+	// Flux /api/v2/query and InfluxQL /query endpoints
+	if strings.HasSuffix(endpoint, "/query") {
+		e.queryDuration.WithLabelValues(endpoint).Observe(duration.Seconds())
+	}
+}
+
+// BatchCreated counts created batches
+func (e *Exporter) BatchCreated(*write.Batch) {
+	e.batches.WithLabelValues("created").Inc()
+}
+
+// BatchSent measures duration of write requests and counts sent bytes
+func (e *Exporter) BatchSent(_ *write.Batch, latency time.Duration, bytes int, _ error) {
+	e.writeDuration.Observe(latency.Seconds())
+	e.bytes.Add(float64(bytes))
+}
+
+// BatchSucceeded counts written batches and points
+func (e *Exporter) BatchSucceeded(batch *write.Batch) {
+	e.batches.WithLabelValues("written").Inc()
+	e.points.Add(float64(batch.Points()))
+}
+
+// BatchRetried counts retried batches
+func (e *Exporter) BatchRetried(*write.Batch, error) {
+	e.batches.WithLabelValues("retried").Inc()
+}
+
+// BatchEvicted counts evicted batches and lost points
+func (e *Exporter) BatchEvicted(batch *write.Batch) {
+	e.batches.WithLabelValues("evicted").Inc()
+	e.pointsLost.Add(float64(batch.Points()))
+}
+
+// BatchExpired counts expired batches and lost points
+func (e *Exporter) BatchExpired(batch *write.Batch) {
+	e.batches.WithLabelValues("expired").Inc()
+	e.pointsLost.Add(float64(batch.Points()))
+}
+
+// BatchDropped counts dropped batches and lost points
+func (e *Exporter) BatchDropped(batch *write.Batch, _ error) {
+	e.batches.WithLabelValues("dropped").Inc()
+	e.pointsLost.Add(float64(batch.Points()))
+}
+
+// ensure Exporter implements interfaces
+var (
+	_ prom.Collector = (*Exporter)(nil)
+	_ write.Observer = (*Exporter)(nil)
+)
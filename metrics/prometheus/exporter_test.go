@@ -0,0 +1,74 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/influxdata/influxdb-client-go/v2"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExporter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/write":
+			w.WriteHeader(http.StatusNoContent)
+		case "/api/v2/query":
+			w.Header().Set("Content-Type", "text/csv")
+			_, _ = w.Write([]byte("\r\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	opts := influxdb2.DefaultOptions().SetBatchSize(2)
+	exporter := NewExporter(opts)
+	client := influxdb2.NewClientWithOptions(server.URL, "my-token", opts)
+	exporter.SetClient(client)
+	registry := prom.NewPedanticRegistry()
+	require.NoError(t, registry.Register(exporter))
+
+	writeAPI := client.WriteAPI("my-org", "my-bucket")
+	for _, r := range []string{"a f=1", "a f=2", "a f=3"} {
+		writeAPI.WriteRecord(r)
+	}
+	writeAPI.Flush()
+	require.NoError(t, client.WriteAPIBlocking("my-org", "my-bucket").WriteRecord(context.Background(), "a f=4"))
+	res, err := client.QueryAPI("my-org").Query(context.Background(), "from(bucket:\"my-bucket\")")
+	require.NoError(t, err)
+	for res.Next() {
+	}
+	require.NoError(t, res.Close())
+	_, err = client.BucketsAPI().FindBucketByID(context.Background(), "0123456789abcdef")
+	require.Error(t, err)
+
+	assert.EqualValues(t, 3, testutil.ToFloat64(exporter.batches.WithLabelValues("created")))
+	assert.EqualValues(t, 3, testutil.ToFloat64(exporter.batches.WithLabelValues("written")))
+	assert.EqualValues(t, 4, testutil.ToFloat64(exporter.points))
+	assert.EqualValues(t, 0, testutil.ToFloat64(exporter.pointsLost))
+	assert.EqualValues(t, 3, testutil.ToFloat64(exporter.requests.WithLabelValues("/api/v2/write", "POST", "204")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(exporter.requests.WithLabelValues("/api/v2/query", "POST", "200")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(exporter.requests.WithLabelValues("/api/v2/buckets/{id}", "GET", "404")))
+
+	expected := `
+# HELP influxdb_client_write_retry_queue_batches Number of batches waiting for retry.
+# TYPE influxdb_client_write_retry_queue_batches gauge
+influxdb_client_write_retry_queue_batches 0
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected), "influxdb_client_write_retry_queue_batches"))
+	count, err := testutil.GatherAndCount(registry, "influxdb_client_query_duration_seconds", "influxdb_client_write_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	client.Close()
+}
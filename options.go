@@ -11,6 +11,7 @@ import (
 
 	"github.com/influxdata/influxdb-client-go/v2/api/http"
 	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Options holds configuration properties for communicating with InfluxDB server
@@ -21,6 +22,10 @@ type Options struct {
 	writeOptions *write.Options
 	// Http options
 	httpOptions *http.Options
+	// Maximum number of cached write clients of each kind, 0 means no limit
+	maxWriteAPIs uint
+	// Time in milliseconds after which unused write clients are closed, 0 means never
+	writeAPIIdleTimeout uint
 }
 
 // BatchSize returns size of batch
@@ -230,6 +235,46 @@ func (o *Options) SetApplicationName(appName string) *Options {
 	return o
 }
 
+// TracerProvider returns provider of OpenTelemetry tracer, or nil if tracing is not enabled
+func (o *Options) TracerProvider() trace.TracerProvider {
+	return o.HTTPOptions().TracerProvider()
+}
+
+// SetTracerProvider enables OpenTelemetry tracing of HTTP requests, such as queries and management calls, and of writes of batches.
+// W3C trace context is injected into request headers. Setting nil value (default) disables tracing.
+func (o *Options) SetTracerProvider(tracerProvider trace.TracerProvider) *Options {
+	o.HTTPOptions().SetTracerProvider(tracerProvider)
+	o.WriteOptions().SetTracerProvider(tracerProvider)
+	return o
+}
+
+// MaxWriteAPIs returns maximum number of non-blocking and blocking write clients cached by Client
+func (o *Options) MaxWriteAPIs() uint {
+	return o.maxWriteAPIs
+}
+
+// SetMaxWriteAPIs sets maximum number of non-blocking write clients, and separately of blocking write clients, cached by Client.
+// When a new write client exceeds the limit, the least recently used one is flushed and closed.
+// The next write to a non-blocking write client kept by the caller creates a new one.
+// Default value is 0, which means no limit.
+func (o *Options) SetMaxWriteAPIs(maxWriteAPIs uint) *Options {
+	o.maxWriteAPIs = maxWriteAPIs
+	return o
+}
+
+// WriteAPIIdleTimeout returns time in milliseconds after which unused write clients are released by Client
+func (o *Options) WriteAPIIdleTimeout() uint {
+	return o.writeAPIIdleTimeout
+}
+
+// SetWriteAPIIdleTimeout sets time in milliseconds after which write clients not requested from Client and not written to
+// are flushed, closed and released by Client. The next write to a non-blocking write client kept by the caller creates a new one.
+// Default value is 0, which means they are released only by Close.
+func (o *Options) SetWriteAPIIdleTimeout(writeAPIIdleTimeoutMs uint) *Options {
+	o.writeAPIIdleTimeout = writeAPIIdleTimeoutMs
+	return o
+}
+
 // DefaultOptions returns Options object with default values
 func DefaultOptions() *Options {
 	return &Options{logLevel: 0, writeOptions: write.DefaultOptions(), httpOptions: http.DefaultOptions()}
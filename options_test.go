@@ -16,6 +16,7 @@ import (
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestDefaultOptions(t *testing.T) {
@@ -34,6 +35,9 @@ func TestDefaultOptions(t *testing.T) {
 	assert.EqualValues(t, 20, opts.HTTPRequestTimeout())
 	assert.EqualValues(t, 0, opts.LogLevel())
 	assert.EqualValues(t, "", opts.ApplicationName())
+	assert.Nil(t, opts.TracerProvider())
+	assert.EqualValues(t, 0, opts.MaxWriteAPIs())
+	assert.EqualValues(t, 0, opts.WriteAPIIdleTimeout())
 }
 
 func TestSettingsOptions(t *testing.T) {
@@ -55,7 +59,10 @@ func TestSettingsOptions(t *testing.T) {
 		SetHTTPRequestTimeout(50).
 		SetLogLevel(3).
 		AddDefaultTag("t", "a").
-		SetApplicationName("Monitor/1.1")
+		SetApplicationName("Monitor/1.1").
+		SetTracerProvider(trace.NewNoopTracerProvider()).
+		SetMaxWriteAPIs(100).
+		SetWriteAPIIdleTimeout(60_000)
 	assert.EqualValues(t, 5, opts.BatchSize())
 	assert.EqualValues(t, true, opts.UseGZip())
 	assert.EqualValues(t, 5_000, opts.FlushInterval())
@@ -75,6 +82,10 @@ func TestSettingsOptions(t *testing.T) {
 	}
 	assert.EqualValues(t, 3, opts.LogLevel())
 	assert.Len(t, opts.WriteOptions().DefaultTags(), 1)
+	assert.Equal(t, trace.NewNoopTracerProvider(), opts.TracerProvider())
+	assert.Equal(t, trace.NewNoopTracerProvider(), opts.WriteOptions().TracerProvider())
+	assert.EqualValues(t, 100, opts.MaxWriteAPIs())
+	assert.EqualValues(t, 60_000, opts.WriteAPIIdleTimeout())
 
 	client := &http.Client{
 		Transport: &http.Transport{},
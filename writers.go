@@ -0,0 +1,343 @@
+// Copyright 2020-2021 InfluxData, Inc. All rights reserved.
+// Use of this source code is governed by MIT
+// license that can be found in the LICENSE file.
+
+package influxdb2
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/influxdata/influxdb-client-go/v2/api"
+	"github.com/influxdata/influxdb-client-go/v2/api/write"
+	"github.com/influxdata/influxdb-client-go/v2/internal/log"
+)
+
+// WriteAPIInfo describes a write client cached by Client
+type WriteAPIInfo struct {
+	// Organization and bucket of the write client, empty for InfluxDB 1.x write clients
+	Org    string
+	Bucket string
+	// Database, retention policy and username of InfluxDB 1.x write clients
+	Database        string
+	RetentionPolicy string
+	Username        string
+	// Whether it is WriteAPIBlocking
+	Blocking bool
+	// Time of the last request of the write client from Client, or of the last write of a non-blocking write client
+	LastUsed time.Time
+}
+
+// cachedWriter is a write client with its description
+type cachedWriter struct {
+	key    string
+	info   WriteAPIInfo
+	writer interface{}
+}
+
+// lastUsed returns the time of the last usage of the writer
+func (c *cachedWriter) lastUsed() time.Time {
+	if h, ok := c.writer.(*writeAPIHandle); ok {
+		if t := h.current().LastWriteTime(); t.After(c.info.LastUsed) {
+			return t
+		}
+	}
+	return c.info.LastUsed
+}
+
+// writerCache holds write clients by keys, limited to maxSize least recently used ones. Zero maxSize means no limit.
+// It is not safe for concurrent use.
+type writerCache struct {
+	maxSize int
+	entries map[string]*cachedWriter
+}
+
+func newWriterCache(maxSize int) *writerCache {
+	return &writerCache{maxSize: maxSize, entries: make(map[string]*cachedWriter)}
+}
+
+// get returns writer with key and marks it used
+func (c *writerCache) get(key string) (interface{}, bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry.info.LastUsed = time.Now()
+	return entry.writer, true
+}
+
+// add stores writer with info under key and returns entries evicted to keep the size limit
+func (c *writerCache) add(key string, info WriteAPIInfo, writer interface{}) []*cachedWriter {
+	var evicted []*cachedWriter
+	for c.maxSize > 0 && len(c.entries) >= c.maxSize {
+		var lru *cachedWriter
+		for _, entry := range c.entries {
+			if lru == nil || entry.lastUsed().Before(lru.lastUsed()) {
+				lru = entry
+			}
+		}
+		delete(c.entries, lru.key)
+		evicted = append(evicted, lru)
+	}
+	info.LastUsed = time.Now()
+	c.entries[key] = &cachedWriter{key: key, info: info, writer: writer}
+	return evicted
+}
+
+// remove removes and returns writer with key
+func (c *writerCache) remove(key string) (interface{}, bool) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	delete(c.entries, key)
+	return entry.writer, true
+}
+
+// removeIdle removes and returns entries not used since before
+func (c *writerCache) removeIdle(before time.Time) []*cachedWriter {
+	var idle []*cachedWriter
+	for key, entry := range c.entries {
+		if entry.lastUsed().Before(before) {
+			delete(c.entries, key)
+			idle = append(idle, entry)
+		}
+	}
+	return idle
+}
+
+// writers returns all writers
+func (c *writerCache) writers() []interface{} {
+	writers := make([]interface{}, 0, len(c.entries))
+	for _, entry := range c.entries {
+		writers = append(writers, entry.writer)
+	}
+	return writers
+}
+
+// infos returns descriptions of writers from the most recently used
+func (c *writerCache) infos() []WriteAPIInfo {
+	infos := make([]WriteAPIInfo, 0, len(c.entries))
+	for _, entry := range c.entries {
+		info := entry.info
+		info.LastUsed = entry.lastUsed()
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastUsed.After(infos[j].LastUsed)
+	})
+	return infos
+}
+
+// clear removes all writers
+func (c *writerCache) clear() {
+	c.entries = make(map[string]*cachedWriter)
+}
+
+// writeAPIHandle is api.WriteAPI returned by Client, which writes by a non-blocking write client cached by Client.
+// When the write client is released because of the cache limit or the idle timeout, a new one is created on the next write,
+// with the same callbacks. Errors of all write clients of the handle are reported by a single Errors channel.
+type writeAPIHandle struct {
+	client *clientImpl
+	key    string
+	info   WriteAPIInfo
+	// create creates a new write client
+	create func() *api.WriteAPIImpl
+	// writes hold lock for reading, so that the write client is not released meanwhile
+	lock sync.RWMutex
+	// actual write client, the last one if it is released
+	writer *api.WriteAPIImpl
+	// whether writer is released, it is true also before the first write client is created
+	released bool
+	// whether the handle is closed by Client, data written to a closed handle are discarded
+	closed      bool
+	failedCb    api.WriteFailedCallback
+	succeededCb api.WriteSucceededCallback
+	undelivered api.UndeliveredCallback
+	errCh       chan error
+	errWg       sync.WaitGroup
+}
+
+func newWriteAPIHandle(client *clientImpl, key string, info WriteAPIInfo, create func() *api.WriteAPIImpl) *writeAPIHandle {
+	return &writeAPIHandle{
+		client:   client,
+		key:      key,
+		info:     info,
+		create:   create,
+		released: true,
+		errCh:    make(chan error, 1),
+	}
+}
+
+// reopen creates a new write client with callbacks of the handle, if the previous one was released, and forwards its errors
+func (h *writeAPIHandle) reopen() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if !h.released || h.closed {
+		return
+	}
+	w := h.create()
+	if h.failedCb != nil {
+		w.SetWriteFailedCallback(h.failedCb)
+	}
+	if h.succeededCb != nil {
+		w.SetWriteSucceededCallback(h.succeededCb)
+	}
+	if h.undelivered != nil {
+		w.SetUndeliveredCallback(h.undelivered)
+	}
+	h.errWg.Add(1)
+	go func(errCh <-chan error) {
+		defer h.errWg.Done()
+		// channel is closed when the write client is closed
+		for err := range errCh {
+			h.reportError(err)
+		}
+	}(w.Errors())
+	h.writer = w
+	h.released = false
+}
+
+// detach marks the write client released, after writes in progress finish, and returns it
+func (h *writeAPIHandle) detach() *api.WriteAPIImpl {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.released = true
+	return h.writer
+}
+
+// close marks the handle closed and returns its write client, if it is not released
+func (h *writeAPIHandle) close() *api.WriteAPIImpl {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.closed = true
+	if h.writer == nil {
+		// closed write client discards data written to the handle
+		h.writer = h.create()
+		h.released = false
+	}
+	if h.released {
+		return nil
+	}
+	return h.writer
+}
+
+// closeErrors closes the Errors channel after all write clients of the closed handle are closed
+func (h *writeAPIHandle) closeErrors() {
+	h.errWg.Wait()
+	close(h.errCh)
+}
+
+// current returns the actual write client
+func (h *writeAPIHandle) current() *api.WriteAPIImpl {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return h.writer
+}
+
+// acquire returns the write client for writing, a new one is created if the previous one was released.
+// The write must be finished by h.lock.RUnlock.
+func (h *writeAPIHandle) acquire() *api.WriteAPIImpl {
+	h.lock.RLock()
+	for h.released && !h.closed {
+		h.lock.RUnlock()
+		h.client.attachWriteAPI(h)
+		h.lock.RLock()
+	}
+	return h.writer
+}
+
+// reportError sends err to the Errors channel, if it is read
+func (h *writeAPIHandle) reportError(err error) {
+	select {
+	case h.errCh <- err:
+	default:
+		log.Warn("Cannot write error to error channel, it is not read")
+	}
+}
+
+// WriteRecord writes asynchronously line protocol record into bucket
+func (h *writeAPIHandle) WriteRecord(line string) {
+	defer h.lock.RUnlock()
+	h.acquire().WriteRecord(line)
+}
+
+// WritePoint writes asynchronously Point into bucket
+func (h *writeAPIHandle) WritePoint(point *write.Point) {
+	defer h.lock.RUnlock()
+	h.acquire().WritePoint(point)
+}
+
+// WriteRecordWithAck writes asynchronously line protocol record into bucket and returns its acknowledgement
+func (h *writeAPIHandle) WriteRecordWithAck(line string, id interface{}) *write.Ack {
+	defer h.lock.RUnlock()
+	return h.acquire().WriteRecordWithAck(line, id)
+}
+
+// WritePointWithAck writes asynchronously Point into bucket and returns its acknowledgement
+func (h *writeAPIHandle) WritePointWithAck(point *write.Point, id interface{}) *write.Ack {
+	defer h.lock.RUnlock()
+	return h.acquire().WritePointWithAck(point, id)
+}
+
+// WriteRecordWithContext writes asynchronously line protocol record into bucket, linked to the span in ctx
+func (h *writeAPIHandle) WriteRecordWithContext(ctx context.Context, line string) {
+	defer h.lock.RUnlock()
+	h.acquire().WriteRecordWithContext(ctx, line)
+}
+
+// WritePointWithContext writes asynchronously Point into bucket, linked to the span in ctx
+func (h *writeAPIHandle) WritePointWithContext(ctx context.Context, point *write.Point) {
+	defer h.lock.RUnlock()
+	h.acquire().WritePointWithContext(ctx, point)
+}
+
+// Flush forces all pending writes from the buffer to be sent. A released write client has nothing to flush.
+func (h *writeAPIHandle) Flush() {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	if !h.released {
+		h.writer.Flush()
+	}
+}
+
+// Errors returns a channel for reading errors of all write clients of the handle.
+// New error is skipped when channel is not read.
+func (h *writeAPIHandle) Errors() <-chan error {
+	return h.errCh
+}
+
+// SetWriteFailedCallback sets callback allowing custom handling of failed writes
+func (h *writeAPIHandle) SetWriteFailedCallback(cb api.WriteFailedCallback) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.failedCb = cb
+	if !h.released {
+		h.writer.SetWriteFailedCallback(cb)
+	}
+}
+
+// SetWriteSucceededCallback sets callback notified about successfully written batches
+func (h *writeAPIHandle) SetWriteSucceededCallback(cb api.WriteSucceededCallback) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.succeededCb = cb
+	if !h.released {
+		h.writer.SetWriteSucceededCallback(cb)
+	}
+}
+
+// SetUndeliveredCallback sets callback notified about batches discarded while the write client is being closed
+func (h *writeAPIHandle) SetUndeliveredCallback(cb api.UndeliveredCallback) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.undelivered = cb
+	if !h.released {
+		h.writer.SetUndeliveredCallback(cb)
+	}
+}
+
+// ensure writeAPIHandle implements api.WriteAPI
+var _ api.WriteAPI = (*writeAPIHandle)(nil)